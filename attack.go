@@ -0,0 +1,324 @@
+package knapsack
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	mrand "math/rand"
+	"sort"
+
+	"github.com/stripedpajamas/knapsack/lll"
+)
+
+// Shamir's attack on basic (single round) Merkle-Hellman keys, from "A
+// Polynomial Time Algorithm for Breaking the Basic Merkle-Hellman Cryptosystem".
+//
+// The public key is b_i = w * a_i mod m for a superincreasing a. With
+// u = w^-1 mod m, u * b_i - k_i * m = a_i, so u/m - k_i/b_i = a_i / (m * b_i):
+// for the smallest private elements u/m is very close to k_i/b_i. Finding k_i
+// for a few of them at once is a simultaneous diophantine approximation,
+// solved here with lattice reduction (see package lll). That pins u/m down to
+// a short interval where every f_i(x) = b_i * x mod 1 is piecewise linear, and
+// any x in it at which the f_i sorted by size are superincreasing and sum to
+// less than 1 is a trapdoor: with x = U/M', U * b_i mod M' is an easy knapsack
+// equivalent to the real one, so it decrypts the same ciphertexts.
+
+// ErrAttackFailed means no trapdoor was found for a public key
+var ErrAttackFailed = errors.New("couldn't recover a trapdoor from the public key")
+
+const (
+	// shamirAnchors is how many public key elements are approximated at once;
+	// the attack needs all of them to hide small private key elements
+	shamirAnchors = 5
+	// shamirAttempts bounds the number of anchor sets tried
+	shamirAttempts = 2000
+	// shamirMargin is how many bits shorter than the Gaussian heuristic a
+	// lattice vector has to be to be tried
+	shamirMargin = 4
+	// shamirMaxDivisor bounds the d with the short vector = target / d tried
+	shamirMaxDivisor = 3
+	// shamirMaxLifts bounds the values of k_0 tried per residue mod P
+	shamirMaxLifts = 16
+)
+
+// ShamirAttack recovers an equivalent private key from a basic Merkle-Hellman
+// public key file (see BreakPublicKey)
+func ShamirAttack(pubKeyFile *PublicKeyFile) (*Knapsack, error) {
+	if pubKeyFile.DigitBits > 1 {
+		return nil, fmt.Errorf("%w: compact keys aren't supported", ErrAttackFailed)
+	}
+	return BreakPublicKey(UnpackPublic(pubKeyFile))
+}
+
+// BreakPublicKey runs Shamir's attack on a basic Merkle-Hellman public key. It
+// returns a Knapsack with the same public key and a superincreasing private key
+// under a modulus M' and multiplier W' of its own, which decrypts everything
+// encrypted to the public key. Iterated keys and the later variants resist the
+// attack; for those, and for keys too small to have a unique approximation, it
+// fails with ErrAttackFailed.
+func BreakPublicKey(publicKey []*big.Int) (*Knapsack, error) {
+	if err := ValidatePublicKey(publicKey); err != nil {
+		return nil, err
+	}
+	n := len(publicKey)
+	anchors := shamirAnchors
+	if anchors > n {
+		anchors = n
+	}
+
+	// which public elements hide small private ones is unknown, so anchor sets
+	// are drawn at random; a fixed seed keeps the attack deterministic
+	random := mrand.New(mrand.NewSource(1))
+	for attempt := 0; attempt < shamirAttempts; attempt++ {
+		idx := random.Perm(n)[:anchors]
+		// approximating with the largest element gives the shortest interval
+		sort.Slice(idx, func(i, j int) bool { return publicKey[idx[i]].Cmp(publicKey[idx[j]]) > 0 })
+		for _, k := range anchorMultiples(publicKey, idx) {
+			if trapdoor := trapdoorNear(publicKey, idx[0], k); trapdoor != nil {
+				return trapdoor, nil
+			}
+		}
+		if anchors == n {
+			break // every anchor set is the same one
+		}
+	}
+	return nil, fmt.Errorf("%w: tried %d sets of %d elements", ErrAttackFailed, shamirAttempts, anchors)
+}
+
+// anchorMultiples returns candidates for k_0, the multiple of m with
+// u * b_0 - k_0 * m small, where b_0 = publicKey[idx[0]]. The vector
+// (k_0, C * (k_0 * b_j - k_j * b_0), ...) for the other anchors j is unusually
+// short in the lattice spanned by the rows
+//
+//	(1, C * b_1, C * b_2, ..., C * b_r)
+//	(0, -C * b_0, 0, ..., 0)
+//	...
+//	(0, 0, 0, ..., -C * b_0)
+//
+// since k_0 * b_j - k_j * b_0 = (b_0 * a_j - b_j * a_0) / m is about the size of
+// a_j. C balances the two: k_0 is about m and the a_j about sqrt(m) for the
+// usual key sizes.
+func anchorMultiples(publicKey []*big.Int, idx []int) []*big.Int {
+	b0 := publicKey[idx[0]]
+	scale := new(big.Int).Lsh(big.NewInt(1), uint(b0.BitLen()/2))
+	dim := len(idx)
+	basis := make([][]*big.Int, dim)
+	for row := range basis {
+		basis[row] = make([]*big.Int, dim)
+		for col := range basis[row] {
+			basis[row][col] = new(big.Int)
+		}
+	}
+	basis[0][0].SetInt64(1)
+	for j := 1; j < dim; j++ {
+		basis[0][j].Mul(scale, publicKey[idx[j]])
+		basis[j][j].Mul(scale, b0).Neg(basis[j][j])
+	}
+	if err := lll.Reduce(basis); err != nil {
+		return nil // can't happen: the basis is triangular with no zeros on the diagonal
+	}
+
+	// the vectors that are 0 past the first coordinate are the multiples of
+	// (P, 0, ..., 0) for some P dividing b_0, so a short vector only pins k_0
+	// down mod P. It may also be the target divided by a small d, or negated.
+	period := new(big.Int).Set(b0)
+	var short [][]*big.Int
+	// a short vector from anchors that don't all hide small private elements
+	// is about as long as the Gaussian heuristic, det^(1/dim); the target is
+	// well below it
+	limit := (scale.BitLen() + b0.BitLen()) * (dim - 1) / dim
+	for _, row := range basis {
+		if isZeroVector(row[1:]) {
+			if row[0].Sign() != 0 {
+				period.Abs(row[0])
+			}
+		} else if lll.Dot(row, row).BitLen()/2 < limit-shamirMargin {
+			short = append(short, row)
+		}
+	}
+	lifts := new(big.Int).Quo(b0, period)
+	if !lifts.IsInt64() || lifts.Int64() > shamirMaxLifts {
+		return nil
+	}
+
+	var out []*big.Int
+	seen := make(map[string]bool)
+	for _, row := range short {
+		for d := int64(1); d <= shamirMaxDivisor; d++ {
+			k := new(big.Int).Mul(row[0], big.NewInt(d))
+			k.Mod(k, period)
+			for _, k := range []*big.Int{k, new(big.Int).Sub(period, k)} {
+				for lift := int64(0); lift < lifts.Int64(); lift++ {
+					candidate := new(big.Int).Mul(period, big.NewInt(lift))
+					candidate.Add(candidate, k)
+					if !seen[candidate.String()] {
+						seen[candidate.String()] = true
+						out = append(out, candidate)
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+// returns whether every element of v is 0
+func isZeroVector(v []*big.Int) bool {
+	for _, x := range v {
+		if x.Sign() != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// trapdoorNear looks for a trapdoor x = U/M' in [k/b_j, (k+1)/b_j) for
+// b_j = publicKey[anchor], and returns the Knapsack it gives or nil
+func trapdoorNear(publicKey []*big.Int, anchor int, k *big.Int) *Knapsack {
+	q := publicKey[anchor]
+	lo := new(big.Rat).SetFrac(k, q)
+	hi := new(big.Rat).SetFrac(new(big.Int).Add(k, big.NewInt(1)), q)
+
+	// every f_i wraps around to 0 at the multiples of 1/b_i in the interval;
+	// between two consecutive ones they're all linear
+	points := []*big.Rat{lo}
+	for _, b := range publicKey {
+		t := new(big.Int).Mul(b, k)
+		t.Quo(t, q)
+		for {
+			t.Add(t, big.NewInt(1))
+			x := new(big.Rat).SetFrac(t, b)
+			if x.Cmp(hi) >= 0 {
+				break
+			}
+			points = append(points, x)
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Cmp(points[j]) < 0 })
+	points = append(points, hi)
+
+	for idx := 0; idx+1 < len(points); idx++ {
+		if points[idx].Cmp(points[idx+1]) == 0 {
+			continue
+		}
+		if trapdoor := trapdoorBetween(publicKey, points[idx], points[idx+1]); trapdoor != nil {
+			return trapdoor
+		}
+	}
+	return nil
+}
+
+// trapdoorBetween looks for a trapdoor in (lo, hi), where no f_i wraps around.
+// There f_i(x) = b_i * x - c_i, so whether the f_i are superincreasing in the
+// order they have just after lo, and sum to less than 1, comes down to a
+// linear inequality in x each.
+func trapdoorBetween(publicKey []*big.Int, lo, hi *big.Rat) *Knapsack {
+	n := len(publicKey)
+	c := make([]*big.Int, n)
+	value := make([]*big.Int, n) // f_i(lo) * lo.Denom()
+	for idx, b := range publicKey {
+		v := new(big.Int).Mul(b, lo.Num())
+		c[idx], value[idx] = new(big.Int).QuoRem(v, lo.Denom(), new(big.Int))
+	}
+	order := make([]int, n)
+	for idx := range order {
+		order[idx] = idx
+	}
+	sort.Slice(order, func(i, j int) bool {
+		if cmp := value[order[i]].Cmp(value[order[j]]); cmp != 0 {
+			return cmp < 0
+		}
+		// equal at lo, so the steeper one is larger just after it
+		return publicKey[order[i]].Cmp(publicKey[order[j]]) < 0
+	})
+
+	// the element at position p in the order needs
+	// (b_p - sum(b_q)) * x > c_p - sum(c_q) over the positions q before it
+	lo, hi = new(big.Rat).Set(lo), new(big.Rat).Set(hi)
+	sumB, sumC := new(big.Int), new(big.Int)
+	for _, idx := range order {
+		slope := new(big.Int).Sub(publicKey[idx], sumB)
+		offset := new(big.Int).Sub(c[idx], sumC)
+		switch slope.Sign() {
+		case 1:
+			if bound := new(big.Rat).SetFrac(offset, slope); bound.Cmp(lo) > 0 {
+				lo = bound
+			}
+		case -1:
+			if bound := new(big.Rat).SetFrac(offset, slope); bound.Cmp(hi) < 0 {
+				hi = bound
+			}
+		default:
+			if offset.Sign() >= 0 {
+				return nil
+			}
+		}
+		if lo.Cmp(hi) >= 0 {
+			return nil
+		}
+		sumB.Add(sumB, publicKey[idx])
+		sumC.Add(sumC, c[idx])
+	}
+	// sum(b_i) * x < 1 + sum(c_i)
+	if bound := new(big.Rat).SetFrac(sumC.Add(sumC, big.NewInt(1)), sumB); bound.Cmp(hi) < 0 {
+		hi = bound
+	}
+	if lo.Cmp(hi) >= 0 {
+		return nil
+	}
+
+	// x = U/M' strictly inside (lo, hi), with M' larger than every public
+	// element so they're reduced mod M', and U invertible mod M'
+	m := new(big.Int).Set(publicKey[0])
+	for _, b := range publicKey {
+		if b.Cmp(m) > 0 {
+			m.Set(b)
+		}
+	}
+	m.Add(m, big.NewInt(1))
+	width := new(big.Rat).Sub(hi, lo)
+	minDenom := new(big.Int).Quo(new(big.Int).Mul(width.Denom(), big.NewInt(2)), width.Num())
+	if minDenom.Cmp(m) > 0 {
+		m = minDenom
+	}
+	one := big.NewInt(1)
+	for {
+		u := new(big.Int).Mul(lo.Num(), m)
+		u.Quo(u, lo.Denom())
+		u.Add(u, one)
+		if new(big.Rat).SetFrac(u, m).Cmp(hi) >= 0 {
+			return nil // can't happen: M' is at least 2 / (hi - lo)
+		}
+		w := new(big.Int).ModInverse(u, m)
+		if w == nil {
+			m = new(big.Int).Add(m, one)
+			continue
+		}
+		return trapdoorKnapsack(publicKey, order, m, w, u)
+	}
+}
+
+// trapdoorKnapsack builds the Knapsack for the trapdoor (M', W', U = W'^-1),
+// with the private key in `order`, or returns nil if it's not valid
+func trapdoorKnapsack(publicKey []*big.Int, order []int, m, w, u *big.Int) *Knapsack {
+	k := &Knapsack{
+		PublicKey:  make([]*big.Int, len(publicKey)),
+		PrivateKey: make([]*big.Int, len(publicKey)),
+		M:          m,
+		W:          w,
+		WI:         u,
+		Perm:       make([]int, len(publicKey)),
+	}
+	for privIdx, pubIdx := range order {
+		a := new(big.Int).Mul(publicKey[pubIdx], u)
+		k.PrivateKey[privIdx] = a.Mod(a, m)
+		k.Perm[pubIdx] = privIdx
+	}
+	for idx, b := range publicKey {
+		k.PublicKey[idx] = new(big.Int).Set(b)
+	}
+	if k.Validate() != nil {
+		return nil
+	}
+	return k
+}
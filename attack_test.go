@@ -0,0 +1,83 @@
+package knapsack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+func TestShamirAttack(t *testing.T) {
+	testCases := []KeygenOptions{
+		DefaultKeygenOptions(32),
+		DefaultKeygenOptions(64),
+		DefaultKeygenOptions(100),
+		// no growth: private key elements close to powers of two
+		{Length: 48, Growth: 0, ModulusBits: 50},
+	}
+	seeds := []string{"shamir", "merkle", "hellman", "lenstra"}
+	for idx, opts := range testCases {
+		for _, seed := range seeds {
+			k, err := NewKnapsackWithOptions(NewSeededReader([]byte(seed)), opts)
+			handleFatalError(err, t)
+			pub, _, err := Pack(*k)
+			handleFatalError(err, t)
+			pkf := &PublicKeyFile{}
+			handleFatalError(msgpack.Unmarshal(pub, pkf), t)
+
+			broken, err := ShamirAttack(pkf)
+			if err != nil {
+				t.Fatalf("for test case #%d, seed %q: %v", idx, seed, err)
+			}
+			handleFatalError(broken.Validate(), t)
+			if !isSuperincreasing(broken.PrivateKey) {
+				t.Errorf("for test case #%d, seed %q: recovered private key is not superincreasing", idx, seed)
+			}
+			for i, n := range k.PublicKey {
+				if broken.PublicKey[i].Cmp(n) != 0 {
+					t.Fatalf("for test case #%d, seed %q: public key element %d changed", idx, seed, i)
+				}
+			}
+
+			// the recovered key decrypts what was encrypted to the real one
+			msg := []byte("attack at dawn")
+			ct, err := EncryptBytes(k.PublicKey, msg)
+			handleFatalError(err, t)
+			d, err := broken.DecryptBytes(ct)
+			if err != nil {
+				t.Fatalf("for test case #%d, seed %q: %v", idx, seed, err)
+			}
+			if !bytes.Equal(d, msg) {
+				t.Errorf("for test case #%d, seed %q: wanted %q, got %q", idx, seed, msg, d)
+			}
+			ct, err = EncryptBytesHybrid(rand.Reader, k.PublicKey, msg)
+			handleFatalError(err, t)
+			if d, err := broken.DecryptBytes(ct); err != nil || !bytes.Equal(d, msg) {
+				t.Errorf("for test case #%d, seed %q: hybrid ciphertext didn't decrypt: %v", idx, seed, err)
+			}
+		}
+	}
+}
+
+func TestShamirAttackFails(t *testing.T) {
+	// a second round hides the superincreasing sequence from a single (W', M')
+	opts := DefaultKeygenOptions(32)
+	opts.Rounds = 2
+	k, err := NewKnapsackWithOptions(NewSeededReader([]byte("shamir")), opts)
+	handleFatalError(err, t)
+	if _, err := BreakPublicKey(k.PublicKey); !errors.Is(err, ErrAttackFailed) {
+		t.Errorf("wanted ErrAttackFailed for an iterated key, got %v", err)
+	}
+
+	compact := &PublicKeyFile{PubKey: prepareSliceOfBigs(k.PublicKey), DigitBits: 2}
+	if _, err := ShamirAttack(compact); !errors.Is(err, ErrAttackFailed) {
+		t.Errorf("wanted ErrAttackFailed for a compact key, got %v", err)
+	}
+
+	if _, err := BreakPublicKey([]*big.Int{big.NewInt(5), big.NewInt(0)}); !errors.Is(err, ErrInvalidPublicKey) {
+		t.Errorf("wanted ErrInvalidPublicKey, got %v", err)
+	}
+}
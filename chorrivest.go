@@ -0,0 +1,468 @@
+package knapsack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+// Chor–Rivest ("A Knapsack-type Public Key Cryptosystem Based on Arithmetic in
+// Finite Fields", Chor and Rivest, 1988) works in GF(p^h) = GF(p)[x] / f. With
+// t the class of x and g a generator of the field's multiplicative group, the
+// private weights are the discrete logs
+//
+//   a_i = log_g(t + i)   for i in GF(p)
+//
+// and the public key is c_i = a_Perm[i] + D mod (p^h - 1) for a random D. A
+// message is a set of exactly h indexes; its ciphertext is the sum of their
+// c_i. Removing h * D and raising g to the result gives the product of the
+// (t + i), so f plus that product (as a polynomial) has the message indexes
+// as its roots.
+
+// ChorRivestOptions picks the field for NewChorRivestWithOptions. p^h - 1
+// must only have prime factors small enough for discrete logs (see
+// ErrNotSmooth).
+type ChorRivestOptions struct {
+	P int64 // prime; the key has P elements
+	H int64 // degree of the extension; each block sets H of the P elements
+}
+
+// DefaultChorRivestOptions is GF(139^18): the largest prime factor of its
+// order has 20 bits, so a key takes seconds to generate, and a block carries
+// 73 bits
+var DefaultChorRivestOptions = ChorRivestOptions{P: 139, H: 18}
+
+// ChorRivest contains the private data used to generate a Chor–Rivest public
+// key and decrypt messages
+type ChorRivest struct {
+	PublicKey []*big.Int
+	P         int64
+	H         int64
+	F         []int64  // monic irreducible polynomial of degree H, lowest coefficient first
+	G         []int64  // generator of GF(P^H)*, as a polynomial of degree < H
+	Perm      []int    // PublicKey[i] is derived from the log of t + Perm[i]
+	D         *big.Int // random offset added to every log
+}
+
+// NewChorRivest generates Chor–Rivest params with DefaultChorRivestOptions
+func NewChorRivest() (*ChorRivest, error) {
+	return NewChorRivestWithOptions(rand.Reader, DefaultChorRivestOptions)
+}
+
+// NewChorRivestWithOptions generates Chor–Rivest params in GF(opts.P^opts.H)
+// using randomness read from `random`
+func NewChorRivestWithOptions(random io.Reader, opts ChorRivestOptions) (*ChorRivest, error) {
+	if opts.P < 2 || !big.NewInt(opts.P).ProbablyPrime(20) {
+		return nil, fmt.Errorf("%w: p = %d", ErrNotPrime, opts.P)
+	}
+	if opts.H < 2 || opts.H > opts.P {
+		return nil, errors.New("h must be in [2, p]")
+	}
+	f, err := randomIrreducible(random, opts.P, int(opts.H))
+	if err != nil {
+		return nil, err
+	}
+	field := newGFField(opts.P, f)
+	if err := field.factorOrder(); err != nil {
+		return nil, err
+	}
+	g, err := field.randomGenerator(random)
+	if err != nil {
+		return nil, err
+	}
+	perm, err := randomPermutation(random, opts.P)
+	if err != nil {
+		return nil, err
+	}
+	d, err := randomInt(random, field.order)
+	if err != nil {
+		return nil, err
+	}
+
+	cr := &ChorRivest{
+		P:    opts.P,
+		H:    opts.H,
+		F:    f,
+		G:    g,
+		Perm: perm,
+		D:    d,
+	}
+	if cr.PublicKey, err = cr.DerivePublicKey(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+func (cr *ChorRivest) field() (*gfField, error) {
+	field := newGFField(cr.P, cr.F)
+	return field, field.factorOrder()
+}
+
+// DerivePublicKey computes the public key from the private parameters. This
+// takes a discrete log for every element, one per CPU at a time.
+func (cr *ChorRivest) DerivePublicKey() ([]*big.Int, error) {
+	field, err := cr.field()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*big.Int, len(cr.Perm))
+	err = runParallel(workers(0), len(cr.Perm), func(idx int) error {
+		a, err := field.dlog(cr.G, field.xPlus(int64(cr.Perm[idx])))
+		if err != nil {
+			return err
+		}
+		a.Add(a, cr.D)
+		out[idx] = a.Mod(a, field.order)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Validate checks the structural invariants of the key and reports the first
+// one that fails. The public key is only checked if it's present.
+func (cr *ChorRivest) Validate() error {
+	if cr.P < 2 || !big.NewInt(cr.P).ProbablyPrime(20) {
+		return fmt.Errorf("%w: p = %d", ErrNotPrime, cr.P)
+	}
+	if cr.H < 2 || cr.H > cr.P {
+		return fmt.Errorf("%w: h must be in [2, p]", ErrMissingParameter)
+	}
+	if int64(len(cr.F)) != cr.H+1 || cr.F[cr.H] != 1 || !validCoefficients(cr.F, cr.P) || !isIrreducible(cr.F, cr.P) {
+		return ErrNotIrreducible
+	}
+	if int64(len(cr.G)) != cr.H || !validCoefficients(cr.G, cr.P) {
+		return ErrNotGenerator
+	}
+	field, err := cr.field()
+	if err != nil {
+		return err
+	}
+	if !field.isGenerator(cr.G) {
+		return ErrNotGenerator
+	}
+	if int64(len(cr.Perm)) != cr.P {
+		return fmt.Errorf("%w: has %d indexes for %d elements", ErrInvalidPermutation, len(cr.Perm), cr.P)
+	}
+	seen := make([]bool, len(cr.Perm))
+	for idx, alpha := range cr.Perm {
+		if alpha < 0 || alpha >= len(seen) || seen[alpha] {
+			return fmt.Errorf("%w: bad index at position %d", ErrInvalidPermutation, idx)
+		}
+		seen[alpha] = true
+	}
+	if cr.D == nil || cr.D.Sign() < 0 || cr.D.Cmp(field.order) >= 0 {
+		return fmt.Errorf("%w: D must be in [0, p^h - 1)", ErrMissingParameter)
+	}
+
+	if cr.PublicKey == nil {
+		return nil
+	}
+	derived, err := cr.DerivePublicKey()
+	if err != nil {
+		return err
+	}
+	if len(cr.PublicKey) != len(derived) {
+		return fmt.Errorf("%w: has %d elements, private key has %d", ErrPublicKeyMismatch, len(cr.PublicKey), len(derived))
+	}
+	for idx, n := range derived {
+		if cr.PublicKey[idx] == nil || cr.PublicKey[idx].Cmp(n) != 0 {
+			return fmt.Errorf("%w: element %d", ErrPublicKeyMismatch, idx)
+		}
+	}
+	return nil
+}
+
+var (
+	// ErrNotIrreducible means a Chor–Rivest F isn't a monic irreducible polynomial of degree H
+	ErrNotIrreducible = errors.New("polynomial is not irreducible")
+	// ErrNotGenerator means a Chor–Rivest G doesn't generate the field's multiplicative group
+	ErrNotGenerator = errors.New("element does not generate the multiplicative group")
+)
+
+func validCoefficients(poly []int64, p int64) bool {
+	for _, c := range poly {
+		if c < 0 || c >= p {
+			return false
+		}
+	}
+	return true
+}
+
+// subsetCapacity is the number of message bits a set of k of n indexes
+// carries: the largest power of two that fits in C(n, k), the number of sets
+func subsetCapacity(n, k int64) int {
+	return new(big.Int).Binomial(n, k).BitLen() - 1
+}
+
+// EncryptBytesChorRivest encrypts `messageBytes` using a Chor–Rivest
+// `publicKey` for GF(p^h). The padded message bits are split into blocks of
+// subsetCapacity(p, h) bits, and each block is mapped to a set of h public
+// key elements whose sum mod p^h - 1 is the block's ciphertext.
+func EncryptBytesChorRivest(publicKey []*big.Int, p, h int64, messageBytes []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	e := NewChorRivestEncryptor(&buf, publicKey, p, h)
+	if _, err := e.Write(messageBytes); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// NewChorRivestEncryptor returns an Encryptor in ModeChorRivest writing
+// ciphertext for a Chor–Rivest `publicKey` over GF(p^h) to `w`
+func NewChorRivestEncryptor(w io.Writer, publicKey []*big.Int, p, h int64) *Encryptor {
+	order := new(big.Int).Exp(big.NewInt(p), big.NewInt(h), nil)
+	order.Sub(order, big.NewInt(1))
+	capacity := 0 // rejected when encryption starts
+	if int64(len(publicKey)) == p && h >= 2 && h <= p {
+		capacity = subsetCapacity(p, h)
+	}
+	return newSchemeEncryptor(w, ModeChorRivest, capacity, func(bits []byte) (*big.Int, error) {
+		ct := new(big.Int)
+		for _, idx := range unrankSubset(bitsToInt(bits), int(p), int(h)) {
+			ct.Add(ct, publicKey[idx])
+		}
+		return ct.Mod(ct, order), nil
+	})
+}
+
+// DecryptBytes decrypts the output of EncryptBytesChorRivest
+func (cr *ChorRivest) DecryptBytes(ct []byte) ([]byte, error) {
+	return ioutil.ReadAll(NewChorRivestDecryptor(bytes.NewReader(ct), cr))
+}
+
+// NewChorRivestDecryptor returns a Decryptor reading Chor–Rivest ciphertext
+// from `r` and decrypting it with `cr`
+func NewChorRivestDecryptor(r io.Reader, cr *ChorRivest) *Decryptor {
+	return newSchemeDecryptor(r, formatChorRivest, cr.decryptBits)
+}
+
+// returns the bits of a single block
+func (cr *ChorRivest) decryptBits(ct *big.Int) ([]byte, error) {
+	field := newGFField(cr.P, cr.F)
+	if ct.Sign() < 0 || ct.Cmp(field.order) >= 0 {
+		return nil, ErrNoSolution
+	}
+
+	// g^(c - h * D) is the product of the (t + i) in the message
+	r := new(big.Int).Mul(big.NewInt(cr.H), cr.D)
+	r.Sub(ct, r).Mod(r, field.order)
+	u := field.exp(cr.G, r)
+
+	// as polynomials, u = prod(x + i) - f, so the roots of u + f are the -i
+	s := make([]int64, cr.H+1)
+	for i := range u {
+		s[i] = mod(u[i]+cr.F[i], cr.P)
+	}
+	s[cr.H] = 1
+
+	var subset []int
+	for idx, alpha := range cr.Perm {
+		if polyEval(s, mod(-int64(alpha), cr.P), cr.P) == 0 {
+			subset = append(subset, idx)
+		}
+	}
+	if int64(len(subset)) != cr.H {
+		return nil, ErrNoSolution
+	}
+	rank := rankSubset(subset)
+	capacity := subsetCapacity(cr.P, cr.H)
+	if rank.BitLen() > capacity {
+		return nil, ErrNoSolution
+	}
+	return intToBits(rank, capacity), nil
+}
+
+// evaluates the polynomial at x mod p (Horner)
+func polyEval(poly []int64, x, p int64) int64 {
+	var out int64
+	for i := len(poly) - 1; i >= 0; i-- {
+		out = (out*x + poly[i]) % p
+	}
+	return out
+}
+
+// rankSubset maps a sorted set of indexes c_0 < ... < c_(k-1) to
+// sum(C(c_j, j + 1)) (the combinatorial number system)
+func rankSubset(subset []int) *big.Int {
+	rank := new(big.Int)
+	for j, c := range subset {
+		rank.Add(rank, new(big.Int).Binomial(int64(c), int64(j+1)))
+	}
+	return rank
+}
+
+// unrankSubset is the inverse of rankSubset for sets of k indexes below n
+func unrankSubset(rank *big.Int, n, k int) []int {
+	rank = new(big.Int).Set(rank)
+	subset := make([]int, k)
+	c := n - 1
+	for j := k; j >= 1; j-- {
+		// largest c with C(c, j) <= rank
+		binom := new(big.Int)
+		for ; c >= j-1; c-- {
+			if binom.Binomial(int64(c), int64(j)).Cmp(rank) <= 0 {
+				break
+			}
+		}
+		rank.Sub(rank, binom)
+		subset[j-1] = c
+		c--
+	}
+	return subset
+}
+
+// reads bits (most significant first) as an integer
+func bitsToInt(bits []byte) *big.Int {
+	n := new(big.Int)
+	for _, bit := range bits {
+		n.Lsh(n, 1)
+		if bit == 1 {
+			n.SetBit(n, 0, 1)
+		}
+	}
+	return n
+}
+
+// returns the low `length` bits of n, most significant first
+func intToBits(n *big.Int, length int) []byte {
+	bits := make([]byte, length)
+	for i := range bits {
+		bits[i] = byte(n.Bit(length - 1 - i))
+	}
+	return bits
+}
+
+// ChorRivestPublicKey is a Chor–Rivest public key and its field as a PublicKey
+type ChorRivestPublicKey struct {
+	Key []*big.Int
+	P   int64 // characteristic of the field
+	H   int64 // degree of the extension
+}
+
+// Elements returns the public key
+func (pk *ChorRivestPublicKey) Elements() []*big.Int {
+	return pk.Key
+}
+
+// Public returns the public key and field parameters
+func (cr *ChorRivest) Public() PublicKey {
+	return &ChorRivestPublicKey{Key: cr.PublicKey, P: cr.P, H: cr.H}
+}
+
+// ChorRivestScheme is the Cryptosystem for ChorRivest keys, registered as
+// "chor-rivest". It only encrypts for one recipient, deterministically.
+type ChorRivestScheme struct {
+	// Options replaces DefaultChorRivestOptions in GenerateKey if it's set
+	Options *ChorRivestOptions
+}
+
+// Name returns "chor-rivest"
+func (ChorRivestScheme) Name() string {
+	return "chor-rivest"
+}
+
+// GenerateKey returns a *ChorRivest. The field fixes the block size, so
+// `length` is ignored.
+func (s ChorRivestScheme) GenerateKey(random io.Reader, length int64) (PrivateKey, error) {
+	opts := DefaultChorRivestOptions
+	if s.Options != nil {
+		opts = *s.Options
+	}
+	return NewChorRivestWithOptions(random, opts)
+}
+
+// Encrypt is EncryptBytesChorRivest; `random` isn't used
+func (s ChorRivestScheme) Encrypt(random io.Reader, publicKey PublicKey, message []byte) ([]byte, error) {
+	return encryptWith(s, random, publicKey, message, EncryptOptions{})
+}
+
+// Decrypt is ChorRivest.DecryptBytes
+func (s ChorRivestScheme) Decrypt(privateKey PrivateKey, ct []byte) ([]byte, error) {
+	return decryptWith(s, privateKey, ct)
+}
+
+// NewEncryptor returns NewChorRivestEncryptor. Only textbook encryption for
+// one recipient is supported, so it's also what the zero EncryptOptions mean.
+func (ChorRivestScheme) NewEncryptor(w io.Writer, recipients []PublicKey, opts EncryptOptions) (*Encryptor, error) {
+	if len(recipients) != 1 || opts.Hybrid || opts.Randomized {
+		return nil, errors.New("Chor–Rivest keys only support textbook encryption for a single recipient")
+	}
+	pk, ok := recipients[0].(*ChorRivestPublicKey)
+	if !ok {
+		return nil, ErrWrongScheme
+	}
+	return NewChorRivestEncryptor(w, pk.Key, pk.P, pk.H), nil
+}
+
+// NewDecryptor returns NewChorRivestDecryptor
+func (ChorRivestScheme) NewDecryptor(r io.Reader, privateKey PrivateKey) (*Decryptor, error) {
+	cr, ok := privateKey.(*ChorRivest)
+	if !ok {
+		return nil, ErrWrongScheme
+	}
+	return NewChorRivestDecryptor(r, cr), nil
+}
+
+// MarshalPublicKey writes a ChorRivestPublicKeyFile
+func (ChorRivestScheme) MarshalPublicKey(publicKey PublicKey) ([]byte, error) {
+	pk, ok := publicKey.(*ChorRivestPublicKey)
+	if !ok {
+		return nil, ErrWrongScheme
+	}
+	return msgpack.Marshal(&ChorRivestPublicKeyFile{
+		PubKey: prepareSliceOfBigs(pk.Key),
+		P:      pk.P,
+		H:      pk.H,
+	})
+}
+
+// MarshalPrivateKey writes a ChorRivestPrivateKeyFile
+func (ChorRivestScheme) MarshalPrivateKey(privateKey PrivateKey) ([]byte, error) {
+	cr, ok := privateKey.(*ChorRivest)
+	if !ok {
+		return nil, ErrWrongScheme
+	}
+	_, priv, err := PackChorRivest(*cr)
+	return priv, err
+}
+
+// UnmarshalPublicKey reads a ChorRivestPublicKeyFile
+func (ChorRivestScheme) UnmarshalPublicKey(b []byte) (PublicKey, error) {
+	if err := checkKeyFields(b, []string{"PubKey", "P", "H"}); err != nil {
+		return nil, err
+	}
+	pkf := &ChorRivestPublicKeyFile{}
+	if err := msgpack.Unmarshal(b, pkf); err != nil {
+		return nil, err
+	}
+	pk, p, h := UnpackChorRivestPublic(pkf)
+	if int64(len(pk)) != p || h < 2 || h > p {
+		return nil, fmt.Errorf("%w: has %d elements for GF(%d^%d)", ErrInvalidPublicKey, len(pk), p, h)
+	}
+	return &ChorRivestPublicKey{Key: pk, P: p, H: h}, nil
+}
+
+// UnmarshalPrivateKey reads a ChorRivestPrivateKeyFile (see
+// UnpackChorRivestPrivate)
+func (ChorRivestScheme) UnmarshalPrivateKey(b []byte) (PrivateKey, error) {
+	if err := checkKeyFields(b, []string{"P", "H", "F", "G", "Perm", "D"}); err != nil {
+		return nil, err
+	}
+	skf := &ChorRivestPrivateKeyFile{}
+	if err := msgpack.Unmarshal(b, skf); err != nil {
+		return nil, err
+	}
+	return UnpackChorRivestPrivate(skf)
+}
@@ -0,0 +1,169 @@
+package knapsack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+var testChorRivestOptions = ChorRivestOptions{P: 29, H: 12}
+
+func TestSubsetRank(t *testing.T) {
+	n, k := 13, 6
+	total := new(big.Int).Binomial(int64(n), int64(k)).Int64()
+	for rank := int64(0); rank < total; rank++ {
+		subset := unrankSubset(big.NewInt(rank), n, k)
+		for j := 1; j < len(subset); j++ {
+			if subset[j] <= subset[j-1] || subset[j] >= n {
+				t.Fatalf("rank %d: bad subset %v", rank, subset)
+			}
+		}
+		if got := rankSubset(subset); got.Int64() != rank {
+			t.Fatalf("rank %d: subset %v ranks as %v", rank, subset, got)
+		}
+	}
+}
+
+func TestChorRivestKeygen(t *testing.T) {
+	cr, err := NewChorRivestWithOptions(rand.Reader, testChorRivestOptions)
+	handleFatalError(err, t)
+	handleFatalError(cr.Validate(), t)
+	if int64(len(cr.PublicKey)) != cr.P {
+		t.Errorf("wanted %d public key elements, got %d", cr.P, len(cr.PublicKey))
+	}
+
+	if _, err := NewChorRivestWithOptions(rand.Reader, ChorRivestOptions{P: 15, H: 4}); !errors.Is(err, ErrNotPrime) {
+		t.Errorf("wanted ErrNotPrime, got %v", err)
+	}
+	// 17^11 - 1 has a 41 bit prime factor
+	if _, err := NewChorRivestWithOptions(rand.Reader, ChorRivestOptions{P: 17, H: 11}); !errors.Is(err, ErrNotSmooth) {
+		t.Errorf("wanted ErrNotSmooth, got %v", err)
+	}
+}
+
+func TestChorRivestSeeded(t *testing.T) {
+	a, err := NewChorRivestWithOptions(NewSeededReader([]byte("seed")), testChorRivestOptions)
+	handleFatalError(err, t)
+	b, err := NewChorRivestWithOptions(NewSeededReader([]byte("seed")), testChorRivestOptions)
+	handleFatalError(err, t)
+	for idx := range a.PublicKey {
+		if a.PublicKey[idx].Cmp(b.PublicKey[idx]) != 0 {
+			t.Fatal("the same seed generated different keys")
+		}
+	}
+}
+
+func TestDecryptChorRivest(t *testing.T) {
+	for _, opts := range []ChorRivestOptions{{P: 13, H: 6}, testChorRivestOptions} {
+		cr, err := NewChorRivestWithOptions(rand.Reader, opts)
+		handleFatalError(err, t)
+
+		for _, size := range []int{0, 1, 8, 100} {
+			msg := make([]byte, size)
+			_, err := rand.Read(msg)
+			handleFatalError(err, t)
+
+			ct, err := EncryptBytesChorRivest(cr.PublicKey, cr.P, cr.H, msg)
+			handleFatalError(err, t)
+			if ct[0] != formatChorRivest {
+				t.Fatalf("wanted Chor–Rivest format byte, got %d", ct[0])
+			}
+			d, err := cr.DecryptBytes(ct)
+			if err != nil {
+				t.Fatalf("GF(%d^%d), size %d: %v", opts.P, opts.H, size, err)
+			}
+			if !bytes.Equal(d, msg) {
+				t.Errorf("GF(%d^%d), size %d: decrypted message differs", opts.P, opts.H, size)
+			}
+		}
+	}
+}
+
+func TestDecryptChorRivestErrors(t *testing.T) {
+	cr, err := NewChorRivestWithOptions(rand.Reader, testChorRivestOptions)
+	handleFatalError(err, t)
+
+	ct, err := EncryptBytesChorRivest(cr.PublicKey, cr.P, cr.H, []byte("hello"))
+	handleFatalError(err, t)
+	blocks, err := unpackCiphertext(formatChorRivest, ct)
+	handleFatalError(err, t)
+	blocks[0].Add(blocks[0], big.NewInt(1))
+	_, err = cr.DecryptBytes(packCiphertext(formatChorRivest, blocks))
+	var decErr *DecryptError
+	if !errors.As(err, &decErr) || !errors.Is(err, ErrNoSolution) {
+		t.Errorf("wanted DecryptError wrapping ErrNoSolution, got %v", err)
+	}
+
+	k, err := NewKnapsack(32)
+	handleFatalError(err, t)
+	knapsackCt, err := EncryptBytes(k.PublicKey, []byte("hello"))
+	handleFatalError(err, t)
+	if _, err := cr.DecryptBytes(knapsackCt); !errors.Is(err, ErrMalformedCiphertext) {
+		t.Errorf("wanted ErrMalformedCiphertext decrypting with ChorRivest, got %v", err)
+	}
+
+	// the public key has to match the field
+	if _, err := EncryptBytesChorRivest(cr.PublicKey[1:], cr.P, cr.H, []byte("hello")); err == nil {
+		t.Error("encrypted with a public key of the wrong length")
+	}
+}
+
+func TestValidateChorRivest(t *testing.T) {
+	cr, err := NewChorRivestWithOptions(rand.Reader, ChorRivestOptions{P: 13, H: 6})
+	handleFatalError(err, t)
+
+	bad := *cr
+	bad.F = append([]int64{0}, cr.F[1:]...) // divisible by x
+	if err := bad.Validate(); !errors.Is(err, ErrNotIrreducible) {
+		t.Errorf("wanted ErrNotIrreducible, got %v", err)
+	}
+
+	bad = *cr
+	bad.G = make([]int64, cr.H)
+	bad.G[0] = 1
+	if err := bad.Validate(); !errors.Is(err, ErrNotGenerator) {
+		t.Errorf("wanted ErrNotGenerator, got %v", err)
+	}
+
+	bad = *cr
+	bad.Perm = append([]int{cr.Perm[1]}, cr.Perm[1:]...)
+	if err := bad.Validate(); !errors.Is(err, ErrInvalidPermutation) {
+		t.Errorf("wanted ErrInvalidPermutation, got %v", err)
+	}
+
+	bad = *cr
+	bad.PublicKey = append([]*big.Int{big.NewInt(2)}, cr.PublicKey[1:]...)
+	if cr.PublicKey[0].Cmp(big.NewInt(2)) != 0 {
+		if err := bad.Validate(); !errors.Is(err, ErrPublicKeyMismatch) {
+			t.Errorf("wanted ErrPublicKeyMismatch, got %v", err)
+		}
+	}
+}
+
+func TestPackUnpackChorRivest(t *testing.T) {
+	cr, err := NewChorRivestWithOptions(rand.Reader, testChorRivestOptions)
+	handleFatalError(err, t)
+
+	pubKeyFile, privKeyFile, err := PackChorRivest(*cr)
+	handleFatalError(err, t)
+	a := ChorRivestPublicKeyFile{}
+	b := ChorRivestPrivateKeyFile{}
+	handleFatalError(msgpack.Unmarshal(pubKeyFile, &a), t)
+	handleFatalError(msgpack.Unmarshal(privKeyFile, &b), t)
+
+	pk, p, h := UnpackChorRivestPublic(&a)
+	unpacked, err := UnpackChorRivestPrivate(&b)
+	handleFatalError(err, t)
+	if p != cr.P || h != cr.H || unpacked.D.Cmp(cr.D) != 0 {
+		t.Error("P, H or D unequal")
+	}
+	for idx, n := range cr.PublicKey {
+		if pk[idx].Cmp(n) != 0 || unpacked.PublicKey[idx].Cmp(n) != 0 {
+			t.Fatalf("public key element %d unequal", idx)
+		}
+	}
+}
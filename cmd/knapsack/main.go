@@ -2,11 +2,17 @@ package main
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/big"
 	"os"
 	"path/filepath"
+	"strings"
+	"unicode"
 
 	"github.com/alecthomas/kong"
 	"github.com/stripedpajamas/knapsack"
@@ -14,17 +20,27 @@ import (
 )
 
 type NewCmd struct {
-	Length int64  `default:"100" help:"Desired public/private key length."`
-	OutDir string `type:"existingdir" name:"out-dir" help:"Output directory for public/private key files"`
+	Length      int64   `default:"100" help:"Desired public/private key length."`
+	OutDir      string  `type:"existingdir" name:"out-dir" help:"Output directory for public/private key files"`
+	Seed        string  `xor:"seed" name:"seed" help:"Hex-encoded seed; the same seed and length always generate the same Knapsack."`
+	Passphrase  string  `xor:"seed" name:"passphrase" help:"Passphrase to derive a seed from; the same passphrase and length always generate the same Knapsack."`
+	Growth      int64   `name:"growth" help:"Random bits per private key element beyond what superincreasing requires (default: length)."`
+	ModulusBits int64   `name:"modulus-bits" help:"Bit length of the modulus (default: length * digit-bits + growth + 2)."`
+	Density     float64 `name:"density" help:"Target public key density; overrides growth and modulus-bits."`
+	Rounds      int64   `default:"1" name:"rounds" help:"Number of (W, M) modular multiplications (iterated Merkle-Hellman)."`
+	MH1978      bool    `name:"mh1978" help:"Use the original Merkle-Hellman 1978 parameters (length 100); ignores the other size flags."`
+	Signing     bool    `name:"signing" help:"Generate a signing key (Shamir's fast signature scheme) with a length bit modulus instead of an encryption key. Ignores the other size flags."`
+	DigitBits   int64   `name:"digit-bits" help:"Message bits per key element (compact knapsack, 1-8; default: 1)."`
+	Scheme      string  `default:"merkle-hellman" name:"scheme" help:"Cryptosystem to generate a key for: ${schemes}. The size flags other than length only apply to merkle-hellman."`
+	Variant     string  `default:"merkle-hellman" enum:"merkle-hellman,graham-shamir,goodman-mcauley" name:"variant" help:"Easy knapsack behind a merkle-hellman key: ${enum}. For goodman-mcauley, growth is the bit length of each CRT modulus."`
 }
 
 func (n *NewCmd) Run() error {
-	fmt.Fprintf(os.Stderr, "Generating new Knapsack with key length %d...\n\n", n.Length)
-	k, err := knapsack.NewKnapsack(n.Length)
+	random, err := n.getRandom()
 	if err != nil {
 		return err
 	}
-	pkf, skf, err := knapsack.Pack(*k)
+	pkf, skf, err := n.generate(random)
 	if err != nil {
 		return err
 	}
@@ -46,16 +62,120 @@ func (n *NewCmd) Run() error {
 	return nil
 }
 
+// generate makes the key the flags ask for and returns its packed public and
+// private key files
+func (n *NewCmd) generate(random io.Reader) ([]byte, []byte, error) {
+	if n.Signing {
+		fmt.Fprintf(os.Stderr, "Generating new signing key with a %d bit modulus...\n\n", n.Length)
+		sk, err := knapsack.NewSigningKeyWithReader(random, n.Length)
+		if err != nil {
+			return nil, nil, err
+		}
+		return knapsack.PackSigningKey(*sk)
+	}
+	scheme, err := knapsack.LookupScheme(n.Scheme)
+	if err != nil {
+		return nil, nil, err
+	}
+	if mh, ok := scheme.(knapsack.MerkleHellmanScheme); ok {
+		opts, err := n.getKeygenOptions()
+		if err != nil {
+			return nil, nil, err
+		}
+		mh.Options = &opts
+		scheme = mh
+		fmt.Fprintf(os.Stderr, "Generating new Knapsack with key length %d...\n\n", opts.Length)
+	} else {
+		fmt.Fprintf(os.Stderr, "Generating new %s key with key length %d...\n\n", scheme.Name(), n.Length)
+	}
+
+	sk, err := scheme.GenerateKey(random, n.Length)
+	if err != nil {
+		return nil, nil, err
+	}
+	skf, err := scheme.MarshalPrivateKey(sk)
+	if err != nil {
+		return nil, nil, err
+	}
+	if o, ok := sk.(*knapsack.OTU); ok {
+		fmt.Fprintf(os.Stderr, "Public key density: %.4f\n\n", knapsack.Density(o.PublicKey))
+	}
+	if k, ok := sk.(*knapsack.Knapsack); ok {
+		fmt.Fprintf(os.Stderr, "Public key density: %.4f\n\n", knapsack.Density(k.PublicKey))
+	}
+	pkf, err := scheme.MarshalPublicKey(sk.Public())
+	return pkf, skf, err
+}
+
+// getKeygenOptions starts from the defaults for the chosen length and applies
+// any size flags that were set
+func (n *NewCmd) getKeygenOptions() (knapsack.KeygenOptions, error) {
+	variant, err := knapsack.ParseVariant(n.Variant)
+	if err != nil {
+		return knapsack.KeygenOptions{}, err
+	}
+	if variant != knapsack.VariantMerkleHellman && n.MH1978 {
+		return knapsack.KeygenOptions{}, fmt.Errorf("--mh1978 doesn't apply to %s keys", variant)
+	}
+	if n.MH1978 {
+		opts := knapsack.MerkleHellman1978
+		opts.Rounds = n.Rounds
+		return opts, nil
+	}
+	opts := knapsack.DefaultKeygenOptions(n.Length)
+	switch {
+	case variant == knapsack.VariantGrahamShamir:
+		opts = knapsack.GrahamShamirKeygenOptions(n.Length)
+	case variant == knapsack.VariantGoodmanMcAuley:
+		opts = knapsack.GoodmanMcAuleyKeygenOptions(n.Length)
+	case n.DigitBits > 1:
+		opts = knapsack.CompactKeygenOptions(n.Length, n.DigitBits)
+	}
+	opts.DigitBits = n.DigitBits
+	if n.Growth != 0 {
+		opts.Growth = n.Growth
+		opts.ModulusBits = opts.MinModulusBits()
+	}
+	if n.ModulusBits != 0 {
+		opts.ModulusBits = n.ModulusBits
+	}
+	opts.Density = n.Density
+	opts.Rounds = n.Rounds
+	return opts, nil
+}
+
+// getRandom returns a deterministic reader if a seed or passphrase was given
+func (n *NewCmd) getRandom() (io.Reader, error) {
+	switch {
+	case n.Seed != "":
+		seed, err := hex.DecodeString(n.Seed)
+		if err != nil {
+			return nil, fmt.Errorf("seed must be hex-encoded: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Using deterministic randomness from seed\n\n")
+		return knapsack.NewSeededReader(seed), nil
+	case n.Passphrase != "":
+		fmt.Fprintf(os.Stderr, "Using deterministic randomness from passphrase\n\n")
+		return knapsack.NewSeededReader(knapsack.SeedFromPassphrase(n.Passphrase)), nil
+	}
+	return rand.Reader, nil
+}
+
 type InputCmd interface {
 	getText() string
 	getInFile() string
 }
 
 type EncryptCmd struct {
-	PublicKeyFile string `required type:"existingfile" name:"pubfile" short:"p" help:"Path of public key file to use for encryption."`
-	Text          string `xor:"input" name:"text" short:"t" help:"Text to encrypt."`
-	InFile        string `type:"existingfile" xor:"input" name:"in" short:"i" help:"Input file to encrypt."`
-	OutFile       string `type:"path" name:"out" short:"o" help:"Output file to write ciphertext."`
+	PublicKeyFiles []string `required type:"existingfile" name:"pubfile" short:"p" help:"Path of public key file to use for encryption. Repeat for several recipients."`
+	Text           string   `xor:"input" name:"text" short:"t" help:"Text to encrypt."`
+	InFile         string   `type:"existingfile" xor:"input" name:"in" short:"i" help:"Input file to encrypt."`
+	OutFile        string   `type:"path" name:"out" short:"o" help:"Output file to write ciphertext."`
+	Hybrid         bool     `xor:"mode" name:"hybrid" help:"Encrypt with a random AES-GCM key and only encrypt that key with the public key. This is the default for merkle-hellman keys that aren't compact."`
+	Textbook       bool     `xor:"mode" name:"textbook" help:"Knapsack-encrypt the input itself with deterministic textbook encryption. This is the only mode, and so the default, for naccache-stern, chor-rivest and otu keys."`
+	Randomized     bool     `xor:"mode" name:"randomized" help:"Knapsack-encrypt the input itself with randomized padding; needs a merkle-hellman key of at least 512 elements."`
+	Jobs           int      `name:"jobs" short:"j" help:"Number of blocks to encrypt at once (default: number of CPUs)."`
+	Scheme         string   `name:"scheme" help:"Cryptosystem of the public keys: ${schemes} (default: detected from the key files)."`
 }
 
 func (e EncryptCmd) getText() string {
@@ -67,36 +187,55 @@ func (e EncryptCmd) getInFile() string {
 }
 
 func (e *EncryptCmd) Run() error {
-	// load public key
-	pkfRaw, err := ioutil.ReadFile(e.PublicKeyFile)
+	var scheme knapsack.Cryptosystem
+	var pks []knapsack.PublicKey
+	for _, path := range e.PublicKeyFiles {
+		cs, pk, err := loadPublicKey(path, e.Scheme)
+		if err != nil {
+			return err
+		}
+		if scheme != nil && cs.Name() != scheme.Name() {
+			return fmt.Errorf("%s is a %s key, but %s is a %s key; all public keys must be for the same scheme", path, cs.Name(), e.PublicKeyFiles[0], scheme.Name())
+		}
+		scheme = cs
+		fmt.Fprintf(os.Stderr, "Encrypting using public key %s...\n", knapsack.PublicKeyFingerprint(pk.Elements()))
+		pks = append(pks, pk)
+	}
+	fmt.Fprintln(os.Stderr)
+
+	input, err := openInput(e)
 	if err != nil {
 		return err
 	}
-	pkf := &knapsack.PublicKeyFile{}
-	err = msgpack.Unmarshal(pkfRaw, pkf)
+	defer input.Close()
+	output, err := openOutput(e.OutFile)
 	if err != nil {
 		return err
 	}
-	pk := knapsack.UnpackPublic(pkf)
-	fmt.Fprintf(os.Stderr, "Encrypting using public key %0x...\n\n", knapsack.GetKeyID(pk))
 
-	input, err := getInputBytes(e)
+	// ciphertext is always hex encoded
+	enc, err := scheme.NewEncryptor(hex.NewEncoder(output), pks, knapsack.EncryptOptions{
+		Hybrid:     e.Hybrid,
+		Textbook:   e.Textbook,
+		Randomized: e.Randomized,
+	})
 	if err != nil {
+		output.abort()
 		return err
 	}
-	ct, err := knapsack.EncryptBytes(pk, input)
+	enc.Jobs = e.Jobs
+	if _, err = io.Copy(enc, input); err == nil {
+		err = enc.Close()
+	}
 	if err != nil {
+		output.abort()
+		return err
+	}
+	if err := output.finish(); err != nil {
 		return err
 	}
-
 	if e.OutFile != "" {
-		err = ioutil.WriteFile(e.OutFile, []byte(fmt.Sprintf("%0x", ct)), 0600)
-		if err != nil {
-			return err
-		}
 		fmt.Fprintf(os.Stderr, "Successfully encrypted and saved to %s\n", e.OutFile)
-	} else {
-		fmt.Printf("%0x\n", ct)
 	}
 	return nil
 }
@@ -106,6 +245,8 @@ type DecryptCmd struct {
 	Text           string `xor:"input" name:"text" short:"t" help:"Hex-encoded input to decrypt."`
 	InFile         string `type:"existingfile" xor:"input" name:"in" short:"i" help:"Input file to decrypt."`
 	OutFile        string `type:"path" name:"out" short:"o" help:"Output file to write plaintext."`
+	Jobs           int    `name:"jobs" short:"j" help:"Number of blocks to decrypt at once (default: number of CPUs)."`
+	Scheme         string `name:"scheme" help:"Cryptosystem of the private key: ${schemes} (default: detected from the key file)."`
 }
 
 func (d DecryptCmd) getText() string {
@@ -117,41 +258,257 @@ func (d DecryptCmd) getInFile() string {
 }
 
 func (d *DecryptCmd) Run() error {
-	// load knapsack
-	skfRaw, err := ioutil.ReadFile(d.PrivateKeyFile)
+	scheme, sk, err := loadPrivateKey(d.PrivateKeyFile, d.Scheme)
 	if err != nil {
 		return err
 	}
-	skf := &knapsack.PrivateKeyFile{}
-	err = msgpack.Unmarshal(skfRaw, skf)
+	fmt.Fprintf(os.Stderr, "Decrypting using private key %s...\n\n", privateFingerprint(sk))
+
+	input, err := openInput(d)
 	if err != nil {
 		return err
 	}
-	k := knapsack.UnpackPrivate(skf)
-	fmt.Fprintf(os.Stderr, "Decrypting using private key %0x...\n\n", knapsack.GetKeyID(k.PrivateKey))
-
-	rawInput, err := getInputBytes(d)
+	defer input.Close()
+	output, err := openOutput(d.OutFile)
 	if err != nil {
 		return err
 	}
 
 	// input to decrypt is always hex encoded
-	input := make([]byte, len(rawInput)/2)
-	_, err = hex.Decode(input, bytes.TrimSpace(rawInput))
+	dec, err := scheme.NewDecryptor(hex.NewDecoder(skipSpace{input}), sk)
 	if err != nil {
+		output.abort()
+		return err
+	}
+	dec.Jobs = d.Jobs
+	if _, err := io.Copy(output, dec); err != nil {
+		output.abort()
+		return describeDecryptError(err)
+	}
+	if err := output.finish(); err != nil {
 		return err
 	}
-	plaintext := k.DecryptBytes(input)
-
 	if d.OutFile != "" {
-		err = ioutil.WriteFile(d.OutFile, plaintext, 0600)
+		fmt.Fprintf(os.Stderr, "Successfully decrypted and saved to %s\n", d.OutFile)
+	}
+	return nil
+}
+
+type PubkeyCmd struct {
+	PrivateKeyFile string `required type:"existingfile" name:"privfile" short:"p" help:"Path of private (or signing) key file to derive the public key from."`
+	OutFile        string `type:"path" default:"knapsack_public.pack" name:"out" short:"o" help:"Output file to write the public key."`
+	Force          bool   `name:"force" help:"Overwrite the output file if it exists."`
+}
+
+func (p *PubkeyCmd) Run() error {
+	var pkf []byte
+	var elements []*big.Int
+	signer, err := loadSigningKey(p.PrivateKeyFile)
+	switch {
+	case err == nil:
+		pkf, err = knapsack.PackVerifier(*signer)
+		elements = signer.PublicKey
+	case errors.Is(err, knapsack.ErrWrongScheme):
+		var scheme knapsack.Cryptosystem
+		var sk knapsack.PrivateKey
+		scheme, sk, err = loadPrivateKey(p.PrivateKeyFile, "")
 		if err != nil {
 			return err
 		}
-		fmt.Fprintf(os.Stderr, "Successfully decrypted and saved to %s\n", d.OutFile)
+		pkf, err = scheme.MarshalPublicKey(sk.Public())
+		elements = sk.Public().Elements()
+	}
+	if err != nil {
+		return err
+	}
+	err = writeKeyFile(p.OutFile, pkf, p.Force)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Successfully derived public key %s and saved to %s\n", knapsack.PublicKeyFingerprint(elements), p.OutFile)
+	return nil
+}
+
+type SignCmd struct {
+	PrivateKeyFile string `required type:"existingfile" name:"privfile" short:"p" help:"Path of signing key file (see new --signing) to sign with."`
+	Text           string `xor:"input" name:"text" short:"t" help:"Text to sign."`
+	InFile         string `type:"existingfile" xor:"input" name:"in" short:"i" help:"Input file to sign."`
+	OutFile        string `type:"path" name:"out" short:"o" help:"Output file to write the signature."`
+}
+
+func (s SignCmd) getText() string {
+	return s.Text
+}
+
+func (s SignCmd) getInFile() string {
+	return s.InFile
+}
+
+func (s *SignCmd) Run() error {
+	sk, err := loadSigningKey(s.PrivateKeyFile)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Signing using key %s...\n\n", knapsack.PublicKeyFingerprint(sk.PublicKey))
+
+	input, err := getInputBytes(s)
+	if err != nil {
+		return err
+	}
+	sig, err := sk.Sign(input)
+	if err != nil {
+		return err
+	}
+
+	if s.OutFile != "" {
+		err = ioutil.WriteFile(s.OutFile, []byte(fmt.Sprintf("%0x", sig)), 0600)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Successfully signed and saved signature to %s\n", s.OutFile)
+	} else {
+		fmt.Printf("%0x\n", sig)
+	}
+	return nil
+}
+
+type VerifyCmd struct {
+	PublicKeyFile string `required type:"existingfile" name:"pubfile" short:"p" help:"Path of the signing key's public key file to verify with."`
+	Signature     string `xor:"sig" name:"sig" short:"s" help:"Hex-encoded signature."`
+	SigFile       string `type:"existingfile" xor:"sig" name:"sigfile" help:"File containing the hex-encoded signature."`
+	Text          string `xor:"input" name:"text" short:"t" help:"Text that was signed."`
+	InFile        string `type:"existingfile" xor:"input" name:"in" short:"i" help:"Input file that was signed."`
+}
+
+func (v VerifyCmd) getText() string {
+	return v.Text
+}
+
+func (v VerifyCmd) getInFile() string {
+	return v.InFile
+}
+
+func (v *VerifyCmd) Run() error {
+	pk, m, err := loadVerifier(v.PublicKeyFile)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Verifying using public key %s...\n\n", knapsack.PublicKeyFingerprint(pk))
+
+	rawSig := []byte(v.Signature)
+	if v.SigFile != "" {
+		rawSig, err = ioutil.ReadFile(v.SigFile)
+		if err != nil {
+			return err
+		}
+	}
+	if len(rawSig) == 0 {
+		return errors.New("missing signature; pass --sig or --sigfile")
+	}
+	sig, err := hex.DecodeString(string(bytes.TrimSpace(rawSig)))
+	if err != nil {
+		return err
+	}
+
+	input, err := getInputBytes(v)
+	if err != nil {
+		return err
+	}
+	if err := knapsack.Verify(pk, m, input, sig); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Signature is valid\n")
+	return nil
+}
+
+type FingerprintCmd struct {
+	KeyFile string `required type:"existingfile" name:"keyfile" short:"p" help:"Path of public or private key file."`
+	Format  string `enum:"hex,base32,randomart,legacy" default:"hex" name:"format" short:"f" help:"Fingerprint format: hex, base32, randomart, or legacy (the 10-byte key ID older versions showed)."`
+}
+
+func (f *FingerprintCmd) Run() error {
+	raw, err := ioutil.ReadFile(f.KeyFile)
+	if err != nil {
+		return err
+	}
+	var fp knapsack.Fingerprint
+	var legacyID []byte
+	if signer, err := knapsack.UnmarshalSigningKey(raw); !errors.Is(err, knapsack.ErrWrongScheme) {
+		if err != nil {
+			return fmt.Errorf("invalid signing key file %s: %w", f.KeyFile, err)
+		}
+		fp, legacyID = knapsack.PublicKeyFingerprint(signer.PublicKey), knapsack.GetKeyID(signer.PublicKey)
+		fmt.Fprintf(os.Stderr, "Signing key %s\n\n", f.KeyFile)
+	} else if _, sk, err := knapsack.UnmarshalPrivateKey(raw); !errors.Is(err, knapsack.ErrUnknownScheme) {
+		if err != nil {
+			return fmt.Errorf("invalid private key file %s: %w", f.KeyFile, err)
+		}
+		fp, legacyID = privateFingerprint(sk), knapsack.GetKeyID(sk.Public().Elements())
+		if k, ok := sk.(*knapsack.Knapsack); ok {
+			legacyID = knapsack.GetKeyID(k.PrivateKey)
+		}
+		fmt.Fprintf(os.Stderr, "Private key %s\n\n", f.KeyFile)
 	} else {
-		fmt.Printf("%s\n", plaintext)
+		var elements []*big.Int
+		_, pk, err := loadPublicKey(f.KeyFile, "")
+		if errors.Is(err, knapsack.ErrVerifierKey) {
+			elements, _, err = loadVerifier(f.KeyFile)
+		} else if err == nil {
+			elements = pk.Elements()
+		}
+		if err != nil {
+			return err
+		}
+		fp, legacyID = knapsack.PublicKeyFingerprint(elements), knapsack.GetKeyID(elements)
+		fmt.Fprintf(os.Stderr, "Public key %s\n\n", f.KeyFile)
+	}
+
+	switch f.Format {
+	case "base32":
+		fmt.Println(fp.Base32())
+	case "randomart":
+		fmt.Print(fp.Randomart())
+	case "legacy":
+		fmt.Printf("%0x\n", legacyID)
+	default:
+		fmt.Println(fp)
+	}
+	return nil
+}
+
+type AttackCmd struct {
+	PublicKeyFile string `required type:"existingfile" name:"pubfile" short:"p" help:"Path of the merkle-hellman public key file to attack."`
+	OutFile       string `type:"path" default:"recovered_private.pack" name:"out" short:"o" help:"Output file to write the recovered private key."`
+	Force         bool   `name:"force" help:"Overwrite the output file if it exists."`
+}
+
+func (a *AttackCmd) Run() error {
+	pkfRaw, err := ioutil.ReadFile(a.PublicKeyFile)
+	if err != nil {
+		return err
+	}
+	if _, err := (knapsack.MerkleHellmanScheme{}).UnmarshalPublicKey(pkfRaw); err != nil {
+		return fmt.Errorf("invalid public key file %s: %w", a.PublicKeyFile, err)
+	}
+	pkf := &knapsack.PublicKeyFile{}
+	if err := msgpack.Unmarshal(pkfRaw, pkf); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Attacking public key %s...\n\n", knapsack.PublicKeyFingerprint(knapsack.UnpackPublic(pkf)))
+
+	k, err := knapsack.ShamirAttack(pkf)
+	if err != nil {
+		return err
 	}
+	_, skf, err := knapsack.Pack(*k)
+	if err != nil {
+		return err
+	}
+	err = writeKeyFile(a.OutFile, skf, a.Force)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Successfully recovered a private key and saved to %s\n", a.OutFile)
 	return nil
 }
 
@@ -159,14 +516,107 @@ var cli struct {
 	New     NewCmd     `cmd help:"Create a new Knapsack"`
 	Encrypt EncryptCmd `cmd help:"Encrypt stdin (default), text, or files using a public key"`
 	Decrypt DecryptCmd `cmd help:"Decrypt stdin (default), text, or files using a private key"`
+	Pubkey  PubkeyCmd  `cmd help:"Recreate a public key file from a private key file"`
+	Sign    SignCmd    `cmd help:"Sign stdin (default), text, or files using a signing key"`
+	Verify  VerifyCmd  `cmd help:"Verify a signature of stdin (default), text, or files using a public key"`
+
+	Fingerprint FingerprintCmd `cmd help:"Show the fingerprint of a public or private key file"`
+	Attack      AttackCmd      `cmd help:"Recover a private key from a basic merkle-hellman public key (Shamir's attack)"`
 }
 
 func main() {
-	ctx := kong.Parse(&cli, kong.Name("knapsack"))
+	ctx := kong.Parse(&cli, kong.Name("knapsack"), kong.Vars{"schemes": strings.Join(knapsack.SchemeNames(), ", ")})
 	err := ctx.Run()
 	ctx.FatalIfErrorf(err)
 }
 
+// loadPublicKey reads and validates a public key file for the named scheme,
+// or for whichever scheme it's for if the name is empty
+func loadPublicKey(path, name string) (knapsack.Cryptosystem, knapsack.PublicKey, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var scheme knapsack.Cryptosystem
+	var pk knapsack.PublicKey
+	if name == "" {
+		scheme, pk, err = knapsack.UnmarshalPublicKey(raw)
+	} else {
+		if scheme, err = knapsack.LookupScheme(name); err != nil {
+			return nil, nil, err
+		}
+		pk, err = scheme.UnmarshalPublicKey(raw)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid public key file %s: %w", path, err)
+	}
+	return scheme, pk, nil
+}
+
+// loadVerifier reads the public key and modulus from a signing key's public
+// key file (see knapsack.PackVerifier)
+func loadVerifier(path string) ([]*big.Int, *big.Int, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	pkf := &knapsack.PublicKeyFile{}
+	if err := msgpack.Unmarshal(raw, pkf); err != nil {
+		return nil, nil, err
+	}
+	pk, m, err := knapsack.UnpackVerifier(pkf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return pk, m, nil
+}
+
+// loadPrivateKey reads, unpacks and validates a private key file for the
+// named scheme, or for whichever scheme it's for if the name is empty
+func loadPrivateKey(path, name string) (knapsack.Cryptosystem, knapsack.PrivateKey, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var scheme knapsack.Cryptosystem
+	var sk knapsack.PrivateKey
+	if name == "" {
+		scheme, sk, err = knapsack.UnmarshalPrivateKey(raw)
+	} else {
+		if scheme, err = knapsack.LookupScheme(name); err != nil {
+			return nil, nil, err
+		}
+		sk, err = scheme.UnmarshalPrivateKey(raw)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid private key file %s: %w", path, err)
+	}
+	return scheme, sk, nil
+}
+
+// loadSigningKey reads and validates a signing key file (see
+// knapsack.PackSigningKey). Other key files give knapsack.ErrWrongScheme.
+func loadSigningKey(path string) (*knapsack.SigningKey, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sk, err := knapsack.UnmarshalSigningKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key file %s: %w", path, err)
+	}
+	return sk, nil
+}
+
+// privateFingerprint is the fingerprint shown for a private key: its own for
+// Merkle-Hellman keys, and its public key's for the other schemes
+func privateFingerprint(sk knapsack.PrivateKey) knapsack.Fingerprint {
+	if k, ok := sk.(*knapsack.Knapsack); ok {
+		return k.Fingerprint()
+	}
+	return knapsack.PublicKeyFingerprint(sk.Public().Elements())
+}
+
 func getInputBytes(cmd InputCmd) ([]byte, error) {
 	if cmd.getText() != "" {
 		return []byte(cmd.getText()), nil
@@ -178,3 +628,111 @@ func getInputBytes(cmd InputCmd) ([]byte, error) {
 	fmt.Fprintf(os.Stderr, "Reading input from stdin...\n\n")
 	return ioutil.ReadAll(os.Stdin)
 }
+
+// openInput opens the input of an encrypt or decrypt command for streaming
+func openInput(cmd InputCmd) (io.ReadCloser, error) {
+	if cmd.getText() != "" {
+		return ioutil.NopCloser(strings.NewReader(cmd.getText())), nil
+	}
+	if cmd.getInFile() != "" {
+		return os.Open(cmd.getInFile())
+	}
+	// default to stdin
+	fmt.Fprintf(os.Stderr, "Reading input from stdin...\n\n")
+	return ioutil.NopCloser(os.Stdin), nil
+}
+
+// writeKeyFile writes a key file, refusing to replace an existing file (which
+// may well be a key) unless `force` is set
+func writeKeyFile(path string, data []byte, force bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s already exists; pass --force to overwrite it", path)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// output is where encrypt and decrypt stream their results: a file if one was
+// given, otherwise stdout
+type output struct {
+	io.Writer
+	file *os.File
+}
+
+func openOutput(path string) (*output, error) {
+	if path == "" {
+		return &output{Writer: os.Stdout}, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &output{Writer: f, file: f}, nil
+}
+
+// finish ends stdout output with a newline, or closes the output file
+func (o *output) finish() error {
+	if o.file == nil {
+		_, err := fmt.Println()
+		return err
+	}
+	return o.file.Close()
+}
+
+// abort removes a partly written output file
+func (o *output) abort() {
+	if o.file != nil {
+		o.file.Close()
+		os.Remove(o.file.Name())
+	}
+}
+
+// skipSpace drops whitespace (such as a trailing newline) from hex input
+type skipSpace struct {
+	r io.Reader
+}
+
+func (s skipSpace) Read(p []byte) (int, error) {
+	for {
+		n, err := s.r.Read(p)
+		kept := 0
+		for _, b := range p[:n] {
+			if !unicode.IsSpace(rune(b)) {
+				p[kept] = b
+				kept++
+			}
+		}
+		if kept > 0 || err != nil {
+			return kept, err
+		}
+	}
+}
+
+// describeDecryptError explains the typed errors from knapsack decryption
+func describeDecryptError(err error) error {
+	var decErr *knapsack.DecryptError
+	switch {
+	case errors.As(err, &decErr):
+		return fmt.Errorf("unable to decrypt block %d (output before it was already written); the ciphertext is corrupt or was encrypted for a different key: %w", decErr.Block, decErr.Err)
+	case errors.Is(err, knapsack.ErrInvalidPadding):
+		return fmt.Errorf("decrypted message is invalid; the ciphertext is corrupt or was encrypted for a different key: %w", err)
+	case errors.Is(err, knapsack.ErrAuthenticationFailed):
+		return fmt.Errorf("ciphertext was modified; output before the failing chunk was already written: %w", err)
+	case errors.Is(err, knapsack.ErrNotRecipient):
+		return fmt.Errorf("this private key isn't one of the ciphertext's recipients: %w", err)
+	case errors.Is(err, knapsack.ErrMalformedCiphertext):
+		return fmt.Errorf("input is not a knapsack ciphertext: %w", err)
+	}
+	return err
+}
@@ -0,0 +1,87 @@
+package knapsack
+
+import (
+	"bytes"
+	"math/big"
+)
+
+// maxDigitBits is the largest number of bits a compact knapsack element can
+// carry; digits are stored in a byte
+const maxDigitBits = 8
+
+// digitBits returns the number of message bits each element carries
+func (k *Knapsack) digitBits() int {
+	if k.DigitBits < 1 {
+		return 1
+	}
+	return k.DigitBits
+}
+
+// maxKnapsack returns the largest knapsack of seq with digits in
+// [0, 2^digitBits): (2^digitBits - 1) * sum(seq)
+func maxKnapsack(seq []*big.Int, digitBits int) *big.Int {
+	maxDigit := big.NewInt(int64(1)<<uint(digitBits) - 1)
+	return maxDigit.Mul(maxDigit, sum(seq))
+}
+
+// EncryptBytesCompact encrypts `messageBytes` with a compact knapsack key
+// (see KeygenOptions.DigitBits): each public key element is multiplied by a
+// `digitBits` bit digit of the message instead of a single bit, so each block
+// carries len(publicKey) * digitBits message bits. Like EncryptBytes, this is
+// deterministic.
+func EncryptBytesCompact(publicKey []*big.Int, digitBits int, messageBytes []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	e := NewEncryptor(&buf, publicKey)
+	e.Mode = ModeCompact
+	e.DigitBits = digitBits
+	if _, err := e.Write(messageBytes); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// returns a function grouping a block of bits into digits, most significant
+// bit first
+func compactMask(digitBits int) func([]byte) ([]byte, error) {
+	return func(bits []byte) ([]byte, error) {
+		digits := make([]byte, len(bits)/digitBits)
+		for i := range digits {
+			for _, bit := range bits[i*digitBits : (i+1)*digitBits] {
+				digits[i] = digits[i]<<1 | bit
+			}
+		}
+		return digits, nil
+	}
+}
+
+// returns the inverse of compactMask
+func compactUnmask(digitBits int) func([]byte) ([]byte, error) {
+	return func(digits []byte) ([]byte, error) {
+		bits := make([]byte, 0, len(digits)*digitBits)
+		for _, digit := range digits {
+			for shift := digitBits - 1; shift >= 0; shift-- {
+				bits = append(bits, digit>>uint(shift)&1)
+			}
+		}
+		return bits, nil
+	}
+}
+
+// greedily writes target as sum(digit_i * weights[i]) with every digit <= maxDigit.
+// like solveKnapsack, this relies on weights being superincreasing.
+func solveDigits(weights []*big.Int, target *big.Int, maxDigit int64) ([]byte, bool) {
+	digits := make([]byte, len(weights))
+	rem := new(big.Int).Set(target)
+	digit := new(big.Int)
+	for i := len(weights) - 1; i >= 0; i-- {
+		digit.DivMod(rem, weights[i], rem)
+		if digit.Cmp(big.NewInt(maxDigit)) > 0 {
+			return nil, false
+		}
+		digits[i] = byte(digit.Int64())
+	}
+	return digits, rem.Sign() == 0
+}
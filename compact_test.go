@@ -0,0 +1,186 @@
+package knapsack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+func TestCompactKeygen(t *testing.T) {
+	for digitBits := int64(1); digitBits <= maxDigitBits; digitBits++ {
+		k, err := NewKnapsackWithOptions(rand.Reader, CompactKeygenOptions(20, digitBits))
+		handleFatalError(err, t)
+		handleFatalError(k.Validate(), t)
+
+		maxDigit := big.NewInt(int64(1)<<uint(digitBits) - 1)
+		total := new(big.Int)
+		for idx, n := range k.PrivateKey {
+			if n.Cmp(new(big.Int).Mul(total, maxDigit)) <= 0 {
+				t.Fatalf("digit bits %d: element %d is too small", digitBits, idx)
+			}
+			total.Add(total, n)
+		}
+		if k.M.Cmp(total.Mul(total, maxDigit)) <= 0 {
+			t.Errorf("digit bits %d: modulus is too small", digitBits)
+		}
+	}
+
+	if _, err := NewKnapsackWithOptions(rand.Reader, KeygenOptions{Length: 10, Growth: 10, ModulusBits: 22, DigitBits: 2}); err == nil {
+		t.Error("wanted error for a modulus too small for 2 bit digits")
+	}
+	if _, err := NewKnapsackWithOptions(rand.Reader, CompactKeygenOptions(10, maxDigitBits+1)); err == nil {
+		t.Error("wanted error for too many digit bits")
+	}
+}
+
+func TestDecryptCompact(t *testing.T) {
+	for _, digitBits := range []int64{2, 3, 8} {
+		for _, length := range []int64{1, 5, 32} {
+			k, err := NewKnapsackWithOptions(rand.Reader, CompactKeygenOptions(length, digitBits))
+			handleFatalError(err, t)
+
+			for _, size := range []int{0, 1, 17, 300} {
+				msg := make([]byte, size)
+				_, err := rand.Read(msg)
+				handleFatalError(err, t)
+
+				ct, err := EncryptBytesCompact(k.PublicKey, int(digitBits), msg)
+				handleFatalError(err, t)
+				d, err := k.DecryptBytes(ct)
+				if err != nil {
+					t.Fatalf("digit bits %d, length %d, size %d: %v", digitBits, length, size, err)
+				}
+				if !bytes.Equal(d, msg) {
+					t.Errorf("digit bits %d, length %d, size %d: decrypted message differs", digitBits, length, size)
+				}
+			}
+		}
+	}
+}
+
+func TestCompactShrinksCiphertext(t *testing.T) {
+	msg := bytes.Repeat([]byte("compact"), 100)
+
+	k, err := NewKnapsackWithOptions(rand.Reader, CompactKeygenOptions(32, 4))
+	handleFatalError(err, t)
+	compact, err := EncryptBytesCompact(k.PublicKey, 4, msg)
+	handleFatalError(err, t)
+	textbook, err := EncryptBytes(k.PublicKey, msg)
+	handleFatalError(err, t)
+	if len(compact)*2 > len(textbook) {
+		t.Errorf("compact ciphertext is %d bytes, textbook is %d", len(compact), len(textbook))
+	}
+
+	// compact keys still decrypt textbook ciphertexts
+	d, err := k.DecryptBytes(textbook)
+	handleFatalError(err, t)
+	if !bytes.Equal(d, msg) {
+		t.Error("decrypted textbook message differs")
+	}
+}
+
+func TestDecryptCompactWrongDigitBits(t *testing.T) {
+	k, err := NewKnapsackWithOptions(rand.Reader, CompactKeygenOptions(16, 4))
+	handleFatalError(err, t)
+
+	ct, err := EncryptBytesCompact(k.PublicKey, 2, []byte("hello"))
+	handleFatalError(err, t)
+	if _, err := k.DecryptBytes(ct); !errors.Is(err, ErrMalformedCiphertext) {
+		t.Errorf("wanted ErrMalformedCiphertext, got %v", err)
+	}
+
+	// a single-bit key can't solve compact blocks
+	single, err := NewKnapsack(16)
+	handleFatalError(err, t)
+	ct, err = EncryptBytes(single.PublicKey, []byte("hello"))
+	handleFatalError(err, t)
+	ct[0] = formatCompact
+	if _, err := single.DecryptBytes(ct); !errors.Is(err, ErrMalformedCiphertext) {
+		t.Errorf("wanted ErrMalformedCiphertext, got %v", err)
+	}
+
+	if _, err := EncryptBytesCompact(k.PublicKey, 0, []byte("hello")); !errors.Is(err, ErrInvalidDigitBits) {
+		t.Errorf("wanted ErrInvalidDigitBits, got %v", err)
+	}
+}
+
+func TestPackUnpackCompact(t *testing.T) {
+	k, err := NewKnapsackWithOptions(rand.Reader, CompactKeygenOptions(16, 3))
+	handleFatalError(err, t)
+
+	pubKeyFile, privKeyFile, err := Pack(*k)
+	handleFatalError(err, t)
+	a := PublicKeyFile{}
+	b := PrivateKeyFile{}
+	handleFatalError(msgpack.Unmarshal(pubKeyFile, &a), t)
+	handleFatalError(msgpack.Unmarshal(privKeyFile, &b), t)
+	if a.DigitBits != 3 {
+		t.Errorf("public key file has digit bits %d", a.DigitBits)
+	}
+
+	kUnpacked, err := Unpack(&a, &b)
+	handleFatalError(err, t)
+	if equal, msg := equalKnapsacks(k, kUnpacked); !equal {
+		t.Error(msg)
+	}
+
+	// the public key file alone keeps the digit size too
+	pubKeyFile, err = PackPublic(kUnpacked.Public().(*KnapsackPublicKey))
+	handleFatalError(err, t)
+	a = PublicKeyFile{}
+	handleFatalError(msgpack.Unmarshal(pubKeyFile, &a), t)
+	if a.DigitBits != 3 {
+		t.Errorf("PackPublic wrote digit bits %d", a.DigitBits)
+	}
+}
+
+func TestCompactMask(t *testing.T) {
+	bits := []byte{1, 0, 1, 1, 0, 0, 1, 0, 1}
+	digits, err := compactMask(3)(bits)
+	handleFatalError(err, t)
+	if !bytes.Equal(digits, []byte{5, 4, 5}) {
+		t.Errorf("got digits %v", digits)
+	}
+	back, err := compactUnmask(3)(digits)
+	handleFatalError(err, t)
+	if !bytes.Equal(back, bits) {
+		t.Errorf("got bits %v", back)
+	}
+}
+
+func TestValidateCompact(t *testing.T) {
+	k, err := NewKnapsackWithOptions(rand.Reader, CompactKeygenOptions(8, 2))
+	handleFatalError(err, t)
+
+	// the same private key doesn't leave room for 8 bit digits
+	k.DigitBits = 8
+	if err := k.Validate(); !errors.Is(err, ErrNotSuperincreasing) && !errors.Is(err, ErrModulusTooSmall) {
+		t.Errorf("wanted the key rejected for 8 bit digits, got %v", err)
+	}
+	k.DigitBits = maxDigitBits + 1
+	if err := k.Validate(); !errors.Is(err, ErrInvalidDigitBits) {
+		t.Errorf("wanted ErrInvalidDigitBits, got %v", err)
+	}
+}
+
+func TestSolveDigits(t *testing.T) {
+	weights := intsToBigs([]int64{1, 3, 7, 15})
+	digits, ok := solveDigits(weights, intsToBigs([]int64{40})[0], 3)
+	if !ok {
+		t.Fatal("wanted a solution")
+	}
+	// 40 = 2*15 + 1*7 + 1*3 + 0*1
+	expected := []byte{0, 1, 1, 2}
+	for i, d := range expected {
+		if digits[i] != d {
+			t.Fatalf("wanted %v, got %v", expected, digits)
+		}
+	}
+	if _, ok := solveDigits(weights, intsToBigs([]int64{100})[0], 3); ok {
+		t.Error("wanted no solution when the top digit is too large")
+	}
+}
@@ -4,9 +4,44 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"errors"
+	"fmt"
+	"io"
 	"math/big"
 )
 
+var (
+	// ErrNoSolution means a ciphertext block is not a subset sum of the private key
+	ErrNoSolution = errors.New("ciphertext has no solution under this private key")
+	// ErrCiphertextMismatch means the bits recovered from a ciphertext block
+	// don't encrypt back to the same block
+	ErrCiphertextMismatch = errors.New("decrypted bits do not re-encrypt to the ciphertext")
+	// ErrInvalidPadding means the decrypted message doesn't end in valid padding
+	ErrInvalidPadding = errors.New("invalid padding")
+	// ErrMalformedCiphertext means the ciphertext couldn't be deserialized
+	ErrMalformedCiphertext = errors.New("malformed ciphertext")
+	// ErrAuthenticationFailed means a hybrid payload was modified or the
+	// symmetric key recovered from it is wrong
+	ErrAuthenticationFailed = errors.New("payload failed authentication")
+	// ErrNotRecipient means a multi-recipient ciphertext has no slot for the
+	// decrypting key
+	ErrNotRecipient = errors.New("ciphertext was not encrypted for this key")
+)
+
+// DecryptError reports the ciphertext block that failed to decrypt
+type DecryptError struct {
+	Block int
+	Err   error
+}
+
+func (e *DecryptError) Error() string {
+	return fmt.Sprintf("block %d: %v", e.Block, e.Err)
+}
+
+// Unwrap returns the underlying error (ErrNoSolution or ErrCiphertextMismatch)
+func (e *DecryptError) Unwrap() error {
+	return e.Err
+}
+
 // Knapsack contains the private data used to generate the public key and decrypt messages
 type Knapsack struct {
 	PublicKey  []*big.Int
@@ -14,64 +49,184 @@ type Knapsack struct {
 	M          *big.Int // modulus
 	W          *big.Int // random mutating constant
 	WI         *big.Int // inverse of w
+	Perm       []int    // PublicKey[i] is derived from PrivateKey[Perm[i]]; nil means no permutation
+	Iterations []Round  // further rounds applied after (M, W), for iterated Merkle-Hellman
+	DigitBits  int      // bits per element for compact knapsacks (see KeygenOptions); 0 means 1
+	// LowBits is the number of low bits of each private key element that form
+	// a superincreasing sequence, for Graham–Shamir keys; 0 otherwise
+	LowBits int
+	// Moduli holds the CRT modulus behind each private key element, for
+	// Goodman–McAuley keys; nil otherwise
+	Moduli []*big.Int
+}
+
+// Round is a single modular multiplication disguising a knapsack sequence:
+// each element n becomes n * W mod M
+type Round struct {
+	M  *big.Int // modulus, larger than the sum of the sequence it's applied to
+	W  *big.Int // random mutating constant
+	WI *big.Int // inverse of w
+}
+
+// apply returns the sequence with every element multiplied by W mod M
+func (r Round) apply(seq []*big.Int) []*big.Int {
+	out := make([]*big.Int, len(seq))
+	for idx, n := range seq {
+		nw := new(big.Int).Mul(n, r.W)
+		out[idx] = nw.Mod(nw, r.M)
+	}
+	return out
+}
+
+// rounds returns every (M, W) round of the Knapsack in the order they're applied
+func (k *Knapsack) rounds() []Round {
+	return append([]Round{{M: k.M, W: k.W, WI: k.WI}}, k.Iterations...)
 }
 
 // NewKnapsack auto generates private knapsack params
 func NewKnapsack(keyLength int64) (*Knapsack, error) {
-	if keyLength < 1 {
-		return nil, errors.New("key length must be > 0")
+	return NewKnapsackWithReader(rand.Reader, keyLength)
+}
+
+// NewKnapsackWithReader generates private knapsack params using randomness
+// read from `random`. Passing a deterministic reader (see NewSeededReader)
+// regenerates the same Knapsack every time.
+func NewKnapsackWithReader(random io.Reader, keyLength int64) (*Knapsack, error) {
+	return NewKnapsackWithOptions(random, DefaultKeygenOptions(keyLength))
+}
+
+// NewKnapsackWithOptions generates private knapsack params sized according to
+// `opts`, using randomness read from `random`
+func NewKnapsackWithOptions(random io.Reader, opts KeygenOptions) (*Knapsack, error) {
+	opts, err := opts.resolve()
+	if err != nil {
+		return nil, err
 	}
-	// start by generating a random superincreasing sequence
+	keyLength := opts.Length
+
+	// start by generating a random superincreasing sequence, or one of the
+	// variants' easy knapsacks
 	one := big.NewInt(1)
-	privateKey, err := randomSuperincreasingSequence(keyLength)
+	var privateKey, moduli []*big.Int
+	var lowBits int
+	switch opts.Variant {
+	case VariantGrahamShamir:
+		privateKey, lowBits, err = randomGrahamShamirSequence(random, keyLength, opts.Growth)
+	case VariantGoodmanMcAuley:
+		privateKey, moduli, err = randomGoodmanMcAuleySequence(random, keyLength, opts.Growth)
+	default:
+		privateKey, err = randomSuperincreasingSequence(random, keyLength, opts.Growth, opts.DigitBits)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the modulus should be in [ 2^(modulusBits - 1) + 1, 2^modulusBits - 1 ]
+	min := new(big.Int).Lsh(one, uint(opts.ModulusBits-1)) // 2^(modulusBits - 1)
+	max := new(big.Int).Lsh(one, uint(opts.ModulusBits))   // 2^modulusBits
+	min.Add(min, one)                                      // 2^(modulusBits - 1) + 1
+	max.Sub(max, one)                                      // 2^modulusBits - 1
+	m, err := randomUniform(random, min, max)
+	if err != nil {
+		return nil, err
+	}
+
+	w, wi, err := randomMultiplier(random, m)
 	if err != nil {
 		return nil, err
 	}
+	k := &Knapsack{
+		PrivateKey: privateKey,
+		M:          m,
+		W:          w,
+		WI:         wi,
+		LowBits:    lowBits,
+		Moduli:     moduli,
+	}
+	if opts.DigitBits > 1 {
+		k.DigitBits = int(opts.DigitBits)
+	}
 
-	// the modulus should be in [ 2^(length * 2 + 1) + 1, 2^(length * 2 + 2) - 1 ]
-	min := new(big.Int).Exp(big.NewInt(2), big.NewInt(keyLength*2+1), nil) // 2^(length * 2 + 1)
-	max := new(big.Int).Exp(big.NewInt(2), big.NewInt(keyLength*2+2), nil) // 2^(length * 2 + 2)
-	min.Add(min, one)                                                      // 2^(length * 2 + 1) + 1
-	max.Sub(max, one)                                                      // 2^(length * 2 + 2) - 1
-	m, err := randomUniform(min, max)
+	// iterated Merkle-Hellman: each further round needs a modulus larger than
+	// the largest knapsack of the sequence coming out of the previous round
+	seq := k.rounds()[0].apply(privateKey)
+	for round := int64(1); round < opts.Rounds; round++ {
+		bits := maxKnapsack(seq, k.digitBits()).BitLen()
+		min := new(big.Int).Lsh(one, uint(bits)) // 2^bits > sum
+		max := new(big.Int).Lsh(one, uint(bits+1))
+		min.Add(min, one)
+		max.Sub(max, one)
+		m, err := randomUniform(random, min, max)
+		if err != nil {
+			return nil, err
+		}
+		w, wi, err := randomMultiplier(random, m)
+		if err != nil {
+			return nil, err
+		}
+		r := Round{M: m, W: w, WI: wi}
+		k.Iterations = append(k.Iterations, r)
+		seq = r.apply(seq)
+	}
+
+	// shuffle the indexes so the public key doesn't leak the order of the
+	// superincreasing sequence
+	k.Perm, err = randomPermutation(random, keyLength)
 	if err != nil {
 		return nil, err
 	}
 
+	k.PublicKey = k.DerivePublicKey()
+	return k, nil
+}
+
+// returns a random w with an inverse mod m, and that inverse
+func randomMultiplier(random io.Reader, m *big.Int) (*big.Int, *big.Int, error) {
 	// w' should be in [ 2, m - 2 ]
-	min.SetInt64(2)
-	max = new(big.Int).Sub(m, min)
+	min := big.NewInt(2)
+	max := new(big.Int).Sub(m, min)
 
 	// goal of this loop: get a good `w` that has an inverse mod m
 	var w, wi *big.Int
 	for w == nil || wi == nil {
-		wPrime, err := randomUniform(min, max)
+		wPrime, err := randomUniform(random, min, max)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		// w = wPrime/gcd(wPrime, m); wi = inverse of w
 		w = new(big.Int).Div(wPrime, new(big.Int).GCD(nil, nil, wPrime, m))
 		wi = new(big.Int).ModInverse(w, m)
 	}
+	return w, wi, nil
+}
 
-	// calculate public key (for now, not doing index mangling)
-	publicKey := make([]*big.Int, len(privateKey))
-	for idx, n := range privateKey {
-		nw := new(big.Int).Mul(n, w)
-		publicKey[idx] = nw.Mod(nw, m)
+// DerivePublicKey recomputes the public key from the private parameters:
+// PublicKey[i] = PrivateKey[Perm[i]] * W mod M, followed by any further rounds
+func (k *Knapsack) DerivePublicKey() []*big.Int {
+	seq := k.PrivateKey
+	for _, r := range k.rounds() {
+		seq = r.apply(seq)
+	}
+	publicKey := make([]*big.Int, len(seq))
+	for idx := range publicKey {
+		publicKey[idx] = seq[k.privateIndex(idx)]
 	}
+	return publicKey
+}
 
-	return &Knapsack{
-		PublicKey:  publicKey,
-		PrivateKey: privateKey,
-		M:          m,
-		W:          w,
-		WI:         wi,
-	}, nil
+// privateIndex maps a public key index to the private key element behind it
+func (k *Knapsack) privateIndex(idx int) int {
+	if len(k.Perm) == 0 {
+		return idx
+	}
+	return k.Perm[idx]
 }
 
-// GetKeyID returns first 10 bytes of sha256(key)
+// GetKeyID returns first 10 bytes of sha256(key).
+// This is the legacy key ID: elements aren't length-prefixed, so different
+// keys can share an ID, and public and private keys aren't told apart. Use
+// PublicKeyFingerprint or Knapsack.Fingerprint to identify keys.
 func GetKeyID(key []*big.Int) []byte {
 	h := sha256.New()
 	for _, n := range key {
@@ -86,22 +241,30 @@ func EncryptString(publicKey []*big.Int, message string) ([]byte, error) {
 }
 
 // EncryptBytes encrypts `messageBytes` using `publicKey`.
+// The message bits are padded (see padBits) and split into blocks of
+// len(publicKey) bits; each block is encrypted separately and the
+// ciphertexts are serialized in order.
+// This is textbook (deterministic) encryption: the same message and key
+// always give the same ciphertext. See EncryptBytesRandomized.
 func EncryptBytes(publicKey []*big.Int, messageBytes []byte) ([]byte, error) {
-	ct, err := encrypt(publicKey, bytesToBits(messageBytes))
-	if err != nil {
-		return nil, err
-	}
-	return ct.Bytes(), nil
+	return encryptAll(publicKey, ModeTextbook, nil, messageBytes)
 }
 
-func encrypt(publicKey []*big.Int, messageBits []byte) (*big.Int, error) {
-	if len(publicKey) < len(messageBits) {
+// encrypt returns sum(publicKey[i] * digits[i]). Digits are bits, except for
+// compact knapsacks (see EncryptBytesCompact).
+func encrypt(publicKey []*big.Int, digits []byte) (*big.Int, error) {
+	if len(publicKey) < len(digits) {
 		return nil, errors.New("public key must be longer than messageBits")
 	}
 	ct := big.NewInt(0)
-	for idx, bit := range messageBits {
-		if bit == 1 {
+	term := new(big.Int)
+	for idx, digit := range digits {
+		switch digit {
+		case 0:
+		case 1:
 			ct.Add(ct, publicKey[idx])
+		default:
+			ct.Add(ct, term.Mul(publicKey[idx], big.NewInt(int64(digit))))
 		}
 	}
 	return ct, nil
@@ -109,20 +272,126 @@ func encrypt(publicKey []*big.Int, messageBits []byte) (*big.Int, error) {
 
 // Decrypt uses the private key to solve the knapsack problem and returns
 // the message reconstructed into bytes from the slice of bits.
-func (k *Knapsack) Decrypt(ct *big.Int) []byte {
-	// undo the mutation of `w`
-	c := new(big.Int).Mul(ct, k.WI)
-	c.Mod(c, k.M)
+// It operates on a single unpadded block; use DecryptBytes for the output
+// of EncryptBytes.
+func (k *Knapsack) Decrypt(ct *big.Int) ([]byte, error) {
+	bits, err := k.decryptBits(ct)
+	if err != nil {
+		return nil, &DecryptError{Block: 0, Err: err}
+	}
+	return bitsToBytes(bits), nil
+}
+
+// DecryptBytes decrypts the output of EncryptBytes, EncryptBytesRandomized,
+// EncryptBytesHybrid or EncryptBytesMulti, telling them apart by the first byte
+// of the ciphertext.
+// The exact message that was encrypted is returned. See NewDecryptor to
+// decrypt without holding the whole ciphertext in memory.
+func (k *Knapsack) DecryptBytes(ct []byte) ([]byte, error) {
+	return decryptAll(k, ct)
+}
+
+// returns the bits of a single block in public key order
+func (k *Knapsack) decryptBits(ct *big.Int) ([]byte, error) {
+	digits, err := k.decryptDigits(ct)
+	if err != nil {
+		return nil, err
+	}
+	// a compact key can solve for bigger digits than a block of bits has
+	for _, digit := range digits {
+		if digit > 1 {
+			return nil, ErrNoSolution
+		}
+	}
+	return digits, nil
+}
+
+// returns the digits of a single block in public key order. for keys with one
+// bit per element, these are the block's bits.
+func (k *Knapsack) decryptDigits(ct *big.Int) ([]byte, error) {
+	// undo the mutations of each `w`, last round first
+	rounds := k.rounds()
+	c := new(big.Int).Set(ct)
+	for i := len(rounds) - 1; i >= 0; i-- {
+		c.Mul(c, rounds[i].WI)
+		c.Mod(c, rounds[i].M)
+	}
 	// solve the knapsack problem with weights=privateKey, target=c
-	msg := solveKnapsack(k.PrivateKey, c)
-	return bitsToBytes(msg)
+	var solution []byte
+	if k.Variant() != VariantMerkleHellman {
+		var err error
+		if solution, err = k.solveVariant(c); err != nil {
+			return nil, err
+		}
+	} else if k.digitBits() > 1 {
+		var ok bool
+		if solution, ok = solveDigits(k.PrivateKey, c, int64(1)<<uint(k.digitBits())-1); !ok {
+			return nil, ErrNoSolution
+		}
+	} else {
+		var err error
+		if solution, err = solveKnapsack(k.PrivateKey, c); err != nil {
+			return nil, err
+		}
+	}
+	bits := k.unpermute(solution)
+	// the solve only guarantees a match mod M; make sure the bits really
+	// encrypt to the same block
+	reencrypted, err := k.reencrypt(bits)
+	if err != nil {
+		return nil, err
+	}
+	if reencrypted.Cmp(ct) != 0 {
+		return nil, ErrCiphertextMismatch
+	}
+	return bits, nil
 }
 
-// DecryptBytes constructs the ciphertext int from the bytes
-// and uses the private key to solve the knapsack problem.
-// The message is reconstructed into bytes from the slice of bits.
-func (k *Knapsack) DecryptBytes(ct []byte) []byte {
-	return k.Decrypt(new(big.Int).SetBytes(ct))
+// reencrypt computes the ciphertext of bits (in public key order), deriving
+// the public key from the private parameters if it wasn't loaded
+func (k *Knapsack) reencrypt(bits []byte) (*big.Int, error) {
+	publicKey := k.PublicKey
+	if publicKey == nil {
+		publicKey = k.DerivePublicKey()
+	}
+	return encrypt(publicKey, bits)
+}
+
+// unpermute puts bits solved against the private key back into public key order.
+// Keys without a permutation (generated before index mangling) are returned as is.
+func (k *Knapsack) unpermute(bits []byte) []byte {
+	if len(k.Perm) == 0 {
+		return bits
+	}
+	out := make([]byte, len(bits))
+	for idx, privIdx := range k.Perm {
+		out[idx] = bits[privIdx]
+	}
+	return out
+}
+
+// padBits appends a single 1 bit followed by as many 0 bits as needed to make
+// the length a multiple of blockLen. A full block of padding is added when the
+// bits already fill their last block, so the padding can always be removed
+// unambiguously (even if the message itself ends in zero bits).
+func padBits(bits []byte, blockLen int) []byte {
+	padLen := blockLen - len(bits)%blockLen
+	padded := make([]byte, len(bits)+padLen)
+	copy(padded, bits)
+	padded[len(bits)] = 1
+	return padded
+}
+
+// unpadBits removes the padding added by padBits
+func unpadBits(bits []byte) ([]byte, error) {
+	end := len(bits) - 1
+	for end >= 0 && bits[end] == 0 {
+		end--
+	}
+	if end < 0 || end%8 != 0 {
+		return nil, ErrInvalidPadding
+	}
+	return bits[:end], nil
 }
 
 // returns a slice of [x0, x1, ..] where xi is 0 or 1.
@@ -164,18 +433,18 @@ func bitsToBytes(bs []byte) []byte {
 }
 
 // returns the mask (e.g. [0, 1, 1, 0]) of the weights to choose to reach target
-// this function assumes:
-//   a) the private key is a superincreasing sequence
-//   b) a solution exists (at least for now...may add failure cases later)
-func solveKnapsack(weights []*big.Int, s *big.Int) []byte {
+// this function assumes the private key is a superincreasing sequence, and
+// returns ErrNoSolution if the greedy solve leaves a remainder
+func solveKnapsack(weights []*big.Int, s *big.Int) ([]byte, error) {
 	zero := big.NewInt(0)
 	solution := make([]byte, len(weights))
 	solutionIdx := len(weights) - 1
 
-	var solve func([]*big.Int, *big.Int, *big.Int)
-	solve = func(remainingWeights []*big.Int, sumOfRemainingWeights *big.Int, target *big.Int) {
+	// returns whatever is left of the target once the weights run out
+	var solve func([]*big.Int, *big.Int, *big.Int) *big.Int
+	solve = func(remainingWeights []*big.Int, sumOfRemainingWeights *big.Int, target *big.Int) *big.Int {
 		if len(remainingWeights) == 0 || target.Cmp(zero) == 0 {
-			return
+			return target
 		}
 		last := remainingWeights[len(remainingWeights)-1]
 		weightsWithoutLast := remainingWeights[:len(remainingWeights)-1]
@@ -184,15 +453,16 @@ func solveKnapsack(weights []*big.Int, s *big.Int) []byte {
 		if target.Cmp(sumWithoutLast) > 0 {
 			solution[solutionIdx] = 1
 			solutionIdx--
-			solve(weightsWithoutLast, sumWithoutLast, target.Sub(target, last))
-		} else {
-			solution[solutionIdx] = 0
-			solutionIdx--
-			solve(weightsWithoutLast, sumWithoutLast, target)
+			return solve(weightsWithoutLast, sumWithoutLast, target.Sub(target, last))
 		}
+		solution[solutionIdx] = 0
+		solutionIdx--
+		return solve(weightsWithoutLast, sumWithoutLast, target)
 	}
-	solve(weights, sum(weights), s)
-	return solution
+	if remainder := solve(weights, sum(weights), new(big.Int).Set(s)); remainder.Cmp(zero) != 0 {
+		return nil, ErrNoSolution
+	}
+	return solution, nil
 }
 
 // reduces the array with summation fn
@@ -204,32 +474,87 @@ func sum(arr []*big.Int) *big.Int {
 	return sum
 }
 
-func randomUniform(min, max *big.Int) (*big.Int, error) {
-	n, err := rand.Int(rand.Reader, new(big.Int).Sub(max, min))
+// returns a uniformly random n in [0, max) by rejection sampling.
+// this is what crypto/rand.Int does, but keeping our own copy means the
+// bytes consumed from `random` (and so seeded keys) can't change with Go versions.
+func randomInt(random io.Reader, max *big.Int) (*big.Int, error) {
+	if max.Sign() <= 0 {
+		return nil, errors.New("random range must be > 0")
+	}
+	bitLen := new(big.Int).Sub(max, big.NewInt(1)).BitLen()
+	buf := make([]byte, (bitLen+7)/8)
+	// mask off the bits above bitLen in the most significant byte
+	topBits := uint(bitLen % 8)
+	if topBits == 0 {
+		topBits = 8
+	}
+	n := new(big.Int)
+	for {
+		if _, err := io.ReadFull(random, buf); err != nil {
+			return nil, err
+		}
+		if len(buf) > 0 {
+			buf[0] &= byte(int(1<<topBits) - 1)
+		}
+		if n.SetBytes(buf).Cmp(max) < 0 {
+			return n, nil
+		}
+	}
+}
+
+// returns a uniformly random n in [min, max)
+func randomUniform(random io.Reader, min, max *big.Int) (*big.Int, error) {
+	n, err := randomInt(random, new(big.Int).Sub(max, min))
 	if err != nil {
 		return nil, err
 	}
 	return n.Add(n, min), nil
 }
 
-func randomSuperincreasingSequence(length int64) ([]*big.Int, error) {
+// returns a uniformly random permutation of [0, length) (Fisher-Yates)
+func randomPermutation(random io.Reader, length int64) ([]int, error) {
+	perm := make([]int, length)
+	for i := range perm {
+		perm[i] = i
+	}
+	for i := len(perm) - 1; i > 0; i-- {
+		j, err := randomInt(random, big.NewInt(int64(i+1)))
+		if err != nil {
+			return nil, err
+		}
+		perm[i], perm[j.Int64()] = perm[j.Int64()], perm[i]
+	}
+	return perm, nil
+}
+
+func randomSuperincreasingSequence(random io.Reader, length, growth, digitBits int64) ([]*big.Int, error) {
 	// choose random numbers in the range:
-	// [ (2^(i-1) - 1) * 2^length + 1, 2^(i-1) * 2^length ]
+	// [ (2^(i-1) - 1) * 2^growth + 1, 2^(i-1) * 2^growth ]
 	// the above assumes 1-indexed arrays; our arrays are 0-indexed,
 	// so s/i-1/i/. rand.Int is exclusive, so we need add 1 to the max:
-	// [ (2^i - 1) * 2^length + 1, 2^i * 2^length + 1 ]
+	// [ (2^i - 1) * 2^growth + 1, 2^i * 2^growth + 1 ]
+	// compact knapsacks use base 2^digitBits instead of 2, so each element is
+	// larger than (2^digitBits - 1) times the sum of the ones before it.
 	one := big.NewInt(1)
-	twoLen := new(big.Int).Exp(big.NewInt(2), big.NewInt(length), nil) // 2^length
-	multiplier := new(big.Int).Add(twoLen, one)                        // 2^length + 1
+	twoGrowth := new(big.Int).Lsh(one, uint(growth)) // 2^growth
+	multiplier := new(big.Int).Add(twoGrowth, one)   // 2^growth + 1
+	if digitBits < 1 {
+		digitBits = 1
+	}
 
 	out := make([]*big.Int, length)
 	for i := range out {
-		max := new(big.Int).Exp(big.NewInt(2), big.NewInt(int64(i)), nil) // 2^i
-		min := new(big.Int).Sub(max, one)                                 // 2^i - 1
-		min.Mul(min, multiplier)                                          // 2^i - 1 * 2^length
-		max.Mul(max, multiplier)                                          // 2^i * 2^length
+		max := new(big.Int).Lsh(one, uint(int64(i)*digitBits)) // 2^i (or 2^(i * digitBits))
+		min := new(big.Int).Sub(max, one)                      // 2^i - 1
+		min.Mul(min, multiplier)                               // 2^i - 1 * 2^growth
+		max.Mul(max, multiplier)                               // 2^i * 2^growth
 
-		n, err := randomUniform(min, max)
+		n, err := randomUniform(random, min, max)
+		// the first range starts at 0, which can't be an element; redraw
+		// rather than shift the range so seeded keys don't change
+		for err == nil && n.Sign() == 0 {
+			n, err = randomUniform(random, min, max)
+		}
 		if err != nil {
 			return nil, err
 		}
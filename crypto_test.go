@@ -2,6 +2,8 @@ package knapsack
 
 import (
 	"bytes"
+	"crypto/rand"
+	"errors"
 	"math/big"
 	"testing"
 )
@@ -39,17 +41,180 @@ func TestDecrypt(t *testing.T) {
 	t.Logf("Public key bit-length: %v\n", pubBitLen)
 	t.Logf("Private key bit-length: %v\n", privBitLen)
 
-	// knapsack is len 100, "hello world" is 88 bits (11 bytes * 8)
-	// so using HasPrefix instead of Equals to account for the padding
-	if d := k.DecryptBytes(ct); !bytes.HasPrefix(d, []byte(msg)) {
+	d, err := k.DecryptBytes(ct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(d, []byte(msg)) {
+		t.Errorf("wanted %v, got %v", msg, d)
+	}
+}
+
+func TestDecryptMultipleBlocks(t *testing.T) {
+	k, err := NewKnapsack(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 384 bits plus padding fit in 4 blocks of 100 bits
+	msg := []byte("0123456789ab0123456789ab0123456789ab0123456789ab")
+	ct, err := EncryptBytes(k.PublicKey, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := unpackCiphertext(formatBlocks, ct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 4 {
+		t.Errorf("wanted 4 blocks, got %d", len(blocks))
+	}
+
+	d, err := k.DecryptBytes(ct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(d, msg) {
 		t.Errorf("wanted %v, got %v", msg, d)
 	}
 }
 
+func TestDecryptExactLength(t *testing.T) {
+	msgs := [][]byte{
+		{},
+		[]byte("hello"),
+		{0x68, 0x00, 0x00},
+		{0x00},
+	}
+	// key lengths that aren't multiples of 8 shouldn't lose any bits
+	for _, keyLength := range []int64{1, 7, 13, 100} {
+		k, err := NewKnapsack(keyLength)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, msg := range msgs {
+			ct, err := EncryptBytes(k.PublicKey, msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := k.DecryptBytes(ct)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(d, msg) {
+				t.Errorf("key length %d: wanted %v, got %v", keyLength, msg, d)
+			}
+		}
+	}
+}
+
+func TestPadBits(t *testing.T) {
+	type testCase struct {
+		bits     []byte
+		blockLen int
+		expected []byte
+	}
+	testCases := []testCase{
+		{bits: []byte{0, 1, 1}, blockLen: 5, expected: []byte{0, 1, 1, 1, 0}},
+		{bits: []byte{0, 1, 1, 0}, blockLen: 5, expected: []byte{0, 1, 1, 0, 1}},
+		{bits: []byte{0, 1, 1, 0, 0}, blockLen: 5, expected: []byte{0, 1, 1, 0, 0, 1, 0, 0, 0, 0}},
+		{bits: []byte{}, blockLen: 3, expected: []byte{1, 0, 0}},
+	}
+
+	for idx, tc := range testCases {
+		actual := padBits(tc.bits, tc.blockLen)
+		if !bytes.Equal(actual, tc.expected) {
+			t.Errorf("for test case #%d: wanted %v, got %v", idx, tc.expected, actual)
+		}
+	}
+}
+
+func TestUnpadBitsInvalid(t *testing.T) {
+	invalid := [][]byte{
+		{},
+		{0, 0, 0},
+		{0, 1, 1, 0, 1, 0, 0},
+	}
+	for idx, bits := range invalid {
+		if _, err := unpadBits(bits); err == nil {
+			t.Errorf("for test case #%d: wanted error, got nil", idx)
+		}
+	}
+}
+
+func TestDecryptUnpermutedKey(t *testing.T) {
+	k, err := NewKnapsack(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// keys generated before index mangling have no permutation
+	k.Perm = nil
+	for idx, n := range k.PrivateKey {
+		nw := new(big.Int).Mul(n, k.W)
+		k.PublicKey[idx] = nw.Mod(nw, k.M)
+	}
+
+	msg := "hello world"
+	ct, err := EncryptString(k.PublicKey, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := k.DecryptBytes(ct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(d, []byte(msg)) {
+		t.Errorf("wanted %v, got %v", msg, d)
+	}
+}
+
+func TestDerivePublicKey(t *testing.T) {
+	k, err := NewKnapsack(50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	derived := k.DerivePublicKey()
+	for i, n := range k.PublicKey {
+		if derived[i].Cmp(n) != 0 {
+			t.Fatalf("element %d: wanted %v, got %v", i, n, derived[i])
+		}
+	}
+}
+
+func TestRandomPermutation(t *testing.T) {
+	perm, err := randomPermutation(rand.Reader, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make([]bool, len(perm))
+	for _, idx := range perm {
+		if idx < 0 || idx >= len(perm) || seen[idx] {
+			t.Fatalf("not a permutation: %v", perm)
+		}
+		seen[idx] = true
+	}
+}
+
+func TestRandomInt(t *testing.T) {
+	for _, max := range []int64{1, 2, 255, 256, 257, 1000} {
+		for i := 0; i < 100; i++ {
+			n, err := randomInt(rand.Reader, big.NewInt(max))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n.Sign() < 0 || n.Cmp(big.NewInt(max)) >= 0 {
+				t.Fatalf("wanted n in [0, %d), got %v", max, n)
+			}
+		}
+	}
+}
+
 func TestEncryptString(t *testing.T) {
 	msg := "h" // 01101000
 	pk := intsToBigs([]int64{1, 2, 3, 4, 5, 6, 7, 8})
-	expected := big.NewInt(10).Bytes() // 2 + 3 + 5 = 10
+	// 2 + 3 + 5 = 10, then a block of padding: 10000000
+	expected := packCiphertext(formatBlocks, []*big.Int{big.NewInt(10), big.NewInt(1)})
 	actual, err := EncryptString(pk, msg)
 	if err != nil {
 		t.Fatal(err)
@@ -89,13 +254,61 @@ func TestSolveKnapsack(t *testing.T) {
 	}
 
 	for idx, tc := range testCases {
-		actual := solveKnapsack(tc.weights, tc.s)
+		actual, err := solveKnapsack(tc.weights, tc.s)
+		if err != nil {
+			t.Errorf("for test case #%d: %v", idx, err)
+		}
 		if !bytes.Equal(actual, tc.expected) {
 			t.Errorf("for test case #%d: wanted %v, got %v", idx, tc.expected, actual)
 		}
 	}
 }
 
+func TestSolveKnapsackNoSolution(t *testing.T) {
+	weights := intsToBigs([]int64{5, 10, 17, 33, 70})
+	for _, s := range []int64{4, 31, 136, 200} {
+		if _, err := solveKnapsack(weights, big.NewInt(s)); err != ErrNoSolution {
+			t.Errorf("for target %d: wanted ErrNoSolution, got %v", s, err)
+		}
+	}
+}
+
+func TestDecryptInvalidCiphertext(t *testing.T) {
+	k, err := NewKnapsack(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewKnapsack(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct, err := EncryptString(other.PublicKey, "hello world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = k.DecryptBytes(ct)
+	var decErr *DecryptError
+	if !errors.As(err, &decErr) {
+		t.Fatalf("wanted DecryptError, got %v", err)
+	}
+	if !errors.Is(err, ErrNoSolution) && !errors.Is(err, ErrCiphertextMismatch) {
+		t.Errorf("wanted ErrNoSolution or ErrCiphertextMismatch, got %v", err)
+	}
+
+	// adding M keeps the block congruent, so only re-encryption catches it
+	blocks := []*big.Int{new(big.Int).Add(k.PublicKey[0], k.M)}
+	_, err = k.DecryptBytes(packCiphertext(formatBlocks, blocks))
+	if !errors.Is(err, ErrCiphertextMismatch) {
+		t.Errorf("wanted ErrCiphertextMismatch, got %v", err)
+	}
+
+	_, err = k.DecryptBytes([]byte{formatBlocks, 0x05})
+	if !errors.Is(err, ErrMalformedCiphertext) {
+		t.Errorf("wanted ErrMalformedCiphertext, got %v", err)
+	}
+}
+
 func intsToBigs(ints []int64) []*big.Int {
 	out := make([]*big.Int, len(ints))
 	for i, n := range ints {
@@ -0,0 +1,361 @@
+package knapsack
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"strings"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+var (
+	// ErrUnknownScheme means no Cryptosystem is registered under a name
+	ErrUnknownScheme = errors.New("unknown scheme")
+	// ErrWrongScheme means a key (or key file) belongs to a different
+	// Cryptosystem than the one it was given to
+	ErrWrongScheme = errors.New("key is for a different scheme")
+)
+
+// Cryptosystem is a public key encryption scheme. Every scheme in this package
+// has one, registered under its Name (see Schemes), so tools can work with any
+// of them without knowing which it is.
+type Cryptosystem interface {
+	// Name is what the scheme is registered and looked up by
+	Name() string
+	// GenerateKey makes a new key with the scheme's default parameters for
+	// `length` message bits per block, using randomness read from `random`.
+	// Schemes whose blocks have a fixed size ignore `length`.
+	GenerateKey(random io.Reader, length int64) (PrivateKey, error)
+
+	// Encrypt encrypts `message` for `publicKey` in the scheme's default
+	// mode. `random` is used for randomized modes; nil means crypto/rand.
+	Encrypt(random io.Reader, publicKey PublicKey, message []byte) ([]byte, error)
+	// Decrypt decrypts anything the scheme's Encryptors write for the key
+	Decrypt(privateKey PrivateKey, ct []byte) ([]byte, error)
+	// NewEncryptor returns an Encryptor writing ciphertext for `recipients` to
+	// `w`. It fails if the scheme doesn't support `opts` or several recipients.
+	NewEncryptor(w io.Writer, recipients []PublicKey, opts EncryptOptions) (*Encryptor, error)
+	// NewDecryptor returns a Decryptor reading ciphertext from `r`
+	NewDecryptor(r io.Reader, privateKey PrivateKey) (*Decryptor, error)
+
+	// MarshalPublicKey serializes a public key file suitable for sharing
+	MarshalPublicKey(publicKey PublicKey) ([]byte, error)
+	// MarshalPrivateKey serializes a private key file
+	MarshalPrivateKey(privateKey PrivateKey) ([]byte, error)
+	// UnmarshalPublicKey deserializes and validates a public key file. It
+	// fails with ErrWrongScheme if the file is for another scheme.
+	UnmarshalPublicKey(b []byte) (PublicKey, error)
+	// UnmarshalPrivateKey deserializes and validates a private key file,
+	// recomputing the public key. It fails with ErrWrongScheme if the file is
+	// for another scheme.
+	UnmarshalPrivateKey(b []byte) (PrivateKey, error)
+}
+
+// PublicKey is a public key of any Cryptosystem
+type PublicKey interface {
+	// Elements returns the numbers making up the key, which is what its
+	// fingerprint is taken of (see PublicKeyFingerprint)
+	Elements() []*big.Int
+}
+
+// PrivateKey is a private key of any Cryptosystem
+type PrivateKey interface {
+	// Public returns the matching public key
+	Public() PublicKey
+}
+
+// EncryptOptions are the choices of how to encrypt that not every scheme
+// supports. The zero value asks for randomized encryption; schemes that can
+// only encrypt deterministically refuse it rather than quietly dropping the
+// randomness, so Textbook has to be set for them.
+type EncryptOptions struct {
+	// Hybrid encrypts with a random AES-GCM key and only encrypts that key
+	// with the public key (see EncryptBytesHybrid)
+	Hybrid bool
+	// Textbook encrypts the message itself, deterministically (see
+	// EncryptBytes)
+	Textbook bool
+	// Randomized encrypts the message itself with randomized padding (see
+	// EncryptBytesRandomized)
+	Randomized bool
+}
+
+var schemes []Cryptosystem
+
+func init() {
+	RegisterScheme(MerkleHellmanScheme{})
+	RegisterScheme(NaccacheSternScheme{})
+	RegisterScheme(ChorRivestScheme{})
+	RegisterScheme(LPSScheme{})
+	RegisterScheme(OTUScheme{})
+}
+
+// RegisterScheme makes a Cryptosystem available through LookupScheme and
+// Schemes. It panics if the name is already taken.
+func RegisterScheme(cs Cryptosystem) {
+	if _, err := LookupScheme(cs.Name()); err == nil {
+		panic("knapsack: scheme " + cs.Name() + " registered twice")
+	}
+	schemes = append(schemes, cs)
+}
+
+// LookupScheme returns the Cryptosystem registered as `name`
+func LookupScheme(name string) (Cryptosystem, error) {
+	for _, cs := range schemes {
+		if cs.Name() == name {
+			return cs, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q; known schemes are %s", ErrUnknownScheme, name, strings.Join(SchemeNames(), ", "))
+}
+
+// Schemes returns every registered Cryptosystem, Merkle-Hellman first
+func Schemes() []Cryptosystem {
+	return append([]Cryptosystem(nil), schemes...)
+}
+
+// SchemeNames returns the names of every registered Cryptosystem
+func SchemeNames() []string {
+	names := make([]string, len(schemes))
+	for i, cs := range schemes {
+		names[i] = cs.Name()
+	}
+	return names
+}
+
+// UnmarshalPublicKey deserializes a public key file of any registered scheme
+// and returns the scheme it's for
+func UnmarshalPublicKey(b []byte) (Cryptosystem, PublicKey, error) {
+	for _, cs := range schemes {
+		pk, err := cs.UnmarshalPublicKey(b)
+		if errors.Is(err, ErrWrongScheme) {
+			continue
+		}
+		return cs, pk, err
+	}
+	return nil, nil, fmt.Errorf("%w: not a public key file of a known scheme", ErrUnknownScheme)
+}
+
+// UnmarshalPrivateKey deserializes a private key file of any registered scheme
+// and returns the scheme it's for
+func UnmarshalPrivateKey(b []byte) (Cryptosystem, PrivateKey, error) {
+	for _, cs := range schemes {
+		k, err := cs.UnmarshalPrivateKey(b)
+		if errors.Is(err, ErrWrongScheme) {
+			continue
+		}
+		return cs, k, err
+	}
+	return nil, nil, fmt.Errorf("%w: not a private key file of a known scheme", ErrUnknownScheme)
+}
+
+// checkKeyFields tells the schemes' key files apart, since they don't say which
+// scheme they're for: it fails with ErrWrongScheme unless the packed file has
+// all the `required` fields and no others but `optional` ones
+func checkKeyFields(b []byte, required []string, optional ...string) error {
+	var fields map[string]interface{}
+	if err := msgpack.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	for _, name := range required {
+		if _, ok := fields[name]; !ok {
+			return ErrWrongScheme
+		}
+	}
+	known := len(required)
+	for _, name := range optional {
+		if _, ok := fields[name]; ok {
+			known++
+		}
+	}
+	if known != len(fields) {
+		return ErrWrongScheme
+	}
+	return nil
+}
+
+// runs `message` through a scheme's Encryptor
+func encryptWith(cs Cryptosystem, random io.Reader, publicKey PublicKey, message []byte, opts EncryptOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	e, err := cs.NewEncryptor(&buf, []PublicKey{publicKey}, opts)
+	if err != nil {
+		return nil, err
+	}
+	if random != nil {
+		e.Rand = random
+	}
+	if _, err := e.Write(message); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// runs `ct` through a scheme's Decryptor
+func decryptWith(cs Cryptosystem, privateKey PrivateKey, ct []byte) ([]byte, error) {
+	d, err := cs.NewDecryptor(bytes.NewReader(ct), privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(d)
+}
+
+// KnapsackPublicKey is a Merkle-Hellman public key as a PublicKey
+type KnapsackPublicKey struct {
+	Key       []*big.Int
+	DigitBits int // see Knapsack.DigitBits
+}
+
+// Elements returns the public key
+func (pk *KnapsackPublicKey) Elements() []*big.Int {
+	return pk.Key
+}
+
+// Public returns the public key and its digit size
+func (k *Knapsack) Public() PublicKey {
+	return &KnapsackPublicKey{Key: k.PublicKey, DigitBits: k.DigitBits}
+}
+
+// MerkleHellmanScheme is the Cryptosystem for Knapsack keys, registered as
+// "merkle-hellman". Its default mode is hybrid encryption, or compact
+// encryption for compact keys.
+type MerkleHellmanScheme struct {
+	// Options replaces DefaultKeygenOptions in GenerateKey if it's set
+	Options *KeygenOptions
+}
+
+// Name returns "merkle-hellman"
+func (MerkleHellmanScheme) Name() string {
+	return "merkle-hellman"
+}
+
+// GenerateKey returns a *Knapsack
+func (s MerkleHellmanScheme) GenerateKey(random io.Reader, length int64) (PrivateKey, error) {
+	opts := DefaultKeygenOptions(length)
+	if s.Options != nil {
+		opts = *s.Options
+	}
+	return NewKnapsackWithOptions(random, opts)
+}
+
+// Encrypt encrypts with hybrid encryption, or compact encryption for compact
+// keys
+func (s MerkleHellmanScheme) Encrypt(random io.Reader, publicKey PublicKey, message []byte) ([]byte, error) {
+	return encryptWith(s, random, publicKey, message, EncryptOptions{})
+}
+
+// Decrypt decrypts any Merkle-Hellman ciphertext
+func (s MerkleHellmanScheme) Decrypt(privateKey PrivateKey, ct []byte) ([]byte, error) {
+	return decryptWith(s, privateKey, ct)
+}
+
+// NewEncryptor returns an Encryptor in ModeMultiRecipient for several
+// recipients, or ModeHybrid (the default), ModeCompact (the default for
+// compact keys), ModeTextbook or ModeRandomized for one. ModeRandomized needs
+// a key of at least 512 elements.
+func (MerkleHellmanScheme) NewEncryptor(w io.Writer, recipients []PublicKey, opts EncryptOptions) (*Encryptor, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("at least one public key is required")
+	}
+	keys := make([][]*big.Int, len(recipients))
+	for i, recipient := range recipients {
+		pk, ok := recipient.(*KnapsackPublicKey)
+		if !ok {
+			return nil, ErrWrongScheme
+		}
+		keys[i] = pk.Key
+	}
+	if len(keys) > 1 {
+		if opts.Hybrid || opts.Textbook || opts.Randomized {
+			return nil, errors.New("encrypting for several public keys always uses hybrid encryption")
+		}
+		return NewMultiEncryptor(w, keys), nil
+	}
+
+	e := NewEncryptor(w, keys[0])
+	digitBits := recipients[0].(*KnapsackPublicKey).DigitBits
+	switch {
+	case opts.Hybrid:
+		e.Mode = ModeHybrid
+	case opts.Textbook:
+		e.Mode = ModeTextbook
+	case opts.Randomized:
+		if len(keys[0]) < minRandomizedLength {
+			return nil, fmt.Errorf("randomized encryption needs a public key with at least %d elements for a %d bit seed", minRandomizedLength, minSeedBits)
+		}
+		e.Mode = ModeRandomized
+	case digitBits > 1:
+		// compact keys only carry several bits per element in compact mode
+		e.Mode = ModeCompact
+		e.DigitBits = digitBits
+	default:
+		e.Mode = ModeHybrid
+	}
+	return e, nil
+}
+
+// NewDecryptor returns a Decryptor for a *Knapsack
+func (MerkleHellmanScheme) NewDecryptor(r io.Reader, privateKey PrivateKey) (*Decryptor, error) {
+	k, ok := privateKey.(*Knapsack)
+	if !ok {
+		return nil, ErrWrongScheme
+	}
+	return NewDecryptor(r, k), nil
+}
+
+// MarshalPublicKey writes a PublicKeyFile
+func (MerkleHellmanScheme) MarshalPublicKey(publicKey PublicKey) ([]byte, error) {
+	pk, ok := publicKey.(*KnapsackPublicKey)
+	if !ok {
+		return nil, ErrWrongScheme
+	}
+	return PackPublic(pk)
+}
+
+// MarshalPrivateKey writes a PrivateKeyFile
+func (MerkleHellmanScheme) MarshalPrivateKey(privateKey PrivateKey) ([]byte, error) {
+	k, ok := privateKey.(*Knapsack)
+	if !ok {
+		return nil, ErrWrongScheme
+	}
+	_, priv, err := Pack(*k)
+	return priv, err
+}
+
+// UnmarshalPublicKey reads a PublicKeyFile. Files written by PackVerifier are
+// recognized but rejected with ErrVerifierKey; read them with UnpackVerifier.
+func (MerkleHellmanScheme) UnmarshalPublicKey(b []byte) (PublicKey, error) {
+	if err := checkKeyFields(b, []string{"PubKey"}, "M", "DigitBits"); err != nil {
+		return nil, err
+	}
+	pkf := &PublicKeyFile{}
+	if err := msgpack.Unmarshal(b, pkf); err != nil {
+		return nil, err
+	}
+	if len(pkf.M) > 0 {
+		return nil, ErrVerifierKey
+	}
+	pk := UnpackPublic(pkf)
+	if err := ValidatePublicKey(pk); err != nil {
+		return nil, err
+	}
+	return &KnapsackPublicKey{Key: pk, DigitBits: pkf.DigitBits}, nil
+}
+
+// UnmarshalPrivateKey reads a PrivateKeyFile (see UnpackPrivate)
+func (MerkleHellmanScheme) UnmarshalPrivateKey(b []byte) (PrivateKey, error) {
+	if err := checkKeyFields(b, []string{"PrivKey", "M", "W", "WI"}, "Perm", "Rounds", "DigitBits", "LowBits", "Moduli"); err != nil {
+		return nil, err
+	}
+	skf := &PrivateKeyFile{}
+	if err := msgpack.Unmarshal(b, skf); err != nil {
+		return nil, err
+	}
+	return UnpackPrivate(skf)
+}
@@ -0,0 +1,198 @@
+package knapsack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+// testSchemes returns the registered schemes, with small enough parameters to
+// generate keys quickly
+func testSchemes() []Cryptosystem {
+	out := Schemes()
+	for i, cs := range out {
+		if _, ok := cs.(ChorRivestScheme); ok {
+			out[i] = ChorRivestScheme{Options: &testChorRivestOptions}
+		}
+	}
+	return out
+}
+
+func TestLookupScheme(t *testing.T) {
+	if names := SchemeNames(); names[0] != "merkle-hellman" {
+		t.Errorf("wanted merkle-hellman to be the first scheme, got %v", names)
+	}
+	for _, name := range SchemeNames() {
+		cs, err := LookupScheme(name)
+		handleFatalError(err, t)
+		if cs.Name() != name {
+			t.Errorf("looked up %s, got %s", name, cs.Name())
+		}
+	}
+	if _, err := LookupScheme("rot13"); !errors.Is(err, ErrUnknownScheme) {
+		t.Errorf("wanted ErrUnknownScheme, got %v", err)
+	}
+}
+
+func TestRegisterSchemeTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a name twice didn't panic")
+		}
+	}()
+	RegisterScheme(MerkleHellmanScheme{})
+}
+
+func TestCryptosystems(t *testing.T) {
+	for _, cs := range testSchemes() {
+		k, err := cs.GenerateKey(rand.Reader, 32)
+		handleFatalError(err, t)
+
+		for _, size := range []int{0, 1, 100} {
+			msg := make([]byte, size)
+			_, err := rand.Read(msg)
+			handleFatalError(err, t)
+
+			ct, err := cs.Encrypt(nil, k.Public(), msg)
+			handleFatalError(err, t)
+			d, err := cs.Decrypt(k, ct)
+			if err != nil {
+				t.Fatalf("%s, size %d: %v", cs.Name(), size, err)
+			}
+			if !bytes.Equal(d, msg) {
+				t.Errorf("%s, size %d: decrypted message differs", cs.Name(), size)
+			}
+		}
+	}
+}
+
+func TestMarshalUnmarshalKeys(t *testing.T) {
+	for _, cs := range testSchemes() {
+		k, err := cs.GenerateKey(rand.Reader, 24)
+		handleFatalError(err, t)
+		pub, err := cs.MarshalPublicKey(k.Public())
+		handleFatalError(err, t)
+		priv, err := cs.MarshalPrivateKey(k)
+		handleFatalError(err, t)
+
+		// the key files say which scheme they're for
+		pubScheme, pk, err := UnmarshalPublicKey(pub)
+		handleFatalError(err, t)
+		privScheme, sk, err := UnmarshalPrivateKey(priv)
+		handleFatalError(err, t)
+		if pubScheme.Name() != cs.Name() || privScheme.Name() != cs.Name() {
+			t.Errorf("%s key files detected as %s and %s", cs.Name(), pubScheme.Name(), privScheme.Name())
+		}
+		want := PublicKeyFingerprint(k.Public().Elements())
+		if !bytes.Equal(PublicKeyFingerprint(pk.Elements()), want) || !bytes.Equal(PublicKeyFingerprint(sk.Public().Elements()), want) {
+			t.Errorf("%s: unmarshaled public key differs", cs.Name())
+		}
+
+		// and no other scheme reads them
+		for _, other := range Schemes() {
+			if other.Name() == cs.Name() {
+				continue
+			}
+			if _, err := other.UnmarshalPublicKey(pub); !errors.Is(err, ErrWrongScheme) {
+				t.Errorf("%s read a %s public key file: %v", other.Name(), cs.Name(), err)
+			}
+			if _, err := other.UnmarshalPrivateKey(priv); !errors.Is(err, ErrWrongScheme) {
+				t.Errorf("%s read a %s private key file: %v", other.Name(), cs.Name(), err)
+			}
+			if _, err := other.NewDecryptor(bytes.NewReader(nil), k); !errors.Is(err, ErrWrongScheme) {
+				t.Errorf("%s used a %s private key: %v", other.Name(), cs.Name(), err)
+			}
+		}
+	}
+}
+
+func TestUnmarshalLegacyKeyFiles(t *testing.T) {
+	k, err := NewKnapsack(16)
+	handleFatalError(err, t)
+	k.Perm = nil
+	k.PublicKey = k.DerivePublicKey()
+
+	// unshuffled keys are still Merkle-Hellman keys, and so are verifier
+	// files, though they can't be encrypted to
+	_, priv, err := Pack(*k)
+	handleFatalError(err, t)
+	sk, err := NewSigningKey(16)
+	handleFatalError(err, t)
+	verifier, err := PackVerifier(*sk)
+	handleFatalError(err, t)
+	if cs, _, err := UnmarshalPrivateKey(priv); err != nil || cs.Name() != "merkle-hellman" {
+		t.Errorf("unshuffled private key file: %v", err)
+	}
+	if cs, _, err := UnmarshalPublicKey(verifier); !errors.Is(err, ErrVerifierKey) || cs.Name() != "merkle-hellman" {
+		t.Errorf("verifier public key file: %v", err)
+	}
+}
+
+func TestEncryptOptions(t *testing.T) {
+	mh, err := NewKnapsack(32)
+	handleFatalError(err, t)
+	long, err := NewKnapsack(512)
+	handleFatalError(err, t)
+	ns, err := NewNaccacheStern(32)
+	handleFatalError(err, t)
+	cr, err := NewChorRivestWithOptions(rand.Reader, testChorRivestOptions)
+	handleFatalError(err, t)
+	otu, err := NewOTU(32)
+	handleFatalError(err, t)
+
+	var buf bytes.Buffer
+	cases := []struct {
+		cs         Cryptosystem
+		recipients []PublicKey
+		opts       EncryptOptions
+		mode       Mode
+	}{
+		{MerkleHellmanScheme{}, []PublicKey{long.Public()}, EncryptOptions{}, ModeHybrid},
+		{MerkleHellmanScheme{}, []PublicKey{long.Public()}, EncryptOptions{Randomized: true}, ModeRandomized},
+		{MerkleHellmanScheme{}, []PublicKey{mh.Public()}, EncryptOptions{}, ModeHybrid},
+		{MerkleHellmanScheme{}, []PublicKey{mh.Public()}, EncryptOptions{Textbook: true}, ModeTextbook},
+		{MerkleHellmanScheme{}, []PublicKey{mh.Public()}, EncryptOptions{Hybrid: true}, ModeHybrid},
+		{MerkleHellmanScheme{}, []PublicKey{mh.Public(), mh.Public()}, EncryptOptions{}, ModeMultiRecipient},
+		{NaccacheSternScheme{}, []PublicKey{ns.Public()}, EncryptOptions{Textbook: true}, ModeNaccacheStern},
+		// textbook is the only mode, so it's the default too
+		{NaccacheSternScheme{}, []PublicKey{ns.Public()}, EncryptOptions{}, ModeNaccacheStern},
+		{ChorRivestScheme{}, []PublicKey{cr.Public()}, EncryptOptions{}, ModeChorRivest},
+		{OTUScheme{}, []PublicKey{otu.Public()}, EncryptOptions{}, ModeOTU},
+	}
+	for _, c := range cases {
+		e, err := c.cs.NewEncryptor(&buf, c.recipients, c.opts)
+		handleFatalError(err, t)
+		if e.Mode != c.mode {
+			t.Errorf("%s %+v: wanted mode %d, got %d", c.cs.Name(), c.opts, c.mode, e.Mode)
+		}
+	}
+
+	if _, err := (NaccacheSternScheme{}).NewEncryptor(&buf, []PublicKey{ns.Public()}, EncryptOptions{Hybrid: true}); err == nil {
+		t.Error("Naccache–Stern allowed hybrid encryption")
+	}
+	// deterministic schemes don't quietly stand in for randomized encryption
+	if _, err := (NaccacheSternScheme{}).NewEncryptor(&buf, []PublicKey{ns.Public()}, EncryptOptions{Randomized: true}); err == nil {
+		t.Error("Naccache–Stern allowed randomized encryption")
+	}
+	if _, err := (ChorRivestScheme{}).NewEncryptor(&buf, []PublicKey{cr.Public()}, EncryptOptions{Randomized: true}); err == nil {
+		t.Error("Chor–Rivest allowed randomized encryption")
+	}
+	if _, err := (OTUScheme{}).NewEncryptor(&buf, []PublicKey{otu.Public()}, EncryptOptions{Randomized: true}); err == nil {
+		t.Error("OTU allowed randomized encryption")
+	}
+	// too short for a safe randomized seed
+	if _, err := (MerkleHellmanScheme{}).NewEncryptor(&buf, []PublicKey{mh.Public()}, EncryptOptions{Randomized: true}); err == nil {
+		t.Error("randomized encryption allowed a 32 element key")
+	}
+	if _, err := (MerkleHellmanScheme{}).NewEncryptor(&buf, []PublicKey{ns.Public()}, EncryptOptions{}); !errors.Is(err, ErrWrongScheme) {
+		t.Errorf("wanted ErrWrongScheme, got %v", err)
+	}
+
+	// scheme encryptors can't be switched to another scheme's mode
+	e := NewNaccacheSternEncryptor(&buf, ns.PublicKey, ns.P)
+	e.Mode = ModeHybrid
+	if err := e.Close(); err == nil {
+		t.Error("Naccache–Stern encryptor ran in hybrid mode")
+	}
+}
@@ -0,0 +1,234 @@
+package knapsack
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// Discrete logarithms in groups of smooth order, for the schemes whose keys
+// are logs (Chor–Rivest and Okamoto–Tanaka–Uchiyama).
+
+// ErrNotSmooth means a group order has a prime factor too large for discrete
+// logs with Pohlig–Hellman
+var ErrNotSmooth = errors.New("group order has a prime factor too large for discrete logs")
+
+// maxFactorBits bounds the prime factors of group orders: baby-step giant-step
+// keeps 2^(maxFactorBits/2) group elements in memory for the largest one
+const maxFactorBits = 36
+
+// cyclicGroup is the arithmetic dlog needs from a multiplicative group
+type cyclicGroup interface {
+	one() groupElem
+	mul(a, b groupElem) groupElem
+}
+
+// groupElem is an element of a cyclicGroup
+type groupElem interface {
+	// key returns a string usable as a map key; equal elements have equal keys
+	key() string
+}
+
+// zpGroup is the multiplicative group of integers mod a prime p
+type zpGroup struct {
+	p *big.Int
+}
+
+type zpElem struct {
+	*big.Int
+}
+
+func (e zpElem) key() string {
+	return string(e.Bytes())
+}
+
+func (G zpGroup) one() groupElem {
+	return zpElem{big.NewInt(1)}
+}
+
+func (G zpGroup) mul(a, b groupElem) groupElem {
+	n := new(big.Int).Mul(a.(zpElem).Int, b.(zpElem).Int)
+	return zpElem{n.Mod(n, G.p)}
+}
+
+type primePower struct {
+	q *big.Int
+	e int
+}
+
+// returns a^e in G (square and multiply)
+func groupExp(G cyclicGroup, a groupElem, e *big.Int) groupElem {
+	out := G.one()
+	for i := e.BitLen() - 1; i >= 0; i-- {
+		out = G.mul(out, out)
+		if e.Bit(i) == 1 {
+			out = G.mul(out, a)
+		}
+	}
+	return out
+}
+
+// dlog returns x with g^x = y in G, whose order factors into `prime`, using
+// Pohlig–Hellman: x is found mod each prime power q^e of the order a digit at
+// a time, each digit by baby-step giant-step in the subgroup of order q, and
+// the results are combined with the CRT
+func dlog(G cyclicGroup, order *big.Int, prime []primePower, g, y groupElem) (*big.Int, error) {
+	x := new(big.Int)
+	modulus := big.NewInt(1)
+	for _, pp := range prime {
+		cofactor := new(big.Int).Quo(order, pp.q)
+		gamma := groupExp(G, g, cofactor) // order q
+
+		// x mod q^e = sum(d_k q^k)
+		xq := new(big.Int)
+		qk := big.NewInt(1)
+		for k := 0; k < pp.e; k++ {
+			// (y / g^xq)^(order / q^(k+1)) = gamma^(d_k)
+			gInv := groupExp(G, g, new(big.Int).Sub(order, xq))
+			exponent := new(big.Int).Quo(cofactor, qk)
+			target := groupExp(G, G.mul(y, gInv), exponent)
+			d, err := babyGiant(G, gamma, target, pp.q)
+			if err != nil {
+				return nil, err
+			}
+			xq.Add(xq, new(big.Int).Mul(d, qk))
+			qk.Mul(qk, pp.q)
+		}
+
+		// combine x mod modulus and xq mod q^e
+		x = crt(x, modulus, xq, qk)
+		modulus.Mul(modulus, qk)
+	}
+	return x, nil
+}
+
+// returns d in [0, q) with gamma^d = target, where gamma has order q
+func babyGiant(G cyclicGroup, gamma, target groupElem, q *big.Int) (*big.Int, error) {
+	m := new(big.Int).Sqrt(q)
+	m.Add(m, big.NewInt(1))
+	steps := m.Int64()
+
+	baby := make(map[string]int64, steps)
+	e := G.one()
+	for j := int64(0); j < steps; j++ {
+		if _, ok := baby[e.key()]; !ok {
+			baby[e.key()] = j
+		}
+		e = G.mul(e, gamma)
+	}
+
+	// giant steps multiply by gamma^-m
+	giant := groupExp(G, gamma, new(big.Int).Sub(q, m))
+	e = target
+	for i := int64(0); i < steps; i++ {
+		if j, ok := baby[e.key()]; ok {
+			d := new(big.Int).Mul(big.NewInt(i), m)
+			return d.Add(d, big.NewInt(j)).Mod(d, q), nil
+		}
+		e = G.mul(e, giant)
+	}
+	return nil, errors.New("discrete logarithm not found")
+}
+
+// returns x mod m1*m2 with x = a1 mod m1 and x = a2 mod m2 (m1, m2 coprime)
+func crt(a1, m1, a2, m2 *big.Int) *big.Int {
+	// x = a1 + m1 * ((a2 - a1) * m1^-1 mod m2)
+	inv := new(big.Int).ModInverse(m1, m2)
+	t := new(big.Int).Sub(a2, a1)
+	t.Mul(t, inv).Mod(t, m2)
+	t.Mul(t, m1)
+	return t.Add(t, a1)
+}
+
+// factorSmooth factors a group order into prime powers, smallest prime first,
+// failing with ErrNotSmooth if a factor is bigger than maxFactorBits
+func factorSmooth(order *big.Int) ([]primePower, error) {
+	counts := make(map[string]*primePower)
+	var add func(n *big.Int) error
+	add = func(n *big.Int) error {
+		if n.Cmp(big.NewInt(1)) == 0 {
+			return nil
+		}
+		if n.ProbablyPrime(20) {
+			if n.BitLen() > maxFactorBits {
+				return fmt.Errorf("%w: %d bit factor", ErrNotSmooth, n.BitLen())
+			}
+			if pp, ok := counts[n.String()]; ok {
+				pp.e++
+			} else {
+				counts[n.String()] = &primePower{q: new(big.Int).Set(n), e: 1}
+			}
+			return nil
+		}
+		d := pollardRho(n)
+		if d == nil {
+			return fmt.Errorf("%w: couldn't factor %d bit cofactor", ErrNotSmooth, n.BitLen())
+		}
+		if err := add(d); err != nil {
+			return err
+		}
+		return add(new(big.Int).Quo(n, d))
+	}
+
+	n := new(big.Int).Set(order)
+	// strip small factors first so rho only sees what's left
+	r := new(big.Int)
+	for q := int64(2); q < 1<<12; q++ {
+		qBig := big.NewInt(q)
+		for {
+			quo, _ := new(big.Int).QuoRem(n, qBig, r)
+			if r.Sign() != 0 {
+				break
+			}
+			if err := add(qBig); err != nil {
+				return nil, err
+			}
+			n = quo
+		}
+	}
+	if err := add(n); err != nil {
+		return nil, err
+	}
+
+	prime := make([]primePower, 0, len(counts))
+	for _, pp := range counts {
+		prime = append(prime, *pp)
+	}
+	sort.Slice(prime, func(i, j int) bool { return prime[i].q.Cmp(prime[j].q) < 0 })
+	return prime, nil
+}
+
+// pollardRho returns a nontrivial factor of composite n, or nil if none is
+// found within the iterations that would find a factor of maxFactorBits.
+// differences are multiplied together and only checked every rhoBatch steps.
+func pollardRho(n *big.Int) *big.Int {
+	const rhoBatch = 128
+	one := big.NewInt(1)
+	limit := 1 << (maxFactorBits/2 + 2)
+	for c := int64(1); c < 10; c++ {
+		cBig := big.NewInt(c)
+		step := func(v *big.Int) {
+			v.Mul(v, v).Add(v, cBig).Mod(v, n)
+		}
+		x, y := big.NewInt(2), big.NewInt(2)
+		prod, diff, d := big.NewInt(1), new(big.Int), new(big.Int)
+		for i := 1; i <= limit; i++ {
+			step(x)
+			step(y)
+			step(y)
+			prod.Mul(prod, diff.Sub(x, y)).Mod(prod, n)
+			if i%rhoBatch != 0 {
+				continue
+			}
+			d.GCD(nil, nil, prod.Abs(prod), n)
+			if d.Cmp(n) == 0 {
+				break // several factors at once; try another c
+			}
+			if d.Cmp(one) != 0 {
+				return d
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package knapsack
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"math/big"
+	"strings"
+)
+
+// fingerprintVersion is the first byte of every Fingerprint, so the way they're
+// computed can change without old and new fingerprints being confused
+const fingerprintVersion = 1
+
+// fingerprint domains keep a public and a private key with the same elements
+// from having the same fingerprint
+const (
+	publicFingerprintDomain  = "knapsack public key fingerprint\x00"
+	privateFingerprintDomain = "knapsack private key fingerprint\x00"
+)
+
+// Fingerprint identifies a key: a version byte followed by the SHA-256 hash of
+// the key's elements (and, for private keys, the rest of their parameters).
+// Unlike GetKeyID, each element is length-prefixed, so two different keys
+// can't hash the same bytes, and public and private keys are hashed in
+// separate domains.
+type Fingerprint []byte
+
+// PublicKeyFingerprint returns the fingerprint of a public key
+func PublicKeyFingerprint(publicKey []*big.Int) Fingerprint {
+	return fingerprint(publicFingerprintDomain, publicKey)
+}
+
+// Fingerprint returns the fingerprint of the private key. It covers every
+// parameter that's stored in the private key file (WI follows from W and M),
+// so keys that decrypt differently never share a fingerprint.
+func (k *Knapsack) Fingerprint() Fingerprint {
+	perm := make([]*big.Int, len(k.Perm))
+	for i, idx := range k.Perm {
+		perm[i] = big.NewInt(int64(idx))
+	}
+	var rounds []*big.Int
+	for _, r := range k.Iterations {
+		rounds = append(rounds, r.M, r.W)
+	}
+	sizes := []*big.Int{big.NewInt(int64(k.digitBits())), big.NewInt(int64(k.LowBits))}
+	return fingerprint(privateFingerprintDomain,
+		k.PrivateKey, []*big.Int{k.M, k.W}, perm, rounds, sizes, k.Moduli)
+}
+
+// hashes each section of numbers, length-prefixed, after the domain. public
+// keys are a single section.
+func fingerprint(domain string, sections ...[]*big.Int) Fingerprint {
+	h := sha256.New()
+	h.Write([]byte(domain))
+	h.Write([]byte{fingerprintVersion})
+	for _, section := range sections {
+		h.Write(appendUvarint(nil, uint64(len(section))))
+		for _, n := range section {
+			var b []byte
+			if n != nil {
+				b = n.Bytes()
+			}
+			h.Write(appendUvarint(nil, uint64(len(b))))
+			h.Write(b)
+		}
+	}
+	return h.Sum([]byte{fingerprintVersion})
+}
+
+// String returns the fingerprint in hex
+func (f Fingerprint) String() string {
+	return hex.EncodeToString(f)
+}
+
+// Base32 returns the fingerprint in unpadded lowercase base32
+func (f Fingerprint) Base32() string {
+	return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(f))
+}
+
+// randomart dimensions and symbols, as in OpenSSH
+const (
+	randomartWidth  = 17
+	randomartHeight = 9
+	randomartChars  = " .o+=*BOX@%&#/^"
+)
+
+// Randomart draws the fingerprint's hash the way OpenSSH draws host keys (the
+// "drunken bishop"), which makes two fingerprints easier to compare by eye.
+func (f Fingerprint) Randomart() string {
+	var field [randomartWidth][randomartHeight]int
+	x, y := randomartWidth/2, randomartHeight/2
+	startX, startY := x, y
+
+	// the bishop moves diagonally for each 2 bits of the hash, low bits first
+	for _, b := range f[1:] {
+		for i := 0; i < 4; i++ {
+			if b&1 == 1 {
+				x++
+			} else {
+				x--
+			}
+			if b&2 == 2 {
+				y++
+			} else {
+				y--
+			}
+			x = clamp(x, 0, randomartWidth-1)
+			y = clamp(y, 0, randomartHeight-1)
+			if field[x][y] < len(randomartChars)-1 {
+				field[x][y]++
+			}
+			b >>= 2
+		}
+	}
+
+	var art strings.Builder
+	art.WriteString(randomartBorder("KNAPSACK"))
+	for row := 0; row < randomartHeight; row++ {
+		art.WriteByte('|')
+		for col := 0; col < randomartWidth; col++ {
+			switch {
+			case col == startX && row == startY:
+				art.WriteByte('S')
+			case col == x && row == y:
+				art.WriteByte('E')
+			default:
+				art.WriteByte(randomartChars[field[col][row]])
+			}
+		}
+		art.WriteString("|\n")
+	}
+	art.WriteString(randomartBorder("SHA256"))
+	return art.String()
+}
+
+// returns a border line with `title` in the middle, e.g. +---[SHA256]----+
+func randomartBorder(title string) string {
+	title = "[" + title + "]"
+	left := (randomartWidth - len(title)) / 2
+	right := randomartWidth - len(title) - left
+	return "+" + strings.Repeat("-", left) + title + strings.Repeat("-", right) + "+\n"
+}
+
+func clamp(n, min, max int) int {
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
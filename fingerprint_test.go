@@ -0,0 +1,92 @@
+package knapsack
+
+import (
+	"bytes"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestFingerprintUnambiguous(t *testing.T) {
+	a := intsToBigs([]int64{0x01, 0x0203})
+	b := intsToBigs([]int64{0x0102, 0x03})
+
+	if !bytes.Equal(GetKeyID(a), GetKeyID(b)) {
+		t.Fatal("expected the legacy key IDs to collide")
+	}
+	if bytes.Equal(PublicKeyFingerprint(a), PublicKeyFingerprint(b)) {
+		t.Error("fingerprints of different keys collide")
+	}
+}
+
+func TestFingerprintDomains(t *testing.T) {
+	k := &Knapsack{PrivateKey: intsToBigs([]int64{2, 3, 7, 14, 30})}
+	if bytes.Equal(k.Fingerprint(), PublicKeyFingerprint(k.PrivateKey)) {
+		t.Error("public and private fingerprints of the same elements match")
+	}
+
+	f := PublicKeyFingerprint(k.PrivateKey)
+	if f[0] != fingerprintVersion || len(f) != 33 {
+		t.Errorf("wanted version byte and 32 byte hash, got %x", f)
+	}
+}
+
+func TestFingerprintCoversPrivateParameters(t *testing.T) {
+	k, err := NewKnapsackWithReader(NewSeededReader([]byte("seed")), 16)
+	handleFatalError(err, t)
+	changes := []func(k *Knapsack){
+		func(k *Knapsack) { k.M = new(big.Int).Add(k.M, big.NewInt(1)) },
+		func(k *Knapsack) { k.W = new(big.Int).Add(k.W, big.NewInt(1)) },
+		func(k *Knapsack) { k.Perm = nil },
+		func(k *Knapsack) { k.Iterations = []Round{{M: k.M, W: k.W, WI: k.WI}} },
+		func(k *Knapsack) { k.DigitBits = 2 },
+		func(k *Knapsack) { k.LowBits = 20 },
+		func(k *Knapsack) { k.Moduli = intsToBigs([]int64{3, 5}) },
+	}
+	for idx, change := range changes {
+		changed := *k
+		change(&changed)
+		if bytes.Equal(changed.Fingerprint(), k.Fingerprint()) {
+			t.Errorf("for change #%d: fingerprint didn't change", idx)
+		}
+	}
+}
+
+func TestFingerprintStable(t *testing.T) {
+	k, err := NewKnapsackWithReader(NewSeededReader([]byte("seed")), 16)
+	handleFatalError(err, t)
+
+	if got, want := PublicKeyFingerprint(k.PublicKey).String(), "012d2353029c2c5e641886a0ff8d450f93e4fb2ba5b080eefd904c7c282bdc9979"; got != want {
+		t.Errorf("public fingerprint changed: got %s, want %s", got, want)
+	}
+	if got, want := k.Fingerprint().String(), "0176b041471d3eb08b3e733446617d2efa9c4b033c4ecaa0a547ebea5435cccd6c"; got != want {
+		t.Errorf("private fingerprint changed: got %s, want %s", got, want)
+	}
+}
+
+func TestFingerprintBase32(t *testing.T) {
+	f := PublicKeyFingerprint(intsToBigs([]int64{1, 2, 4}))
+	b32 := f.Base32()
+	if len(b32) != 53 || strings.ContainsAny(b32, "=ABCDEFGHIJKLMNOPQRSTUVWXYZ") {
+		t.Errorf("unexpected base32 fingerprint %q", b32)
+	}
+}
+
+func TestFingerprintRandomart(t *testing.T) {
+	art := PublicKeyFingerprint(intsToBigs([]int64{1, 2, 4})).Randomart()
+	lines := strings.Split(strings.TrimSuffix(art, "\n"), "\n")
+	if len(lines) != randomartHeight+2 {
+		t.Fatalf("wanted %d lines, got %d:\n%s", randomartHeight+2, len(lines), art)
+	}
+	for _, line := range lines {
+		if len(line) != randomartWidth+2 {
+			t.Errorf("line %q is %d wide", line, len(line))
+		}
+	}
+	if lines[0] != "+---[KNAPSACK]----+" || lines[len(lines)-1] != "+----[SHA256]-----+" {
+		t.Errorf("unexpected borders:\n%s", art)
+	}
+	if !strings.Contains(art, "S") {
+		t.Errorf("missing start marker:\n%s", art)
+	}
+}
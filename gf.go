@@ -0,0 +1,279 @@
+package knapsack
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// Arithmetic in GF(p^h) for Chor–Rivest. Field elements are polynomials over
+// GF(p) of degree < h, stored as h coefficients (lowest degree first), and
+// multiplied modulo a monic irreducible polynomial f of degree h.
+
+type gfElem []int64
+
+// gfField is GF(p^h) = GF(p)[x] / f
+type gfField struct {
+	p     int64
+	f     []int64      // monic, degree h (h+1 coefficients)
+	order *big.Int     // p^h - 1, the order of the multiplicative group
+	prime []primePower // factorization of order, filled in by factorOrder
+}
+
+func newGFField(p int64, f []int64) *gfField {
+	order := new(big.Int).Exp(big.NewInt(p), big.NewInt(int64(len(f)-1)), nil)
+	return &gfField{p: p, f: f, order: order.Sub(order, big.NewInt(1))}
+}
+
+// h is the degree of the extension
+func (F *gfField) h() int {
+	return len(F.f) - 1
+}
+
+func (F *gfField) one() gfElem {
+	e := make(gfElem, F.h())
+	e[0] = 1
+	return e
+}
+
+// returns x + a, the element Chor–Rivest takes the logarithm of for each a in GF(p)
+func (F *gfField) xPlus(a int64) gfElem {
+	e := make(gfElem, F.h())
+	e[0] = mod(a, F.p)
+	if F.h() > 1 {
+		e[1] = 1
+	} else {
+		// h = 1: x is the root of f = x + f[0], i.e. -f[0]
+		e[0] = mod(a-F.f[0], F.p)
+	}
+	return e
+}
+
+func (F *gfField) mul(a, b gfElem) gfElem {
+	return polyMod(polyMul(a, b, F.p), F.f, F.p, F.h())
+}
+
+func (F *gfField) exp(a gfElem, e *big.Int) gfElem {
+	out := F.one()
+	for i := e.BitLen() - 1; i >= 0; i-- {
+		out = F.mul(out, out)
+		if e.Bit(i) == 1 {
+			out = F.mul(out, a)
+		}
+	}
+	return out
+}
+
+func (a gfElem) equal(b gfElem) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// key returns a string usable as a map key
+func (a gfElem) key() string {
+	var sb strings.Builder
+	for _, c := range a {
+		fmt.Fprintf(&sb, "%d,", c)
+	}
+	return sb.String()
+}
+
+// returns a mod p in [0, p)
+func mod(a, p int64) int64 {
+	a %= p
+	if a < 0 {
+		a += p
+	}
+	return a
+}
+
+// returns the inverse of a mod prime p (Fermat)
+func inverseMod(a, p int64) int64 {
+	return new(big.Int).Exp(big.NewInt(a), big.NewInt(p-2), big.NewInt(p)).Int64()
+}
+
+func polyMul(a, b []int64, p int64) []int64 {
+	out := make([]int64, len(a)+len(b)-1)
+	for i, ai := range a {
+		if ai == 0 {
+			continue
+		}
+		for j, bj := range b {
+			out[i+j] = (out[i+j] + ai*bj) % p
+		}
+	}
+	return out
+}
+
+// returns a mod the monic polynomial f, padded to `size` coefficients
+func polyMod(a, f []int64, p int64, size int) []int64 {
+	a = append([]int64(nil), a...)
+	h := len(f) - 1
+	for i := len(a) - 1; i >= h; i-- {
+		c := a[i]
+		if c == 0 {
+			continue
+		}
+		for j := 0; j <= h; j++ {
+			a[i-h+j] = mod(a[i-h+j]-c*f[j], p)
+		}
+	}
+	out := make([]int64, size)
+	copy(out, a)
+	return out
+}
+
+// trims the zero coefficients above the degree
+func polyTrim(a []int64) []int64 {
+	for len(a) > 0 && a[len(a)-1] == 0 {
+		a = a[:len(a)-1]
+	}
+	return a
+}
+
+// returns gcd(a, b) over GF(p), made monic
+func polyGCD(a, b []int64, p int64) []int64 {
+	a, b = polyTrim(append([]int64(nil), a...)), polyTrim(append([]int64(nil), b...))
+	for len(b) > 0 {
+		// make b monic so polyMod can divide by it
+		inv := inverseMod(b[len(b)-1], p)
+		for i := range b {
+			b[i] = b[i] * inv % p
+		}
+		a, b = b, polyTrim(polyMod(a, b, p, len(a)))
+	}
+	return a
+}
+
+// isIrreducible is Rabin's test: monic f of degree h is irreducible over GF(p)
+// iff x^(p^h) = x mod f and gcd(x^(p^(h/r)) - x, f) = 1 for every prime r | h
+func isIrreducible(f []int64, p int64) bool {
+	h := len(f) - 1
+	F := &gfField{p: p, f: f}
+	pBig := big.NewInt(p)
+	x := make(gfElem, h)
+	if h == 1 {
+		return true
+	}
+	x[1] = 1
+
+	// xPow[k] = x^(p^k) mod f
+	xPow := x
+	powers := make([]gfElem, h+1)
+	powers[0] = x
+	for k := 1; k <= h; k++ {
+		xPow = F.exp(xPow, pBig)
+		powers[k] = xPow
+	}
+	if !powers[h].equal(x) {
+		return false
+	}
+	for _, r := range primeFactorsSmall(int64(h)) {
+		diff := append([]int64(nil), powers[int64(h)/r]...)
+		diff[1] = mod(diff[1]-1, p)
+		if g := polyGCD(f, diff, p); len(g) != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// returns a random monic irreducible polynomial of degree h over GF(p)
+func randomIrreducible(random io.Reader, p int64, h int) ([]int64, error) {
+	for {
+		f := make([]int64, h+1)
+		f[h] = 1
+		for i := 0; i < h; i++ {
+			c, err := randomInt(random, big.NewInt(p))
+			if err != nil {
+				return nil, err
+			}
+			f[i] = c.Int64()
+		}
+		if f[0] != 0 && isIrreducible(f, p) {
+			return f, nil
+		}
+	}
+}
+
+// returns a random generator of the multiplicative group
+func (F *gfField) randomGenerator(random io.Reader) (gfElem, error) {
+	for {
+		g := make(gfElem, F.h())
+		for i := range g {
+			c, err := randomInt(random, big.NewInt(F.p))
+			if err != nil {
+				return nil, err
+			}
+			g[i] = c.Int64()
+		}
+		if F.isGenerator(g) {
+			return g, nil
+		}
+	}
+}
+
+// g generates the group iff g^(order/q) != 1 for every prime q | order
+func (F *gfField) isGenerator(g gfElem) bool {
+	one := F.one()
+	if len(polyTrim(append([]int64(nil), g...))) == 0 {
+		return false
+	}
+	for _, pp := range F.prime {
+		if F.exp(g, new(big.Int).Quo(F.order, pp.q)).equal(one) {
+			return false
+		}
+	}
+	return true
+}
+
+// gfGroup adapts gfField's multiplicative group to cyclicGroup
+type gfGroup struct {
+	F *gfField
+}
+
+func (G gfGroup) one() groupElem {
+	return G.F.one()
+}
+
+func (G gfGroup) mul(a, b groupElem) groupElem {
+	return G.F.mul(a.(gfElem), b.(gfElem))
+}
+
+// dlog returns x with g^x = y (see dlog)
+func (F *gfField) dlog(g, y gfElem) (*big.Int, error) {
+	return dlog(gfGroup{F}, F.order, F.prime, g, y)
+}
+
+// factorOrder factors p^h - 1 into prime powers, failing with ErrNotSmooth if
+// a factor is bigger than maxFactorBits
+func (F *gfField) factorOrder() error {
+	prime, err := factorSmooth(F.order)
+	if err != nil {
+		return err
+	}
+	F.prime = prime
+	return nil
+}
+
+// returns the distinct prime factors of a small n
+func primeFactorsSmall(n int64) []int64 {
+	var out []int64
+	for q := int64(2); q*q <= n; q++ {
+		if n%q == 0 {
+			out = append(out, q)
+			for n%q == 0 {
+				n /= q
+			}
+		}
+	}
+	if n > 1 {
+		out = append(out, n)
+	}
+	return out
+}
@@ -0,0 +1,78 @@
+package knapsack
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestIsIrreducible(t *testing.T) {
+	cases := []struct {
+		f    []int64
+		p    int64
+		want bool
+	}{
+		{[]int64{1, 0, 1}, 3, true},     // x^2 + 1 over GF(3)
+		{[]int64{1, 0, 1}, 5, false},    // x^2 + 1 = (x + 2)(x + 3) over GF(5)
+		{[]int64{1, 1, 0, 1}, 2, true},  // x^3 + x + 1 over GF(2)
+		{[]int64{1, 0, 0, 1}, 2, false}, // x^3 + 1 = (x + 1)(x^2 + x + 1) over GF(2)
+		{[]int64{4, 0, 1, 0, 1}, 5, false},
+	}
+	for _, c := range cases {
+		if got := isIrreducible(c.f, c.p); got != c.want {
+			t.Errorf("%v over GF(%d): got %v, want %v", c.f, c.p, got, c.want)
+		}
+	}
+}
+
+func TestGFArithmetic(t *testing.T) {
+	f, err := randomIrreducible(NewSeededReader([]byte("seed")), 13, 6)
+	handleFatalError(err, t)
+	field := newGFField(13, f)
+	handleFatalError(field.factorOrder(), t)
+
+	// every element's order divides p^h - 1
+	a := field.xPlus(5)
+	if !field.exp(a, field.order).equal(field.one()) {
+		t.Error("a^(p^h - 1) != 1")
+	}
+	// a^-1 = a^(p^h - 2)
+	inv := field.exp(a, new(big.Int).Sub(field.order, big.NewInt(1)))
+	if !field.mul(a, inv).equal(field.one()) {
+		t.Error("a * a^-1 != 1")
+	}
+}
+
+func TestFactorOrder(t *testing.T) {
+	field := newGFField(29, make([]int64, 13))
+	handleFatalError(field.factorOrder(), t)
+	n := big.NewInt(1)
+	for _, pp := range field.prime {
+		if !pp.q.ProbablyPrime(20) {
+			t.Errorf("factor %v is not prime", pp.q)
+		}
+		n.Mul(n, new(big.Int).Exp(pp.q, big.NewInt(int64(pp.e)), nil))
+	}
+	if n.Cmp(field.order) != 0 {
+		t.Errorf("factors multiply to %v, want %v", n, field.order)
+	}
+}
+
+func TestDlog(t *testing.T) {
+	random := NewSeededReader([]byte("seed"))
+	f, err := randomIrreducible(random, 29, 12)
+	handleFatalError(err, t)
+	field := newGFField(29, f)
+	handleFatalError(field.factorOrder(), t)
+	g, err := field.randomGenerator(random)
+	handleFatalError(err, t)
+
+	for i := 0; i < 10; i++ {
+		x, err := randomInt(random, field.order)
+		handleFatalError(err, t)
+		got, err := field.dlog(g, field.exp(g, x))
+		handleFatalError(err, t)
+		if got.Cmp(x) != 0 {
+			t.Errorf("got log %v, want %v", got, x)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package knapsack
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// Hybrid ciphertexts are laid out as:
+//
+//   formatHybrid | uvarint length | wrapped key | payload
+//
+// where the wrapped key is a random AES-256 key encrypted with EncryptBytes and
+// the payload is the message sealed with AES-GCM in chunks of hybridChunkSize
+// bytes. Each chunk's nonce is its index, with the last byte marking the final
+// chunk, so chunks can't be reordered, dropped or truncated without detection.
+
+const (
+	hybridKeySize   = 32
+	hybridChunkSize = 64 * 1024
+)
+
+// EncryptBytesHybrid encrypts `messageBytes` with a random AES-GCM key and
+// encrypts only that key with `publicKey`. This keeps the ciphertext about the
+// size of the message no matter how long it is.
+func EncryptBytesHybrid(random io.Reader, publicKey []*big.Int, messageBytes []byte) ([]byte, error) {
+	return encryptAll(publicKey, ModeHybrid, random, messageBytes)
+}
+
+// appends the uvarint length and the knapsack encryption of an AES key
+func appendWrappedKey(b []byte, publicKey []*big.Int, key []byte) ([]byte, error) {
+	wrapped, err := EncryptBytes(publicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	b = appendUvarint(b, uint64(len(wrapped)))
+	return append(b, wrapped...), nil
+}
+
+// reads a wrapped key written by appendWrappedKey
+func readWrappedKey(r *bufio.Reader) ([]byte, error) {
+	wrappedLen, err := binary.ReadUvarint(r)
+	if err != nil || wrappedLen > maxBlockSize {
+		return nil, ErrMalformedCiphertext
+	}
+	wrapped := make([]byte, wrappedLen)
+	if _, err := io.ReadFull(r, wrapped); err != nil {
+		return nil, ErrMalformedCiphertext
+	}
+	if len(wrapped) == 0 || wrapped[0] != formatBlocks {
+		return nil, fmt.Errorf("%w: wrapped key isn't a knapsack ciphertext", ErrMalformedCiphertext)
+	}
+	return wrapped, nil
+}
+
+// decrypts a wrapped AES key and returns the AEAD for the payload
+func (k *Knapsack) unwrapKey(wrapped []byte) (cipher.AEAD, error) {
+	key, err := k.DecryptBytes(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != hybridKeySize {
+		return nil, fmt.Errorf("%w: wrapped key has the wrong size", ErrMalformedCiphertext)
+	}
+	return newHybridAEAD(key)
+}
+
+func newHybridAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// the nonce of chunk i is i as a big-endian integer, with the final byte set
+// to 1 for the last chunk of the payload
+func chunkNonce(chunk uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], chunk)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
@@ -0,0 +1,63 @@
+package knapsack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecryptHybrid(t *testing.T) {
+	k, err := NewKnapsack(100)
+	handleFatalError(err, t)
+
+	for _, size := range []int{0, 1, 1000, hybridChunkSize, hybridChunkSize + 1, 3 * hybridChunkSize} {
+		msg := make([]byte, size)
+		_, err := rand.Read(msg)
+		handleFatalError(err, t)
+
+		ct, err := EncryptBytesHybrid(rand.Reader, k.PublicKey, msg)
+		handleFatalError(err, t)
+		if ct[0] != formatHybrid {
+			t.Fatalf("wanted hybrid format byte, got %d", ct[0])
+		}
+
+		d, err := k.DecryptBytes(ct)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(d, msg) {
+			t.Errorf("size %d: decrypted message differs", size)
+		}
+	}
+}
+
+func TestDecryptHybridTampered(t *testing.T) {
+	k, err := NewKnapsack(100)
+	handleFatalError(err, t)
+
+	msg := bytes.Repeat([]byte("knapsack"), hybridChunkSize/4)
+	ct, err := EncryptBytesHybrid(rand.Reader, k.PublicKey, msg)
+	handleFatalError(err, t)
+
+	flipped := append([]byte(nil), ct...)
+	flipped[len(flipped)-100] ^= 1
+	if _, err := k.DecryptBytes(flipped); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("wanted ErrAuthenticationFailed for modified payload, got %v", err)
+	} else if !strings.Contains(err.Error(), "chunk 1") {
+		t.Errorf("wanted the error to name chunk 1, got %v", err)
+	}
+
+	// dropping the final chunk leaves a chunk that wasn't sealed as the last one
+	truncated := ct[:len(ct)-(len(msg)-hybridChunkSize)-16]
+	if _, err := k.DecryptBytes(truncated); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("wanted ErrAuthenticationFailed for truncated payload, got %v", err)
+	}
+
+	other, err := NewKnapsack(100)
+	handleFatalError(err, t)
+	if _, err := other.DecryptBytes(ct); err == nil {
+		t.Error("wanted error decrypting with a different key")
+	}
+}
@@ -0,0 +1,170 @@
+package knapsack
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+)
+
+// KeygenOptions controls the sizes of the numbers picked by NewKnapsackWithOptions
+type KeygenOptions struct {
+	// Length is the number of elements in the key
+	Length int64
+	// Growth is the number of random bits each private key element has on top
+	// of what it needs to stay superincreasing: element i is picked from
+	// [ (2^i - 1) * (2^Growth + 1), 2^i * (2^Growth + 1) ]
+	// For Goodman–McAuley keys it's the bit length of each CRT modulus instead.
+	Growth int64
+	// ModulusBits is the bit length of the modulus. It must be at least
+	// MinModulusBits (Length + Growth + 2) so the modulus is larger than the
+	// private key sum.
+	ModulusBits int64
+	// Density, if non-zero, replaces Growth and ModulusBits with the sizes
+	// that give a public key of (roughly) this density. See Density.
+	Density float64
+	// Rounds is the number of (W, M) modular multiplications applied to the
+	// private key (iterated Merkle-Hellman). 0 and 1 both mean a single round.
+	Rounds int64
+	// DigitBits is the number of message bits each element carries (compact
+	// knapsack): elements are multiplied by digits in [0, 2^DigitBits) instead
+	// of bits. Element i grows to about 2^(i * DigitBits + Growth) and the
+	// modulus must be at least Length * DigitBits + Growth + 2 bits.
+	// 0 and 1 both mean one bit per element.
+	DigitBits int64
+	// Variant is the easy knapsack behind the public key (see Variant).
+	// Graham–Shamir and Goodman–McAuley keys carry one bit per element and
+	// can't be sized by Density.
+	Variant Variant
+}
+
+// DefaultKeygenOptions returns the options NewKnapsack uses: the Merkle-Hellman
+// parameters scaled to keyLength (Growth = keyLength, ModulusBits = 2 * keyLength + 2)
+func DefaultKeygenOptions(keyLength int64) KeygenOptions {
+	return KeygenOptions{
+		Length:      keyLength,
+		Growth:      keyLength,
+		ModulusBits: keyLength*2 + 2,
+	}
+}
+
+// CompactKeygenOptions returns DefaultKeygenOptions for a compact knapsack
+// with digitBits bits per element, with the modulus grown to fit
+// (ModulusBits = keyLength * digitBits + keyLength + 2)
+func CompactKeygenOptions(keyLength, digitBits int64) KeygenOptions {
+	return KeygenOptions{
+		Length:      keyLength,
+		Growth:      keyLength,
+		ModulusBits: keyLength*digitBits + keyLength + 2,
+		DigitBits:   digitBits,
+	}
+}
+
+// MerkleHellman1978 is the parameter set suggested in "Hiding Information and
+// Signatures in Trapdoor Knapsacks": n = 100, a'_i in [ (2^(i-1) - 1) * 2^100 + 1, 2^(i-1) * 2^100 ],
+// m in [ 2^201 + 1, 2^202 - 1 ]
+var MerkleHellman1978 = KeygenOptions{
+	Length:      100,
+	Growth:      100,
+	ModulusBits: 202,
+}
+
+// resolve applies Density (if set) and checks the options are usable
+func (o KeygenOptions) resolve() (KeygenOptions, error) {
+	if o.Length < 1 {
+		return o, errors.New("key length must be > 0")
+	}
+	if o.DigitBits == 0 {
+		o.DigitBits = 1
+	}
+	if o.DigitBits < 1 || o.DigitBits > maxDigitBits {
+		return o, fmt.Errorf("digit bits must be between 1 and %d", maxDigitBits)
+	}
+	if o.Variant < 0 || int(o.Variant) >= len(variantNames) {
+		return o, fmt.Errorf("%w: %d", ErrUnknownVariant, int(o.Variant))
+	}
+	if o.Variant != VariantMerkleHellman {
+		if o.DigitBits > 1 {
+			return o, fmt.Errorf("%s keys carry one bit per element", o.Variant)
+		}
+		if o.Density != 0 {
+			return o, fmt.Errorf("density isn't supported for %s keys", o.Variant)
+		}
+	}
+	if o.Variant == VariantGoodmanMcAuley {
+		// there have to be plenty of Growth bit primes to pick Length
+		// distinct ones from
+		if min := goodmanMcAuleyMinBits(o.Length); o.Growth < min {
+			return o, fmt.Errorf("goodman-mcauley moduli must be at least %d bits for length %d; there aren't enough smaller primes", min, o.Length)
+		}
+	}
+	if o.Density != 0 {
+		if o.Density < 0 {
+			return o, errors.New("density must be > 0")
+		}
+		// density is roughly Length / ModulusBits since public key elements
+		// are reduced mod M
+		o.ModulusBits = int64(math.Ceil(float64(o.Length) / o.Density))
+		o.Growth = o.ModulusBits - o.Length*o.DigitBits - 2
+		if o.Growth < 0 {
+			return o, fmt.Errorf("density must be <= %.4f for key length %d", float64(o.Length)/float64(o.Length*o.DigitBits+2), o.Length)
+		}
+	}
+	if o.Rounds < 0 {
+		return o, errors.New("rounds must be >= 0")
+	}
+	if o.Growth < 0 {
+		return o, errors.New("growth must be >= 0")
+	}
+	if min := o.MinModulusBits(); o.ModulusBits < min {
+		return o, fmt.Errorf("modulus must be at least %d bits for length %d and growth %d", min, o.Length, o.Growth)
+	}
+	return o, nil
+}
+
+// MinModulusBits returns the smallest ModulusBits for the other options: the
+// modulus has to be larger than the largest knapsack of the private key
+func (o KeygenOptions) MinModulusBits() int64 {
+	// sums of Length elements below 2^b are below 2^(b + bitLen(Length))
+	lengthBits := int64(bits.Len64(uint64(o.Length)))
+	switch o.Variant {
+	case VariantGrahamShamir:
+		// Length random bits above the superincreasing low bits
+		return grahamShamirLowBits(o.Length, o.Growth) + o.Length + lengthBits + 1
+	case VariantGoodmanMcAuley:
+		// every element is below the product of the moduli
+		return o.Length*o.Growth + lengthBits + 1
+	}
+	digitBits := o.DigitBits
+	if digitBits < 1 {
+		digitBits = 1
+	}
+	return o.Length*digitBits + o.Growth + 2
+}
+
+// Density returns n / log2(max(publicKey)), the measure low-density attacks
+// care about: the further below 1, the easier a knapsack is to break with lattice reduction
+func Density(publicKey []*big.Int) float64 {
+	max := new(big.Int)
+	for _, n := range publicKey {
+		if n.Cmp(max) > 0 {
+			max = n
+		}
+	}
+	if max.Sign() == 0 {
+		return math.Inf(1)
+	}
+	return float64(len(publicKey)) / log2(max)
+}
+
+// log2 of arbitrarily large ints (float64 conversion overflows past ~1024 bits)
+func log2(n *big.Int) float64 {
+	shift := n.BitLen() - 64
+	if shift < 0 {
+		shift = 0
+	}
+	top := new(big.Int).Rsh(n, uint(shift))
+	f, _ := new(big.Float).SetInt(top).Float64()
+	return math.Log2(f) + float64(shift)
+}
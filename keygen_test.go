@@ -0,0 +1,131 @@
+package knapsack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestNewKnapsackWithOptions(t *testing.T) {
+	testCases := []KeygenOptions{
+		DefaultKeygenOptions(50),
+		MerkleHellman1978,
+		{Length: 64, Growth: 0, ModulusBits: 66},
+		{Length: 64, Growth: 8, ModulusBits: 200},
+		{Length: 64, Density: 0.9},
+		{Length: 64, Growth: 64, ModulusBits: 130, Rounds: 3},
+	}
+
+	for idx, opts := range testCases {
+		k, err := NewKnapsackWithOptions(rand.Reader, opts)
+		if err != nil {
+			t.Fatalf("for test case #%d: %v", idx, err)
+		}
+		if int64(len(k.PublicKey)) != opts.Length {
+			t.Errorf("for test case #%d: wanted key length %d, got %d", idx, opts.Length, len(k.PublicKey))
+		}
+		if !isSuperincreasing(k.PrivateKey) {
+			t.Errorf("for test case #%d: private key is not superincreasing", idx)
+		}
+		if k.M.Cmp(sum(k.PrivateKey)) <= 0 {
+			t.Errorf("for test case #%d: modulus is not larger than the private key sum", idx)
+		}
+
+		msg := []byte("hello world")
+		ct, err := EncryptBytes(k.PublicKey, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := k.DecryptBytes(ct)
+		if err != nil {
+			t.Fatalf("for test case #%d: %v", idx, err)
+		}
+		if !bytes.Equal(d, msg) {
+			t.Errorf("for test case #%d: wanted %v, got %v", idx, msg, d)
+		}
+	}
+}
+
+func TestNewKnapsackWithOptionsModulusBits(t *testing.T) {
+	k, err := NewKnapsackWithOptions(rand.Reader, MerkleHellman1978)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.M.BitLen() != 202 {
+		t.Errorf("wanted 202 bit modulus, got %d", k.M.BitLen())
+	}
+}
+
+func TestNewKnapsackIterated(t *testing.T) {
+	k, err := NewKnapsackWithOptions(rand.Reader, KeygenOptions{Length: 40, Growth: 40, ModulusBits: 82, Rounds: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(k.Iterations) != 3 {
+		t.Fatalf("wanted 3 extra rounds, got %d", len(k.Iterations))
+	}
+	if err := k.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// each round's modulus is a bit larger than the last
+	prev := k.M
+	for idx, r := range k.Iterations {
+		if r.M.Cmp(prev) <= 0 {
+			t.Errorf("round %d: wanted modulus larger than %v, got %v", idx+1, prev, r.M)
+		}
+		prev = r.M
+	}
+}
+
+func TestKeygenOptionsInvalid(t *testing.T) {
+	testCases := []KeygenOptions{
+		{Length: 0, Growth: 0, ModulusBits: 2},
+		{Length: 10, Growth: -1, ModulusBits: 20},
+		{Length: 10, Growth: 10, ModulusBits: 21},
+		{Length: 10, Density: 0.95},
+		{Length: 10, Density: -1},
+		{Length: 10, Growth: 10, ModulusBits: 22, Rounds: -1},
+	}
+
+	for idx, opts := range testCases {
+		if _, err := NewKnapsackWithOptions(rand.Reader, opts); err == nil {
+			t.Errorf("for test case #%d: wanted error, got nil", idx)
+		}
+	}
+}
+
+func TestDensity(t *testing.T) {
+	// max element 2^10 - 1, so density is 4 / log2(1023)
+	pk := intsToBigs([]int64{1023, 5, 300, 17})
+	if d := Density(pk); math.Abs(d-4/math.Log2(1023)) > 1e-9 {
+		t.Errorf("wanted %v, got %v", 4/math.Log2(1023), d)
+	}
+
+	// larger than float64 can hold
+	huge := []*big.Int{new(big.Int).Lsh(big.NewInt(1), 2000)}
+	if d := Density(huge); math.Abs(d-1.0/2000) > 1e-9 {
+		t.Errorf("wanted %v, got %v", 1.0/2000, d)
+	}
+
+	k, err := NewKnapsackWithOptions(rand.Reader, KeygenOptions{Length: 100, Density: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := Density(k.PublicKey); d < 0.49 || d > 0.52 {
+		t.Errorf("wanted density close to 0.5, got %v", d)
+	}
+}
+
+func isSuperincreasing(arr []*big.Int) bool {
+	total := new(big.Int)
+	for _, n := range arr {
+		if n.Cmp(total) <= 0 {
+			return false
+		}
+		total.Add(total, n)
+	}
+	return true
+}
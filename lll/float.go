@@ -0,0 +1,123 @@
+package lll
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// ErrPrecision means ReduceFloat's float64 Gram–Schmidt coefficients were too
+// far off to finish the reduction; Reduce will work where it doesn't
+var ErrPrecision = errors.New("lattice basis needs more precision than float64")
+
+// cancellation is the fraction of |b_k|^2 below which |ortho[k]|^2 computed in
+// float64 has no correct bits left
+const cancellation = 0x1p-50
+
+// ReduceFloat LLL-reduces the rows of `basis` in place with delta = 3/4, like
+// Reduce, but with float64 Gram–Schmidt coefficients (see ReduceFloatWithDelta)
+func ReduceFloat(basis [][]*big.Int) error {
+	return ReduceFloatWithDelta(basis, 0.75)
+}
+
+// ReduceFloatWithDelta LLL-reduces the rows of `basis` in place like
+// ReduceWithDelta, keeping the basis itself exact but the Gram–Schmidt
+// coefficients in float64, which is much faster for large entries. The
+// coefficients of a row are recomputed from exact dot products whenever it
+// changes (Schnorr and Euchner's variant), so rounding errors don't pile up.
+// The result is reduced up to float64 rounding: a coefficient a hair over 1/2
+// can make IsReduced disagree. Dot products beyond the float64 range fail with
+// ErrPrecision, as does a reduction that stalls on rounding errors.
+func ReduceFloatWithDelta(basis [][]*big.Int, delta float64) error {
+	if err := checkBasis(basis); err != nil {
+		return err
+	}
+	if !(delta > 0.25 && delta < 1) {
+		return fmt.Errorf("%w: %v", ErrInvalidDelta, delta)
+	}
+
+	n := len(basis)
+	mu := make([][]float64, n)
+	r := make([][]float64, n) // r[i][j] = <b_i, ortho[j]>, so r[j][j] = |ortho[j]|^2
+	for i := range mu {
+		mu[i] = make([]float64, n)
+		r[i] = make([]float64, n)
+	}
+	// orthogonalize recomputes row k of mu and r from the rows before it
+	orthogonalize := func(k int) error {
+		for j := 0; j <= k; j++ {
+			dot, _ := new(big.Float).SetInt(Dot(basis[k], basis[j])).Float64()
+			if math.IsInf(dot, 0) {
+				return fmt.Errorf("%w: dot product of rows %d and %d overflows", ErrPrecision, k, j)
+			}
+			for i := 0; i < j; i++ {
+				dot -= mu[j][i] * r[k][i]
+			}
+			r[k][j] = dot
+			if j < k {
+				mu[k][j] = dot / r[j][j]
+			}
+		}
+		// with all but the last few bits of |b_k|^2 cancelled out, |ortho[k]|^2
+		// is rounding noise; that's either a dependent row or too little precision
+		norm, _ := new(big.Float).SetInt(Dot(basis[k], basis[k])).Float64()
+		if r[k][k] <= norm*cancellation {
+			if _, _, err := GramSchmidt(basis[:k+1]); err != nil {
+				return err
+			}
+			return fmt.Errorf("%w: |ortho[%d]|^2 cancelled out", ErrPrecision, k)
+		}
+		return nil
+	}
+
+	// every swap shrinks the product of the Gram determinants, so an honest
+	// reduction can't take more steps than there are bits in them
+	maxSteps := n * n
+	for _, row := range basis {
+		maxSteps += 2 * n * Dot(row, row).BitLen()
+	}
+	if err := orthogonalize(0); err != nil {
+		return err
+	}
+	for k, steps := 1, 0; k < n; steps++ {
+		if steps > maxSteps {
+			return fmt.Errorf("%w: no progress after %d steps", ErrPrecision, steps)
+		}
+		if err := orthogonalize(k); err != nil {
+			return err
+		}
+		// size reduction, repeated while rounding errors leave a large coefficient
+		reduced := false
+		for j := k - 1; j >= 0; j-- {
+			if math.Abs(mu[k][j]) <= 0.5 {
+				continue
+			}
+			q := math.Round(mu[k][j])
+			qBig, _ := new(big.Float).SetFloat64(q).Int(nil)
+			for col := range basis[k] {
+				basis[k][col].Sub(basis[k][col], new(big.Int).Mul(qBig, basis[j][col]))
+			}
+			for i := 0; i < j; i++ {
+				mu[k][i] -= q * mu[j][i]
+			}
+			mu[k][j] -= q
+			reduced = true
+		}
+		if reduced {
+			continue
+		}
+
+		if r[k][k] < (delta-mu[k][k-1]*mu[k][k-1])*r[k-1][k-1] {
+			basis[k], basis[k-1] = basis[k-1], basis[k]
+			if k > 1 {
+				k--
+			} else if err := orthogonalize(0); err != nil {
+				return err
+			}
+			continue
+		}
+		k++
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package lll
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+func TestReduceFloatKnownBasis(t *testing.T) {
+	basis := basisOf([]int64{1, 1, 1}, []int64{-1, 0, 2}, []int64{3, 5, 6})
+	if err := ReduceFloat(basis); err != nil {
+		t.Fatal(err)
+	}
+	want := basisOf([]int64{0, 1, 0}, []int64{1, 0, 1}, []int64{-1, 0, 2})
+	if !equalBases(basis, want) {
+		t.Errorf("wanted %v, got %v", want, basis)
+	}
+}
+
+func TestReduceFloatSubsetSum(t *testing.T) {
+	weights := []int64{5783, 7411, 6029, 4813, 7927, 5231}
+	basis := subsetSumBasis(weights, 7411+4813+5231, 8)
+	if err := ReduceFloat(basis); err != nil {
+		t.Fatal(err)
+	}
+	if !hasSolution(basis, []int64{0, 1, 0, 1, 0, 1}) {
+		t.Errorf("the solution isn't in the reduced basis %v", basis)
+	}
+
+	// TestReduceSubsetSum's rows are 2^30 long and nearly parallel, so
+	// orthogonalizing them cancels out all 53 bits
+	weights = []int64{575863, 1037458, 726114, 945281, 319542, 883207}
+	basis = subsetSumBasis(weights, 575863+726114+883207, 1000)
+	if err := ReduceFloat(basis); !errors.Is(err, ErrPrecision) {
+		t.Errorf("wanted ErrPrecision, got %v", err)
+	}
+}
+
+func TestReduceFloatRandomBases(t *testing.T) {
+	random := rand.New(rand.NewSource(3))
+	for dim := 1; dim <= 10; dim++ {
+		for _, bits := range []uint{8, 64, 200} {
+			basis := randomBasis(random, dim, bits)
+			det := gramDeterminant(t, basis)
+			if err := ReduceFloat(basis); err != nil {
+				t.Fatalf("dim %d, %d bits: %v", dim, bits, err)
+			}
+			if !IsReduced(basis, big.NewRat(3, 4)) {
+				t.Errorf("dim %d, %d bits: basis isn't reduced", dim, bits)
+			}
+			if gramDeterminant(t, basis).Cmp(det) != 0 {
+				t.Errorf("dim %d, %d bits: reduction changed the lattice", dim, bits)
+			}
+		}
+	}
+}
+
+func TestReduceFloatErrors(t *testing.T) {
+	huge := new(big.Int).Lsh(big.NewInt(1), 600)
+	overflow := [][]*big.Int{{huge, big.NewInt(1)}, {big.NewInt(1), huge}}
+	if err := ReduceFloat(overflow); !errors.Is(err, ErrPrecision) {
+		t.Errorf("wanted ErrPrecision, got %v", err)
+	}
+	if err := ReduceFloat(basisOf([]int64{1, 2}, []int64{2, 4})); !errors.Is(err, ErrDependent) {
+		t.Errorf("wanted ErrDependent, got %v", err)
+	}
+	if err := ReduceFloat(basisOf([]int64{1, 2}, []int64{3})); !errors.Is(err, ErrInvalidBasis) {
+		t.Errorf("wanted ErrInvalidBasis, got %v", err)
+	}
+	for _, delta := range []float64{0.25, 1, math.NaN(), math.Inf(1)} {
+		if err := ReduceFloatWithDelta(basisOf([]int64{1}), delta); !errors.Is(err, ErrInvalidDelta) {
+			t.Errorf("delta %v: wanted ErrInvalidDelta, got %v", delta, err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package lll
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// GramSchmidt returns the Gram–Schmidt orthogonalization of the rows of
+// `basis`, computed exactly: ortho[i] = b_i - sum(mu[i][j] * ortho[j]) over
+// j < i, with mu[i][j] = <b_i, ortho[j]> / <ortho[j], ortho[j]>. The vectors
+// aren't normalized. mu[i][j] is nil for j >= i.
+func GramSchmidt(basis [][]*big.Int) ([][]*big.Rat, [][]*big.Rat, error) {
+	if err := checkBasis(basis); err != nil {
+		return nil, nil, err
+	}
+	n := len(basis)
+	ortho := make([][]*big.Rat, n)
+	mu := make([][]*big.Rat, n)
+	norms := make([]*big.Rat, n)
+	for i, row := range basis {
+		mu[i] = make([]*big.Rat, n)
+		ortho[i] = make([]*big.Rat, len(row))
+		for col, v := range row {
+			ortho[i][col] = new(big.Rat).SetInt(v)
+		}
+		for j := 0; j < i; j++ {
+			mu[i][j] = new(big.Rat).Quo(ratDot(ortho[i], ortho[j]), norms[j])
+			for col := range ortho[i] {
+				ortho[i][col].Sub(ortho[i][col], new(big.Rat).Mul(mu[i][j], ortho[j][col]))
+			}
+		}
+		norms[i] = ratDot(ortho[i], ortho[i])
+		if norms[i].Sign() == 0 {
+			return nil, nil, fmt.Errorf("%w: row %d", ErrDependent, i)
+		}
+	}
+	return ortho, mu, nil
+}
+
+// IsReduced reports whether the rows of `basis` are LLL-reduced for `delta`:
+// every |mu[i][j]| <= 1/2, and |ortho[k]|^2 >= (delta - mu[k][k-1]^2) * |ortho[k-1]|^2
+// (see GramSchmidt). Bases GramSchmidt rejects aren't reduced.
+func IsReduced(basis [][]*big.Int, delta *big.Rat) bool {
+	ortho, mu, err := GramSchmidt(basis)
+	if err != nil {
+		return false
+	}
+	half := big.NewRat(1, 2)
+	for i := range basis {
+		for j := 0; j < i; j++ {
+			if new(big.Rat).Abs(mu[i][j]).Cmp(half) > 0 {
+				return false
+			}
+		}
+		if i == 0 {
+			continue
+		}
+		bound := new(big.Rat).Mul(mu[i][i-1], mu[i][i-1])
+		bound.Sub(delta, bound).Mul(bound, ratDot(ortho[i-1], ortho[i-1]))
+		if ratDot(ortho[i], ortho[i]).Cmp(bound) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Dot returns the dot product of a and b, which must be the same length
+func Dot(a, b []*big.Int) *big.Int {
+	out := new(big.Int)
+	for idx, v := range a {
+		out.Add(out, new(big.Int).Mul(v, b[idx]))
+	}
+	return out
+}
+
+// returns the dot product of a and b
+func ratDot(a, b []*big.Rat) *big.Rat {
+	out := new(big.Rat)
+	for idx, v := range a {
+		out.Add(out, new(big.Rat).Mul(v, b[idx]))
+	}
+	return out
+}
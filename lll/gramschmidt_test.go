@@ -0,0 +1,60 @@
+package lll
+
+import (
+	"errors"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+func TestGramSchmidt(t *testing.T) {
+	ortho, mu, err := GramSchmidt(basisOf([]int64{3, 1}, []int64{2, 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// mu = <(2, 2), (3, 1)> / <(3, 1), (3, 1)> = 8/10; (2, 2) - 4/5 * (3, 1) = (-2/5, 6/5)
+	want := [][]*big.Rat{{big.NewRat(3, 1), big.NewRat(1, 1)}, {big.NewRat(-2, 5), big.NewRat(6, 5)}}
+	for i := range want {
+		for j := range want[i] {
+			if ortho[i][j].Cmp(want[i][j]) != 0 {
+				t.Errorf("wanted %v, got %v", want, ortho)
+			}
+		}
+	}
+	if mu[1][0].Cmp(big.NewRat(4, 5)) != 0 || mu[0][0] != nil || mu[1][1] != nil {
+		t.Errorf("wanted mu[1][0] = 4/5 and no other coefficients, got %v", mu)
+	}
+
+	// the orthogonalized rows are orthogonal
+	ortho, _, err = GramSchmidt(randomBasis(rand.New(rand.NewSource(4)), 6, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range ortho {
+		for j := 0; j < i; j++ {
+			if ratDot(ortho[i], ortho[j]).Sign() != 0 {
+				t.Errorf("rows %d and %d aren't orthogonal", i, j)
+			}
+		}
+	}
+
+	if _, _, err := GramSchmidt(basisOf([]int64{1, 2, 3}, []int64{2, 4, 6})); !errors.Is(err, ErrDependent) {
+		t.Errorf("wanted ErrDependent, got %v", err)
+	}
+}
+
+func TestIsReduced(t *testing.T) {
+	if IsReduced(basisOf([]int64{1, 1, 1}, []int64{-1, 0, 2}, []int64{3, 5, 6}), big.NewRat(3, 4)) {
+		t.Error("unreduced basis reported as reduced")
+	}
+	if !IsReduced(basisOf([]int64{0, 1, 0}, []int64{1, 0, 1}, []int64{-1, 0, 2}), big.NewRat(3, 4)) {
+		t.Error("reduced basis reported as unreduced")
+	}
+	// size reduced, but swapping would shrink the first vector by too much
+	if IsReduced(basisOf([]int64{4, 0}, []int64{0, 1}), big.NewRat(3, 4)) {
+		t.Error("basis failing the Lovász condition reported as reduced")
+	}
+	if IsReduced(basisOf([]int64{1, 2}, []int64{2, 4}), big.NewRat(3, 4)) {
+		t.Error("dependent basis reported as reduced")
+	}
+}
@@ -0,0 +1,178 @@
+// Package lll implements Lenstra–Lenstra–Lovász lattice basis reduction, the
+// tool behind most attacks on knapsack cryptosystems. A basis is a slice of
+// rows, each a vector of integers; reduction works on the rows in place and
+// leaves a basis of the same lattice whose vectors are short and nearly
+// orthogonal.
+package lll
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var (
+	// ErrInvalidBasis means a basis is empty, has a nil entry, or has rows of
+	// different lengths
+	ErrInvalidBasis = errors.New("invalid lattice basis")
+	// ErrDependent means the rows of a basis are linearly dependent
+	ErrDependent = errors.New("basis rows are linearly dependent")
+	// ErrInvalidDelta means the Lovász constant isn't in (1/4, 1)
+	ErrInvalidDelta = errors.New("delta must be between 1/4 and 1")
+)
+
+// Reduce LLL-reduces the rows of `basis` in place with delta = 3/4, the
+// Lovász constant from the original paper. The rows must be linearly
+// independent; if they aren't, it fails with ErrDependent and the basis is left
+// part way through reduction (still spanning the same lattice).
+func Reduce(basis [][]*big.Int) error {
+	return ReduceWithDelta(basis, big.NewRat(3, 4))
+}
+
+// ReduceWithDelta LLL-reduces the rows of `basis` in place, swapping rows k - 1
+// and k while |ortho[k]|^2 < (delta - mu[k][k-1]^2) * |ortho[k-1]|^2 (see
+// GramSchmidt). A larger delta gives a shorter basis in more steps.
+//
+// It's the integral version of the algorithm (Cohen, "A Course in Computational
+// Algebraic Number Theory", 2.6.7): instead of the rational Gram–Schmidt
+// coefficients it keeps d_i, the Gram determinant of the first i rows, and
+// lambda[i][j] = d_(j+1) * mu[i][j], which are all integers, so it's exact
+// without the cost of big.Rat.
+func ReduceWithDelta(basis [][]*big.Int, delta *big.Rat) error {
+	if err := checkBasis(basis); err != nil {
+		return err
+	}
+	if err := checkDelta(delta); err != nil {
+		return err
+	}
+	n := len(basis)
+	d := make([]*big.Int, n+1)
+	d[0] = big.NewInt(1)
+	lambda := make([][]*big.Int, n)
+	for i := range lambda {
+		lambda[i] = make([]*big.Int, n)
+		for j := range lambda[i] {
+			lambda[i][j] = new(big.Int)
+		}
+	}
+
+	// incremental Gram–Schmidt of row k against the rows before it
+	kmax := 0
+	addRow := func(k int) error {
+		for j := 0; j <= k; j++ {
+			u := Dot(basis[k], basis[j])
+			for i := 0; i < j; i++ {
+				u.Mul(u, d[i+1])
+				u.Sub(u, new(big.Int).Mul(lambda[k][i], lambda[j][i]))
+				u.Quo(u, d[i])
+			}
+			if j < k {
+				lambda[k][j] = u
+			} else {
+				d[k+1] = u
+			}
+		}
+		if d[k+1].Sign() == 0 {
+			return fmt.Errorf("%w: row %d", ErrDependent, k)
+		}
+		return nil
+	}
+	// subtracts the multiple of row l from row k that leaves |mu[k][l]| <= 1/2
+	reduce := func(k, l int) {
+		twice := new(big.Int).Lsh(lambda[k][l], 1)
+		if twice.CmpAbs(d[l+1]) <= 0 {
+			return
+		}
+		// q = round(lambda / d_(l+1)) = floor((2 * lambda + d_(l+1)) / (2 * d_(l+1)))
+		twice.Add(twice, d[l+1])
+		q := twice.Div(twice, new(big.Int).Lsh(d[l+1], 1))
+		for col := range basis[k] {
+			basis[k][col].Sub(basis[k][col], new(big.Int).Mul(q, basis[l][col]))
+		}
+		lambda[k][l].Sub(lambda[k][l], new(big.Int).Mul(q, d[l+1]))
+		for i := 0; i < l; i++ {
+			lambda[k][i].Sub(lambda[k][i], new(big.Int).Mul(q, lambda[l][i]))
+		}
+	}
+	// swaps rows k - 1 and k
+	swap := func(k int) {
+		basis[k], basis[k-1] = basis[k-1], basis[k]
+		for j := 0; j < k-1; j++ {
+			lambda[k][j], lambda[k-1][j] = lambda[k-1][j], lambda[k][j]
+		}
+		lam := lambda[k][k-1]
+		// the new d_k is (d_(k-1) * d_(k+1) + lambda^2) / d_k
+		b := new(big.Int).Mul(d[k-1], d[k+1])
+		b.Add(b, new(big.Int).Mul(lam, lam))
+		b.Quo(b, d[k])
+		for i := k + 1; i <= kmax; i++ {
+			t := lambda[i][k]
+			next := new(big.Int).Mul(d[k+1], lambda[i][k-1])
+			next.Sub(next, new(big.Int).Mul(lam, t))
+			lambda[i][k] = next.Quo(next, d[k])
+			prev := new(big.Int).Mul(b, t)
+			prev.Add(prev, new(big.Int).Mul(lam, lambda[i][k]))
+			lambda[i][k-1] = prev.Quo(prev, d[k+1])
+		}
+		d[k] = b
+	}
+
+	if err := addRow(0); err != nil {
+		return err
+	}
+	p, q := delta.Num(), delta.Denom()
+	for k := 1; k < n; {
+		if k > kmax {
+			kmax = k
+			if err := addRow(k); err != nil {
+				return err
+			}
+		}
+		reduce(k, k-1)
+		// the Lovász condition times d_k^2 / delta's denominator:
+		// q * (d_(k+1) * d_(k-1) + lambda^2) >= p * d_k^2
+		lhs := new(big.Int).Mul(d[k+1], d[k-1])
+		lhs.Add(lhs, new(big.Int).Mul(lambda[k][k-1], lambda[k][k-1]))
+		lhs.Mul(lhs, q)
+		rhs := new(big.Int).Mul(d[k], d[k])
+		rhs.Mul(rhs, p)
+		if lhs.Cmp(rhs) < 0 {
+			swap(k)
+			if k > 1 {
+				k--
+			}
+			continue
+		}
+		for l := k - 2; l >= 0; l-- {
+			reduce(k, l)
+		}
+		k++
+	}
+	return nil
+}
+
+// checkBasis makes sure `basis` has rows, all of the same length, and no nil entries
+func checkBasis(basis [][]*big.Int) error {
+	if len(basis) == 0 || len(basis[0]) == 0 {
+		return fmt.Errorf("%w: no vectors", ErrInvalidBasis)
+	}
+	for i, row := range basis {
+		if len(row) != len(basis[0]) {
+			return fmt.Errorf("%w: row %d has %d entries, row 0 has %d", ErrInvalidBasis, i, len(row), len(basis[0]))
+		}
+		for j, v := range row {
+			if v == nil {
+				return fmt.Errorf("%w: entry (%d, %d) is nil", ErrInvalidBasis, i, j)
+			}
+		}
+	}
+	return nil
+}
+
+// checkDelta makes sure 1/4 < delta < 1
+func checkDelta(delta *big.Rat) error {
+	if delta == nil || delta.Cmp(big.NewRat(1, 4)) <= 0 || delta.Cmp(big.NewRat(1, 1)) >= 0 {
+		return fmt.Errorf("%w: %v", ErrInvalidDelta, delta)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package lll
+
+import (
+	"errors"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+// returns a basis from rows of int64s
+func basisOf(rows ...[]int64) [][]*big.Int {
+	basis := make([][]*big.Int, len(rows))
+	for i, row := range rows {
+		basis[i] = make([]*big.Int, len(row))
+		for j, v := range row {
+			basis[i][j] = big.NewInt(v)
+		}
+	}
+	return basis
+}
+
+// returns a dim x dim basis with random entries of up to `bits` bits, whose
+// rows are almost surely independent
+func randomBasis(random *rand.Rand, dim int, bits uint) [][]*big.Int {
+	basis := make([][]*big.Int, dim)
+	max := new(big.Int).Lsh(big.NewInt(1), bits)
+	for i := range basis {
+		basis[i] = make([]*big.Int, dim)
+		for j := range basis[i] {
+			basis[i][j] = new(big.Int).Rand(random, max)
+			if random.Intn(2) == 0 {
+				basis[i][j].Neg(basis[i][j])
+			}
+		}
+	}
+	return basis
+}
+
+// returns the Gram determinant of the rows of basis: the squared volume of
+// their lattice, which reduction doesn't change
+func gramDeterminant(t *testing.T, basis [][]*big.Int) *big.Rat {
+	ortho, _, err := GramSchmidt(basis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	det := big.NewRat(1, 1)
+	for _, v := range ortho {
+		det.Mul(det, ratDot(v, v))
+	}
+	return det
+}
+
+func copyBasis(basis [][]*big.Int) [][]*big.Int {
+	out := make([][]*big.Int, len(basis))
+	for i, row := range basis {
+		out[i] = make([]*big.Int, len(row))
+		for j, v := range row {
+			out[i][j] = new(big.Int).Set(v)
+		}
+	}
+	return out
+}
+
+func equalBases(a, b [][]*big.Int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		for j := range a[i] {
+			if a[i][j].Cmp(b[i][j]) != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestReduceKnownBasis(t *testing.T) {
+	// the example from Wikipedia's article on the LLL algorithm
+	basis := basisOf([]int64{1, 1, 1}, []int64{-1, 0, 2}, []int64{3, 5, 6})
+	if err := Reduce(basis); err != nil {
+		t.Fatal(err)
+	}
+	want := basisOf([]int64{0, 1, 0}, []int64{1, 0, 1}, []int64{-1, 0, 2})
+	if !equalBases(basis, want) {
+		t.Errorf("wanted %v, got %v", want, basis)
+	}
+
+	// an already reduced basis is left alone
+	identity := basisOf([]int64{1, 0, 0}, []int64{0, 1, 0}, []int64{0, 0, 1})
+	if err := Reduce(identity); err != nil {
+		t.Fatal(err)
+	}
+	if !equalBases(identity, basisOf([]int64{1, 0, 0}, []int64{0, 1, 0}, []int64{0, 0, 1})) {
+		t.Errorf("identity changed to %v", identity)
+	}
+}
+
+// returns the Lagarias–Odlyzko lattice for the knapsack (weights, s): the
+// rows (e_i, scale * a_i) and (0, -scale * s), in which a solution x gives the
+// short vector (x, 0)
+func subsetSumBasis(weights []int64, s, scale int64) [][]*big.Int {
+	n := len(weights)
+	rows := make([][]int64, n+1)
+	for i := range rows {
+		rows[i] = make([]int64, n+1)
+		if i < n {
+			rows[i][i] = 1
+			rows[i][n] = scale * weights[i]
+		} else {
+			rows[i][n] = -scale * s
+		}
+	}
+	return basisOf(rows...)
+}
+
+// returns whether ±(solution, 0) is a row of basis
+func hasSolution(basis [][]*big.Int, solution []int64) bool {
+	n := len(solution)
+	for _, row := range basis {
+		sign := int64(1)
+		if row[0].Sign() < 0 {
+			sign = -1
+		}
+		match := row[n].Sign() == 0
+		for i, x := range solution {
+			match = match && row[i].Int64()*sign == x
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReduceSubsetSum(t *testing.T) {
+	// a low density knapsack (density 6/20) is solved by reduction alone
+	weights := []int64{575863, 1037458, 726114, 945281, 319542, 883207}
+	basis := subsetSumBasis(weights, 575863+726114+883207, 1000)
+	if err := Reduce(basis); err != nil {
+		t.Fatal(err)
+	}
+	if !hasSolution(basis, []int64{1, 0, 1, 0, 0, 1}) {
+		t.Errorf("the solution isn't in the reduced basis %v", basis)
+	}
+}
+
+func TestReduceRandomBases(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for dim := 1; dim <= 8; dim++ {
+		for _, bits := range []uint{8, 64, 200} {
+			basis := randomBasis(random, dim, bits)
+			det := gramDeterminant(t, basis)
+			if err := Reduce(basis); err != nil {
+				t.Fatalf("dim %d, %d bits: %v", dim, bits, err)
+			}
+			if !IsReduced(basis, big.NewRat(3, 4)) {
+				t.Errorf("dim %d, %d bits: basis isn't reduced", dim, bits)
+			}
+			if gramDeterminant(t, basis).Cmp(det) != 0 {
+				t.Errorf("dim %d, %d bits: reduction changed the lattice", dim, bits)
+			}
+		}
+	}
+}
+
+func TestReduceWithDelta(t *testing.T) {
+	random := rand.New(rand.NewSource(2))
+	delta := big.NewRat(99, 100)
+	for dim := 2; dim <= 8; dim++ {
+		basis := randomBasis(random, dim, 100)
+		loose := copyBasis(basis)
+		if err := ReduceWithDelta(basis, delta); err != nil {
+			t.Fatal(err)
+		}
+		if !IsReduced(basis, delta) {
+			t.Errorf("dim %d: basis isn't reduced for delta = %v", dim, delta)
+		}
+		// a larger delta never leaves a longer first vector
+		if err := Reduce(loose); err != nil {
+			t.Fatal(err)
+		}
+		if Dot(basis[0], basis[0]).Cmp(Dot(loose[0], loose[0])) > 0 {
+			t.Errorf("dim %d: delta = %v gave a longer first vector than 3/4", dim, delta)
+		}
+	}
+}
+
+func TestReduceErrors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		basis [][]*big.Int
+		delta *big.Rat
+		want  error
+	}{
+		{"empty", nil, big.NewRat(3, 4), ErrInvalidBasis},
+		{"empty rows", [][]*big.Int{{}}, big.NewRat(3, 4), ErrInvalidBasis},
+		{"ragged", basisOf([]int64{1, 2}, []int64{3}), big.NewRat(3, 4), ErrInvalidBasis},
+		{"nil entry", [][]*big.Int{{big.NewInt(1), nil}}, big.NewRat(3, 4), ErrInvalidBasis},
+		{"dependent", basisOf([]int64{1, 2}, []int64{2, 4}), big.NewRat(3, 4), ErrDependent},
+		{"more rows than columns", basisOf([]int64{1, 0}, []int64{0, 1}, []int64{1, 1}), big.NewRat(3, 4), ErrDependent},
+		{"zero row", basisOf([]int64{0, 0}), big.NewRat(3, 4), ErrDependent},
+		{"delta 1/4", basisOf([]int64{1}), big.NewRat(1, 4), ErrInvalidDelta},
+		{"delta 1", basisOf([]int64{1}), big.NewRat(1, 1), ErrInvalidDelta},
+		{"nil delta", basisOf([]int64{1}), nil, ErrInvalidDelta},
+	}
+	for _, tc := range testCases {
+		if err := ReduceWithDelta(tc.basis, tc.delta); !errors.Is(err, tc.want) {
+			t.Errorf("%s: wanted %v, got %v", tc.name, tc.want, err)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package knapsack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+// LPS is the subset sum encryption of Lyubashevsky, Palacio and Segev
+// ("Public-Key Cryptographic Primitives Provably as Secure as Subset Sum",
+// 2010). Unlike Merkle-Hellman there's no trapdoor hidden in the weights: they
+// are uniformly random mod Q^Digits, and breaking the scheme is as hard as
+// solving random subset sum instances like them.
+//
+// Writing a number mod Q^Digits as its Digits base-Q digits (lowest first)
+// turns the weights into the columns of a Digits x n matrix A over Z_Q. The
+// public target T = sum(s_i a_i) is then A s + e, where e holds the carries
+// between digits, each in [0, n). A bit z is encrypted with random bits r as
+//
+//   u = r A,  c = r T + z Q/2   (mod Q)
+//
+// and c - u s = r e + z Q/2, where r e < Digits * n < Q/4, so it's close to 0
+// for z = 0 and close to Q/2 for z = 1.
+
+// lpsHashSlack is added to the number of digits so the leftover hash lemma
+// makes (u, c) within 2^-64 of uniform
+const lpsHashSlack = 128
+
+var (
+	// ErrInvalidLPSParameters means an LPS key's Q and Digits aren't the ones
+	// NewLPS picks for its length
+	ErrInvalidLPSParameters = errors.New("LPS digit modulus and digits don't match the key length")
+	// ErrInvalidSecret means an LPS secret has a bit that isn't 0 or 1
+	ErrInvalidSecret = errors.New("secret bits must be 0 or 1")
+)
+
+// LPS contains the secret subset and public weights of an LPS key
+type LPS struct {
+	PublicKey []*big.Int // random weights mod Q^Digits
+	T         *big.Int   // sum of the weights S selects, mod Q^Digits
+	Q         int64      // digit modulus, a power of two more than 4 * Digits * n
+	Digits    int64      // base Q digits per weight
+	S         []byte     // secret subset, one bit per weight
+}
+
+// NewLPS generates an LPS key with an `n` bit secret
+func NewLPS(n int64) (*LPS, error) {
+	return NewLPSWithReader(rand.Reader, n)
+}
+
+// NewLPSWithReader generates an LPS key with an `n` bit secret using
+// randomness read from `random`. Passing a deterministic reader (see
+// NewSeededReader) regenerates the same key every time.
+func NewLPSWithReader(random io.Reader, n int64) (*LPS, error) {
+	if n < 1 {
+		return nil, errors.New("key length must be > 0")
+	}
+	q, digits := lpsParams(n)
+	modulus := lpsModulus(q, digits)
+
+	weights := make([]*big.Int, n)
+	for i := range weights {
+		w, err := randomInt(random, modulus)
+		if err != nil {
+			return nil, err
+		}
+		weights[i] = w
+	}
+	s, err := randomBits(random, int(n))
+	if err != nil {
+		return nil, err
+	}
+
+	l := &LPS{
+		PublicKey: weights,
+		Q:         q,
+		Digits:    digits,
+		S:         s,
+	}
+	l.T = l.DeriveTarget()
+	return l, nil
+}
+
+// lpsParams returns the smallest power of two Q and the number of digits for
+// an n bit secret: enough digits for the leftover hash lemma, and Q large
+// enough for the carries not to flip a bit
+func lpsParams(n int64) (q, digits int64) {
+	for bits := uint(1); ; bits++ {
+		q = int64(1) << bits
+		digits = (n+1)*int64(bits) + lpsHashSlack
+		if 4*digits*n < q {
+			return q, digits
+		}
+	}
+}
+
+// lpsParamsValid checks q and digits are the ones lpsParams picks for n bits.
+// Nothing else is accepted, so a key file can't make us work with huge numbers.
+func lpsParamsValid(n, q, digits int64) bool {
+	wantQ, wantDigits := lpsParams(n)
+	return q == wantQ && digits == wantDigits
+}
+
+// returns Q^Digits
+func lpsModulus(q, digits int64) *big.Int {
+	return new(big.Int).Exp(big.NewInt(q), big.NewInt(digits), nil)
+}
+
+// DeriveTarget computes the public target T from the weights and secret
+func (l *LPS) DeriveTarget() *big.Int {
+	t := new(big.Int)
+	for i, bit := range l.S {
+		if bit == 1 {
+			t.Add(t, l.PublicKey[i])
+		}
+	}
+	return t.Mod(t, lpsModulus(l.Q, l.Digits))
+}
+
+// Validate checks the structural invariants of the key and reports the first
+// one that fails. T is only checked if it's present.
+func (l *LPS) Validate() error {
+	if len(l.PublicKey) == 0 {
+		return fmt.Errorf("%w: weights", ErrMissingParameter)
+	}
+	if !lpsParamsValid(int64(len(l.PublicKey)), l.Q, l.Digits) {
+		return fmt.Errorf("%w: %d digits mod %d for %d weights", ErrInvalidLPSParameters, l.Digits, l.Q, len(l.PublicKey))
+	}
+	if len(l.S) != len(l.PublicKey) {
+		return fmt.Errorf("%w: secret has %d bits for %d weights", ErrMissingParameter, len(l.S), len(l.PublicKey))
+	}
+	for idx, bit := range l.S {
+		if bit > 1 {
+			return fmt.Errorf("%w: secret bit %d is %d", ErrInvalidSecret, idx, bit)
+		}
+	}
+	modulus := lpsModulus(l.Q, l.Digits)
+	for idx, w := range l.PublicKey {
+		if w == nil || w.Sign() < 0 || w.Cmp(modulus) >= 0 {
+			return fmt.Errorf("%w: weight %d is not in [0, Q^digits)", ErrInvalidPublicKey, idx)
+		}
+	}
+
+	if l.T != nil && l.T.Cmp(l.DeriveTarget()) != 0 {
+		return fmt.Errorf("%w: target", ErrPublicKeyMismatch)
+	}
+	return nil
+}
+
+// EncryptBytesLPS encrypts `messageBytes` for an LPS public key: the
+// `weights`, `target`, digit modulus `q` and number of `digits`. Every bit
+// (and the padding) is encrypted separately with random bits read from
+// `random`; nil means crypto/rand.
+func EncryptBytesLPS(random io.Reader, weights []*big.Int, target *big.Int, q, digits int64, messageBytes []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	e := NewLPSEncryptor(&buf, weights, target, q, digits)
+	if random != nil {
+		e.Rand = random
+	}
+	if _, err := e.Write(messageBytes); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// NewLPSEncryptor returns an Encryptor in ModeLPS writing ciphertext for an
+// LPS public key to `w`. Each block is a single message bit.
+func NewLPSEncryptor(w io.Writer, weights []*big.Int, target *big.Int, q, digits int64) *Encryptor {
+	capacity := 0 // rejected when encryption starts
+	var a [][]int64
+	var t []int64
+	if len(weights) > 0 && target != nil && lpsParamsValid(int64(len(weights)), q, digits) {
+		capacity = 1
+		a = make([][]int64, len(weights))
+		for i, w := range weights {
+			a[i] = toDigits(w, q, digits)
+		}
+		t = toDigits(target, q, digits)
+	}
+
+	e := newSchemeEncryptor(w, ModeLPS, capacity, func(bits []byte) (*big.Int, error) {
+		return encryptLPS(a, t, q, bits[0], bits[1:]), nil
+	})
+	// the random subset r is chosen in order with the rest of the randomness,
+	// so a seeded Rand gives the same ciphertext
+	e.mask = func(bits []byte) ([]byte, error) {
+		r, err := randomBits(e.Rand, int(digits))
+		if err != nil {
+			return nil, err
+		}
+		return append(append([]byte(nil), bits...), r...), nil
+	}
+	return e
+}
+
+// returns (u, c) for bit z and random subset r of the digits, packed as the
+// base q digits c, u_0, u_1, ...
+func encryptLPS(a [][]int64, t []int64, q int64, z byte, r []byte) *big.Int {
+	u := make([]int64, len(a))
+	for i, column := range a {
+		for j, bit := range r {
+			if bit == 1 {
+				u[i] += column[j]
+			}
+		}
+		u[i] %= q
+	}
+	var c int64
+	for j, bit := range r {
+		if bit == 1 {
+			c += t[j]
+		}
+	}
+	c = (c + int64(z)*(q/2)) % q
+
+	ct := new(big.Int)
+	bigQ := big.NewInt(q)
+	for i := len(u) - 1; i >= 0; i-- {
+		ct.Mul(ct, bigQ).Add(ct, big.NewInt(u[i]))
+	}
+	return ct.Mul(ct, bigQ).Add(ct, big.NewInt(c))
+}
+
+// DecryptBytes decrypts the output of EncryptBytesLPS
+func (l *LPS) DecryptBytes(ct []byte) ([]byte, error) {
+	return ioutil.ReadAll(NewLPSDecryptor(bytes.NewReader(ct), l))
+}
+
+// NewLPSDecryptor returns a Decryptor reading LPS ciphertext from `r` and
+// decrypting it with `l`
+func NewLPSDecryptor(r io.Reader, l *LPS) *Decryptor {
+	return newSchemeDecryptor(r, formatLPS, l.decryptBits)
+}
+
+// returns the single bit of a block: c - u s is within Q/4 of z Q/2
+func (l *LPS) decryptBits(ct *big.Int) ([]byte, error) {
+	n := int64(len(l.S))
+	if ct.Sign() < 0 || ct.Cmp(lpsModulus(l.Q, n+1)) >= 0 {
+		return nil, ErrNoSolution
+	}
+	digits := toDigits(ct, l.Q, n+1)
+	d := digits[0]
+	for i, bit := range l.S {
+		if bit == 1 {
+			d -= digits[i+1]
+		}
+	}
+	d = mod(d, l.Q)
+	if d >= l.Q/4 && d < 3*l.Q/4 {
+		return []byte{1}, nil
+	}
+	return []byte{0}, nil
+}
+
+// returns the lowest `count` base q digits of n, lowest first
+func toDigits(n *big.Int, q, count int64) []int64 {
+	out := make([]int64, count)
+	rest := new(big.Int).Set(n)
+	bigQ, digit := big.NewInt(q), new(big.Int)
+	for i := range out {
+		rest.QuoRem(rest, bigQ, digit)
+		out[i] = digit.Int64()
+	}
+	return out
+}
+
+// returns `count` random bits
+func randomBits(random io.Reader, count int) ([]byte, error) {
+	buf := make([]byte, (count+7)/8)
+	if _, err := io.ReadFull(random, buf); err != nil {
+		return nil, err
+	}
+	return bytesToBits(buf)[:count], nil
+}
+
+// LPSPublicKey is an LPS public key as a PublicKey
+type LPSPublicKey struct {
+	Key    []*big.Int // weights
+	T      *big.Int   // target
+	Q      int64      // digit modulus
+	Digits int64      // base Q digits per weight
+}
+
+// Elements returns the weights followed by the target
+func (pk *LPSPublicKey) Elements() []*big.Int {
+	return append(append([]*big.Int(nil), pk.Key...), pk.T)
+}
+
+// Public returns the weights, target and digit parameters
+func (l *LPS) Public() PublicKey {
+	return &LPSPublicKey{Key: l.PublicKey, T: l.T, Q: l.Q, Digits: l.Digits}
+}
+
+// LPSScheme is the Cryptosystem for LPS keys, registered as "lps". Encryption
+// is always randomized and for one recipient.
+type LPSScheme struct{}
+
+// Name returns "lps"
+func (LPSScheme) Name() string {
+	return "lps"
+}
+
+// GenerateKey returns a *LPS with a `length` bit secret
+func (LPSScheme) GenerateKey(random io.Reader, length int64) (PrivateKey, error) {
+	return NewLPSWithReader(random, length)
+}
+
+// Encrypt is EncryptBytesLPS
+func (s LPSScheme) Encrypt(random io.Reader, publicKey PublicKey, message []byte) ([]byte, error) {
+	return encryptWith(s, random, publicKey, message, EncryptOptions{})
+}
+
+// Decrypt is LPS.DecryptBytes
+func (s LPSScheme) Decrypt(privateKey PrivateKey, ct []byte) ([]byte, error) {
+	return decryptWith(s, privateKey, ct)
+}
+
+// NewEncryptor returns NewLPSEncryptor. Hybrid and textbook encryption aren't
+// supported, nor are several recipients.
+func (LPSScheme) NewEncryptor(w io.Writer, recipients []PublicKey, opts EncryptOptions) (*Encryptor, error) {
+	if len(recipients) != 1 || opts.Hybrid || opts.Textbook {
+		return nil, errors.New("LPS keys only support randomized encryption for a single recipient")
+	}
+	pk, ok := recipients[0].(*LPSPublicKey)
+	if !ok {
+		return nil, ErrWrongScheme
+	}
+	return NewLPSEncryptor(w, pk.Key, pk.T, pk.Q, pk.Digits), nil
+}
+
+// NewDecryptor returns NewLPSDecryptor
+func (LPSScheme) NewDecryptor(r io.Reader, privateKey PrivateKey) (*Decryptor, error) {
+	l, ok := privateKey.(*LPS)
+	if !ok {
+		return nil, ErrWrongScheme
+	}
+	return NewLPSDecryptor(r, l), nil
+}
+
+// MarshalPublicKey writes an LPSPublicKeyFile
+func (LPSScheme) MarshalPublicKey(publicKey PublicKey) ([]byte, error) {
+	pk, ok := publicKey.(*LPSPublicKey)
+	if !ok {
+		return nil, ErrWrongScheme
+	}
+	return msgpack.Marshal(&LPSPublicKeyFile{
+		PubKey: prepareSliceOfBigs(pk.Key),
+		T:      pk.T.Bytes(),
+		Q:      pk.Q,
+		Digits: pk.Digits,
+	})
+}
+
+// MarshalPrivateKey writes an LPSPrivateKeyFile
+func (LPSScheme) MarshalPrivateKey(privateKey PrivateKey) ([]byte, error) {
+	l, ok := privateKey.(*LPS)
+	if !ok {
+		return nil, ErrWrongScheme
+	}
+	_, priv, err := PackLPS(*l)
+	return priv, err
+}
+
+// UnmarshalPublicKey reads an LPSPublicKeyFile
+func (LPSScheme) UnmarshalPublicKey(b []byte) (PublicKey, error) {
+	if err := checkKeyFields(b, []string{"PubKey", "T", "Q", "Digits"}); err != nil {
+		return nil, err
+	}
+	pkf := &LPSPublicKeyFile{}
+	if err := msgpack.Unmarshal(b, pkf); err != nil {
+		return nil, err
+	}
+	weights, target, q, digits := UnpackLPSPublic(pkf)
+	if len(weights) == 0 || !lpsParamsValid(int64(len(weights)), q, digits) {
+		return nil, fmt.Errorf("%w: %d weights with %d digits mod %d", ErrInvalidPublicKey, len(weights), digits, q)
+	}
+	return &LPSPublicKey{Key: weights, T: target, Q: q, Digits: digits}, nil
+}
+
+// UnmarshalPrivateKey reads an LPSPrivateKeyFile (see UnpackLPSPrivate)
+func (LPSScheme) UnmarshalPrivateKey(b []byte) (PrivateKey, error) {
+	if err := checkKeyFields(b, []string{"PubKey", "Q", "Digits", "S"}); err != nil {
+		return nil, err
+	}
+	skf := &LPSPrivateKeyFile{}
+	if err := msgpack.Unmarshal(b, skf); err != nil {
+		return nil, err
+	}
+	return UnpackLPSPrivate(skf)
+}
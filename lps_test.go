@@ -0,0 +1,196 @@
+package knapsack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+func TestLPSParams(t *testing.T) {
+	for _, n := range []int64{1, 16, 100, 256} {
+		q, digits := lpsParams(n)
+		if q&(q-1) != 0 {
+			t.Errorf("n = %d: Q = %d is not a power of two", n, q)
+		}
+		// decryption is always right if the carries can't reach Q/4
+		if 4*digits*n >= q {
+			t.Errorf("n = %d: Q = %d is too small for %d digits", n, q, digits)
+		}
+		// and (u, c) is close to uniform if r has more bits than it
+		if bits := int64(new(big.Int).SetInt64(q - 1).BitLen()); digits < (n+1)*bits {
+			t.Errorf("n = %d: %d digits is too few for the leftover hash lemma", n, digits)
+		}
+	}
+}
+
+func TestLPSKeygen(t *testing.T) {
+	l, err := NewLPS(32)
+	handleFatalError(err, t)
+	handleFatalError(l.Validate(), t)
+
+	// the target is A s plus carries: digit by digit, it's within n of A s
+	a := make([][]int64, len(l.PublicKey))
+	for i, w := range l.PublicKey {
+		a[i] = toDigits(w, l.Q, l.Digits)
+	}
+	target := toDigits(l.T, l.Q, l.Digits)
+	for j := range target {
+		var as int64
+		for i, bit := range l.S {
+			as += int64(bit) * a[i][j]
+		}
+		if carry := mod(target[j]-as, l.Q); carry >= int64(len(l.S)) {
+			t.Fatalf("digit %d: carry %d is not less than n", j, carry)
+		}
+	}
+}
+
+func TestLPSSeeded(t *testing.T) {
+	a, err := NewLPSWithReader(NewSeededReader([]byte("seed")), 16)
+	handleFatalError(err, t)
+	b, err := NewLPSWithReader(NewSeededReader([]byte("seed")), 16)
+	handleFatalError(err, t)
+	if a.T.Cmp(b.T) != 0 || !bytes.Equal(a.S, b.S) {
+		t.Error("the same seed generated different keys")
+	}
+
+	// seeded encryption is repeatable too
+	msg := []byte("hello")
+	ct1, err := EncryptBytesLPS(NewSeededReader([]byte("r")), a.PublicKey, a.T, a.Q, a.Digits, msg)
+	handleFatalError(err, t)
+	ct2, err := EncryptBytesLPS(NewSeededReader([]byte("r")), a.PublicKey, a.T, a.Q, a.Digits, msg)
+	handleFatalError(err, t)
+	if !bytes.Equal(ct1, ct2) {
+		t.Error("the same seed encrypted differently")
+	}
+}
+
+func TestDecryptLPS(t *testing.T) {
+	for _, n := range []int64{1, 16, 64} {
+		l, err := NewLPS(n)
+		handleFatalError(err, t)
+
+		for _, size := range []int{0, 1, 8, 100} {
+			msg := make([]byte, size)
+			_, err := rand.Read(msg)
+			handleFatalError(err, t)
+
+			ct, err := EncryptBytesLPS(nil, l.PublicKey, l.T, l.Q, l.Digits, msg)
+			handleFatalError(err, t)
+			if ct[0] != formatLPS {
+				t.Fatalf("wanted LPS format byte, got %d", ct[0])
+			}
+			d, err := l.DecryptBytes(ct)
+			if err != nil {
+				t.Fatalf("n = %d, size %d: %v", n, size, err)
+			}
+			if !bytes.Equal(d, msg) {
+				t.Errorf("n = %d, size %d: decrypted message differs", n, size)
+			}
+		}
+	}
+}
+
+func TestEncryptLPSIsRandomized(t *testing.T) {
+	l, err := NewLPS(16)
+	handleFatalError(err, t)
+	ct1, err := EncryptBytesLPS(nil, l.PublicKey, l.T, l.Q, l.Digits, []byte("hello"))
+	handleFatalError(err, t)
+	ct2, err := EncryptBytesLPS(nil, l.PublicKey, l.T, l.Q, l.Digits, []byte("hello"))
+	handleFatalError(err, t)
+	if bytes.Equal(ct1, ct2) {
+		t.Error("encrypting twice gave the same ciphertext")
+	}
+}
+
+func TestDecryptLPSErrors(t *testing.T) {
+	l, err := NewLPS(16)
+	handleFatalError(err, t)
+
+	// a block bigger than n + 1 digits
+	tooBig := lpsModulus(l.Q, int64(len(l.S)+1))
+	_, err = l.DecryptBytes(packCiphertext(formatLPS, []*big.Int{tooBig}))
+	var decErr *DecryptError
+	if !errors.As(err, &decErr) || !errors.Is(err, ErrNoSolution) {
+		t.Errorf("wanted DecryptError wrapping ErrNoSolution, got %v", err)
+	}
+
+	k, err := NewKnapsack(32)
+	handleFatalError(err, t)
+	knapsackCt, err := EncryptBytes(k.PublicKey, []byte("hello"))
+	handleFatalError(err, t)
+	if _, err := l.DecryptBytes(knapsackCt); !errors.Is(err, ErrMalformedCiphertext) {
+		t.Errorf("wanted ErrMalformedCiphertext decrypting with LPS, got %v", err)
+	}
+
+	// the parameters have to be the ones for the key length
+	if _, err := EncryptBytesLPS(nil, l.PublicKey, l.T, l.Q*2, l.Digits, []byte("hello")); err == nil {
+		t.Error("encrypted with the wrong Q")
+	}
+}
+
+func TestValidateLPS(t *testing.T) {
+	l, err := NewLPS(16)
+	handleFatalError(err, t)
+
+	bad := *l
+	bad.Q /= 2
+	if err := bad.Validate(); !errors.Is(err, ErrInvalidLPSParameters) {
+		t.Errorf("wanted ErrInvalidLPSParameters, got %v", err)
+	}
+
+	bad = *l
+	bad.Digits++
+	if err := bad.Validate(); !errors.Is(err, ErrInvalidLPSParameters) {
+		t.Errorf("wanted ErrInvalidLPSParameters, got %v", err)
+	}
+
+	bad = *l
+	bad.S = append([]byte{2}, l.S[1:]...)
+	if err := bad.Validate(); !errors.Is(err, ErrInvalidSecret) {
+		t.Errorf("wanted ErrInvalidSecret, got %v", err)
+	}
+
+	bad = *l
+	bad.PublicKey = append([]*big.Int{lpsModulus(l.Q, l.Digits)}, l.PublicKey[1:]...)
+	if err := bad.Validate(); !errors.Is(err, ErrInvalidPublicKey) {
+		t.Errorf("wanted ErrInvalidPublicKey, got %v", err)
+	}
+
+	bad = *l
+	bad.T = new(big.Int).Add(l.T, big.NewInt(1))
+	if err := bad.Validate(); !errors.Is(err, ErrPublicKeyMismatch) {
+		t.Errorf("wanted ErrPublicKeyMismatch, got %v", err)
+	}
+}
+
+func TestPackUnpackLPS(t *testing.T) {
+	l, err := NewLPS(20)
+	handleFatalError(err, t)
+
+	pubKeyFile, privKeyFile, err := PackLPS(*l)
+	handleFatalError(err, t)
+	a := LPSPublicKeyFile{}
+	b := LPSPrivateKeyFile{}
+	handleFatalError(msgpack.Unmarshal(pubKeyFile, &a), t)
+	handleFatalError(msgpack.Unmarshal(privKeyFile, &b), t)
+
+	weights, target, q, digits := UnpackLPSPublic(&a)
+	unpacked, err := UnpackLPSPrivate(&b)
+	handleFatalError(err, t)
+	if q != l.Q || digits != l.Digits || target.Cmp(l.T) != 0 || unpacked.T.Cmp(l.T) != 0 {
+		t.Error("Q, digits or target unequal")
+	}
+	if !bytes.Equal(unpacked.S, l.S) {
+		t.Error("secret unequal")
+	}
+	for idx, n := range l.PublicKey {
+		if weights[idx].Cmp(n) != 0 || unpacked.PublicKey[idx].Cmp(n) != 0 {
+			t.Fatalf("weight %d unequal", idx)
+		}
+	}
+}
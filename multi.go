@@ -0,0 +1,105 @@
+package knapsack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// Multi-recipient ciphertexts are laid out as:
+//
+//   formatMultiRecipient | version | uvarint count | slots | payload
+//
+// with one slot per recipient:
+//
+//   uvarint ID length | key ID | uvarint length | wrapped key
+//
+// where the key ID is the PublicKeyFingerprint of the recipient's public key
+// and the wrapped key is the payload's AES-256 key encrypted with EncryptBytes
+// for that recipient. The payload is the same as in a hybrid ciphertext.
+
+const (
+	// multiRecipientVersion is the version byte of multi-recipient ciphertexts
+	multiRecipientVersion = 1
+	// maxSlotIDSize bounds the length of a slot's key ID
+	maxSlotIDSize = 64
+)
+
+// EncryptBytesMulti encrypts `messageBytes` so that any of `publicKeys` can
+// decrypt it. The message is encrypted once with a random AES-GCM key (as with
+// EncryptBytesHybrid) and that key is encrypted for each public key.
+func EncryptBytesMulti(random io.Reader, publicKeys [][]*big.Int, messageBytes []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	e := NewMultiEncryptor(&buf, publicKeys)
+	if random != nil {
+		e.Rand = random
+	}
+	if _, err := e.Write(messageBytes); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// appends the version and a slot wrapping `key` for each public key
+func appendRecipients(b []byte, publicKeys [][]*big.Int, key []byte) ([]byte, error) {
+	b = append(b, multiRecipientVersion)
+	b = appendUvarint(b, uint64(len(publicKeys)))
+	for _, publicKey := range publicKeys {
+		if len(publicKey) < 1 {
+			return nil, errors.New("public key must not be empty")
+		}
+		id := PublicKeyFingerprint(publicKey)
+		b = appendUvarint(b, uint64(len(id)))
+		b = append(b, id...)
+		var err error
+		if b, err = appendWrappedKey(b, publicKey, key); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// reads all the slots and returns the wrapped keys of every one labeled
+// `keyID`. key IDs can collide, so there may be more than one to try.
+func readRecipients(r *bufio.Reader, keyID []byte) ([][]byte, error) {
+	version, err := r.ReadByte()
+	if err != nil {
+		return nil, ErrMalformedCiphertext
+	}
+	if version != multiRecipientVersion {
+		return nil, fmt.Errorf("%w: unsupported multi-recipient version %d", ErrMalformedCiphertext, version)
+	}
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, ErrMalformedCiphertext
+	}
+	var found [][]byte
+	for i := uint64(0); i < count; i++ {
+		size, err := binary.ReadUvarint(r)
+		if err != nil || size > maxSlotIDSize {
+			return nil, ErrMalformedCiphertext
+		}
+		id := make([]byte, size)
+		if _, err := io.ReadFull(r, id); err != nil {
+			return nil, ErrMalformedCiphertext
+		}
+		wrapped, err := readWrappedKey(r)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(id, keyID) {
+			found = append(found, wrapped)
+		}
+	}
+	if found == nil {
+		return nil, ErrNotRecipient
+	}
+	return found, nil
+}
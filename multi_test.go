@@ -0,0 +1,108 @@
+package knapsack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestDecryptMulti(t *testing.T) {
+	var keys []*Knapsack
+	var publicKeys [][]*big.Int
+	for _, length := range []int64{8, 64, 100} {
+		k, err := NewKnapsack(length)
+		handleFatalError(err, t)
+		keys = append(keys, k)
+		publicKeys = append(publicKeys, k.PublicKey)
+	}
+
+	msg := bytes.Repeat([]byte("for all of you "), 5000)
+	ct, err := EncryptBytesMulti(rand.Reader, publicKeys, msg)
+	handleFatalError(err, t)
+	if ct[0] != formatMultiRecipient {
+		t.Fatalf("wanted multi-recipient format byte, got %d", ct[0])
+	}
+
+	for i, k := range keys {
+		d, err := k.DecryptBytes(ct)
+		if err != nil {
+			t.Fatalf("recipient %d: %v", i, err)
+		}
+		if !bytes.Equal(d, msg) {
+			t.Errorf("recipient %d: decrypted message differs", i)
+		}
+	}
+
+	outsider, err := NewKnapsack(64)
+	handleFatalError(err, t)
+	if _, err := outsider.DecryptBytes(ct); !errors.Is(err, ErrNotRecipient) {
+		t.Errorf("wanted ErrNotRecipient, got %v", err)
+	}
+}
+
+func TestEncryptMultiErrors(t *testing.T) {
+	k, err := NewKnapsack(16)
+	handleFatalError(err, t)
+
+	if _, err := EncryptBytesMulti(rand.Reader, nil, []byte("hi")); err == nil {
+		t.Error("wanted error with no recipients")
+	}
+	if _, err := EncryptBytesMulti(rand.Reader, [][]*big.Int{k.PublicKey, {}}, []byte("hi")); err == nil {
+		t.Error("wanted error with an empty public key")
+	}
+
+	var buf bytes.Buffer
+	e := NewMultiEncryptor(&buf, [][]*big.Int{k.PublicKey, k.PublicKey})
+	e.Mode = ModeTextbook
+	if _, err := e.Write([]byte("hi")); err == nil {
+		t.Error("wanted error for textbook encryption with several public keys")
+	}
+}
+
+func TestDecryptMultiTruncatedSlots(t *testing.T) {
+	k, err := NewKnapsack(32)
+	handleFatalError(err, t)
+
+	ct, err := EncryptBytesMulti(rand.Reader, [][]*big.Int{k.PublicKey}, []byte("hi"))
+	handleFatalError(err, t)
+	id := PublicKeyFingerprint(k.PublicKey)
+	for _, cut := range []int{1, 2, 3, 4 + len(id)/2, 4 + len(id) + 3} {
+		if _, err := k.DecryptBytes(ct[:cut]); !errors.Is(err, ErrMalformedCiphertext) {
+			t.Errorf("cut at %d: wanted ErrMalformedCiphertext, got %v", cut, err)
+		}
+	}
+}
+
+func TestDecryptMultiCollidingSlots(t *testing.T) {
+	k, err := NewKnapsack(32)
+	handleFatalError(err, t)
+	other, err := NewKnapsack(32)
+	handleFatalError(err, t)
+
+	// two slots labeled with k's fingerprint, the first wrapping a key for someone else
+	msg := []byte("try them all")
+	hybrid, err := EncryptBytesHybrid(rand.Reader, k.PublicKey, msg)
+	handleFatalError(err, t)
+	id := PublicKeyFingerprint(k.PublicKey)
+	ct := []byte{formatMultiRecipient, multiRecipientVersion, 2}
+	ct = appendUvarint(ct, uint64(len(id)))
+	ct = append(ct, id...)
+	ct, err = appendWrappedKey(ct, other.PublicKey, make([]byte, hybridKeySize))
+	handleFatalError(err, t)
+	ct = appendUvarint(ct, uint64(len(id)))
+	ct = append(ct, id...)
+	ct = append(ct, hybrid[1:]...)
+
+	d, err := k.DecryptBytes(ct)
+	handleFatalError(err, t)
+	if !bytes.Equal(d, msg) {
+		t.Errorf("wanted %q, got %q", msg, d)
+	}
+
+	ct[1] = multiRecipientVersion + 1
+	if _, err := k.DecryptBytes(ct); !errors.Is(err, ErrMalformedCiphertext) {
+		t.Errorf("wanted ErrMalformedCiphertext for an unknown version, got %v", err)
+	}
+}
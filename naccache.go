@@ -0,0 +1,352 @@
+package knapsack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+// Naccache–Stern is a multiplicative knapsack ("A New Public-Key Cryptosystem",
+// Naccache and Stern, 1997). The public key is
+//
+//   v_i = p_i^(1/S) mod P
+//
+// for the first n primes p_i, a prime P larger than their product and a
+// secret S coprime to P - 1. A block of bits m is encrypted as
+// c = prod(v_i^m_i) mod P. Raising c to S gives prod(p_i^m_i) mod P, which is
+// less than P and so can be factored over the p_i to recover the bits.
+
+var (
+	// ErrNotPrime means a Naccache–Stern key number that should be prime isn't
+	ErrNotPrime = errors.New("number is not prime")
+	// ErrPrimeProductTooLarge means the product of the small primes isn't less
+	// than the modulus, so decryption wouldn't be unique
+	ErrPrimeProductTooLarge = errors.New("product of the small primes is not less than the modulus")
+	// ErrExponentNotCoprime means gcd(S, P - 1) != 1
+	ErrExponentNotCoprime = errors.New("S is not coprime to P - 1")
+)
+
+// NaccacheStern contains the private data used to generate a Naccache–Stern
+// public key and decrypt messages
+type NaccacheStern struct {
+	PublicKey []*big.Int
+	Primes    []*big.Int // small primes p_i, one per public key element
+	P         *big.Int   // prime modulus, larger than the product of Primes
+	S         *big.Int   // secret exponent, coprime to P - 1
+}
+
+// NewNaccacheStern auto generates Naccache–Stern params for `keyLength` bit blocks
+func NewNaccacheStern(keyLength int64) (*NaccacheStern, error) {
+	return NewNaccacheSternWithReader(rand.Reader, keyLength)
+}
+
+// NewNaccacheSternWithReader generates Naccache–Stern params using randomness
+// read from `random`. Passing a deterministic reader (see NewSeededReader)
+// regenerates the same key every time.
+func NewNaccacheSternWithReader(random io.Reader, keyLength int64) (*NaccacheStern, error) {
+	if keyLength < 1 {
+		return nil, errors.New("key length must be > 0")
+	}
+	primes := smallPrimes(keyLength)
+
+	// any number one bit longer than the product of the primes is larger than it
+	bits := product(primes).BitLen() + 1
+	one := big.NewInt(1)
+	min := new(big.Int).Lsh(one, uint(bits-1))
+	max := new(big.Int).Lsh(one, uint(bits))
+	var p *big.Int
+	for {
+		n, err := randomUniform(random, min, max)
+		if err != nil {
+			return nil, err
+		}
+		if n.SetBit(n, 0, 1).ProbablyPrime(32) {
+			p = n
+			break
+		}
+	}
+
+	// s should be in [ 3, p - 2 ] and invertible mod p - 1
+	pm1 := new(big.Int).Sub(p, one)
+	var s *big.Int
+	for {
+		n, err := randomUniform(random, big.NewInt(3), pm1)
+		if err != nil {
+			return nil, err
+		}
+		if new(big.Int).GCD(nil, nil, n, pm1).Cmp(one) == 0 {
+			s = n
+			break
+		}
+	}
+
+	ns := &NaccacheStern{
+		Primes: primes,
+		P:      p,
+		S:      s,
+	}
+	ns.PublicKey = ns.DerivePublicKey()
+	return ns, nil
+}
+
+// DerivePublicKey computes the public key from the private parameters:
+// v_i = p_i^(1/S) mod P
+func (ns *NaccacheStern) DerivePublicKey() []*big.Int {
+	pm1 := new(big.Int).Sub(ns.P, big.NewInt(1))
+	si := new(big.Int).ModInverse(ns.S, pm1)
+	out := make([]*big.Int, len(ns.Primes))
+	for idx, prime := range ns.Primes {
+		out[idx] = new(big.Int).Exp(prime, si, ns.P)
+	}
+	return out
+}
+
+// Validate checks the structural invariants of the key and reports the first
+// one that fails. The public key is only checked if it's present.
+func (ns *NaccacheStern) Validate() error {
+	if len(ns.Primes) == 0 {
+		return fmt.Errorf("%w: primes", ErrMissingParameter)
+	}
+	if ns.P == nil || ns.S == nil {
+		return fmt.Errorf("%w: P and S are required", ErrMissingParameter)
+	}
+	if !ns.P.ProbablyPrime(20) {
+		return fmt.Errorf("%w: modulus", ErrNotPrime)
+	}
+	seen := make(map[string]bool, len(ns.Primes))
+	for idx, prime := range ns.Primes {
+		if prime == nil || !prime.ProbablyPrime(20) || seen[prime.String()] {
+			return fmt.Errorf("%w: element %d is not a distinct prime", ErrNotPrime, idx)
+		}
+		seen[prime.String()] = true
+	}
+	if product(ns.Primes).Cmp(ns.P) >= 0 {
+		return ErrPrimeProductTooLarge
+	}
+	pm1 := new(big.Int).Sub(ns.P, big.NewInt(1))
+	if new(big.Int).GCD(nil, nil, ns.S, pm1).Cmp(big.NewInt(1)) != 0 {
+		return ErrExponentNotCoprime
+	}
+
+	if ns.PublicKey == nil {
+		return nil
+	}
+	if len(ns.PublicKey) != len(ns.Primes) {
+		return fmt.Errorf("%w: has %d elements, private key has %d", ErrPublicKeyMismatch, len(ns.PublicKey), len(ns.Primes))
+	}
+	for idx, n := range ns.DerivePublicKey() {
+		if ns.PublicKey[idx] == nil || ns.PublicKey[idx].Cmp(n) != 0 {
+			return fmt.Errorf("%w: element %d", ErrPublicKeyMismatch, idx)
+		}
+	}
+	return nil
+}
+
+// EncryptBytesNaccacheStern encrypts `messageBytes` using a Naccache–Stern
+// `publicKey` and its `modulus` P. Like EncryptBytes, the bits are padded and
+// split into blocks of len(publicKey) bits; the encryption is deterministic.
+func EncryptBytesNaccacheStern(publicKey []*big.Int, modulus *big.Int, messageBytes []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	e := NewNaccacheSternEncryptor(&buf, publicKey, modulus)
+	if _, err := e.Write(messageBytes); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// NewNaccacheSternEncryptor returns an Encryptor in ModeNaccacheStern writing
+// ciphertext for a Naccache–Stern `publicKey` and `modulus` to `w`
+func NewNaccacheSternEncryptor(w io.Writer, publicKey []*big.Int, modulus *big.Int) *Encryptor {
+	return newSchemeEncryptor(w, ModeNaccacheStern, len(publicKey), func(bits []byte) (*big.Int, error) {
+		return encryptNaccacheStern(publicKey, modulus, bits)
+	})
+}
+
+// returns prod(publicKey[i]^bits[i]) mod modulus
+func encryptNaccacheStern(publicKey []*big.Int, modulus *big.Int, bits []byte) (*big.Int, error) {
+	if len(publicKey) < len(bits) {
+		return nil, errors.New("public key must be longer than messageBits")
+	}
+	ct := big.NewInt(1)
+	for idx, bit := range bits {
+		if bit == 1 {
+			ct.Mul(ct, publicKey[idx])
+			ct.Mod(ct, modulus)
+		}
+	}
+	return ct, nil
+}
+
+// DecryptBytes decrypts the output of EncryptBytesNaccacheStern
+func (ns *NaccacheStern) DecryptBytes(ct []byte) ([]byte, error) {
+	return ioutil.ReadAll(NewNaccacheSternDecryptor(bytes.NewReader(ct), ns))
+}
+
+// NewNaccacheSternDecryptor returns a Decryptor reading Naccache–Stern
+// ciphertext from `r` and decrypting it with `ns`
+func NewNaccacheSternDecryptor(r io.Reader, ns *NaccacheStern) *Decryptor {
+	return newSchemeDecryptor(r, formatNaccacheStern, ns.decryptBits)
+}
+
+// returns the bits of a single block: c^S mod P is the product of the primes
+// whose bits are set
+func (ns *NaccacheStern) decryptBits(ct *big.Int) ([]byte, error) {
+	if ct.Sign() <= 0 || ct.Cmp(ns.P) >= 0 {
+		return nil, ErrNoSolution
+	}
+	x := new(big.Int).Exp(ct, ns.S, ns.P)
+	bits := make([]byte, len(ns.Primes))
+	q, r := new(big.Int), new(big.Int)
+	for idx, prime := range ns.Primes {
+		if q.QuoRem(x, prime, r); r.Sign() == 0 {
+			bits[idx] = 1
+			x.Set(q)
+		}
+	}
+	if x.Cmp(big.NewInt(1)) != 0 {
+		return nil, ErrNoSolution
+	}
+	return bits, nil
+}
+
+// returns the first n primes
+func smallPrimes(n int64) []*big.Int {
+	primes := make([]*big.Int, 0, n)
+	for candidate := int64(2); int64(len(primes)) < n; candidate++ {
+		if big.NewInt(candidate).ProbablyPrime(0) {
+			primes = append(primes, big.NewInt(candidate))
+		}
+	}
+	return primes
+}
+
+// reduces the array with multiplication fn
+func product(arr []*big.Int) *big.Int {
+	out := big.NewInt(1)
+	for _, n := range arr {
+		out.Mul(out, n)
+	}
+	return out
+}
+
+// NaccacheSternPublicKey is a Naccache–Stern public key and modulus as a PublicKey
+type NaccacheSternPublicKey struct {
+	Key []*big.Int
+	P   *big.Int // prime modulus
+}
+
+// Elements returns the public key
+func (pk *NaccacheSternPublicKey) Elements() []*big.Int {
+	return pk.Key
+}
+
+// Public returns the public key and modulus
+func (ns *NaccacheStern) Public() PublicKey {
+	return &NaccacheSternPublicKey{Key: ns.PublicKey, P: ns.P}
+}
+
+// NaccacheSternScheme is the Cryptosystem for NaccacheStern keys, registered
+// as "naccache-stern". It only encrypts for one recipient, deterministically.
+type NaccacheSternScheme struct{}
+
+// Name returns "naccache-stern"
+func (NaccacheSternScheme) Name() string {
+	return "naccache-stern"
+}
+
+// GenerateKey returns a *NaccacheStern
+func (NaccacheSternScheme) GenerateKey(random io.Reader, length int64) (PrivateKey, error) {
+	return NewNaccacheSternWithReader(random, length)
+}
+
+// Encrypt is EncryptBytesNaccacheStern; `random` isn't used
+func (s NaccacheSternScheme) Encrypt(random io.Reader, publicKey PublicKey, message []byte) ([]byte, error) {
+	return encryptWith(s, random, publicKey, message, EncryptOptions{})
+}
+
+// Decrypt is NaccacheStern.DecryptBytes
+func (s NaccacheSternScheme) Decrypt(privateKey PrivateKey, ct []byte) ([]byte, error) {
+	return decryptWith(s, privateKey, ct)
+}
+
+// NewEncryptor returns NewNaccacheSternEncryptor. Only textbook encryption for
+// one recipient is supported, so it's also what the zero EncryptOptions mean.
+func (NaccacheSternScheme) NewEncryptor(w io.Writer, recipients []PublicKey, opts EncryptOptions) (*Encryptor, error) {
+	if len(recipients) != 1 || opts.Hybrid || opts.Randomized {
+		return nil, errors.New("Naccache–Stern keys only support textbook encryption for a single recipient")
+	}
+	pk, ok := recipients[0].(*NaccacheSternPublicKey)
+	if !ok {
+		return nil, ErrWrongScheme
+	}
+	return NewNaccacheSternEncryptor(w, pk.Key, pk.P), nil
+}
+
+// NewDecryptor returns NewNaccacheSternDecryptor
+func (NaccacheSternScheme) NewDecryptor(r io.Reader, privateKey PrivateKey) (*Decryptor, error) {
+	ns, ok := privateKey.(*NaccacheStern)
+	if !ok {
+		return nil, ErrWrongScheme
+	}
+	return NewNaccacheSternDecryptor(r, ns), nil
+}
+
+// MarshalPublicKey writes a NaccacheSternPublicKeyFile
+func (NaccacheSternScheme) MarshalPublicKey(publicKey PublicKey) ([]byte, error) {
+	pk, ok := publicKey.(*NaccacheSternPublicKey)
+	if !ok {
+		return nil, ErrWrongScheme
+	}
+	return msgpack.Marshal(&NaccacheSternPublicKeyFile{
+		PubKey: prepareSliceOfBigs(pk.Key),
+		P:      pk.P.Bytes(),
+	})
+}
+
+// MarshalPrivateKey writes a NaccacheSternPrivateKeyFile
+func (NaccacheSternScheme) MarshalPrivateKey(privateKey PrivateKey) ([]byte, error) {
+	ns, ok := privateKey.(*NaccacheStern)
+	if !ok {
+		return nil, ErrWrongScheme
+	}
+	_, priv, err := PackNaccacheStern(*ns)
+	return priv, err
+}
+
+// UnmarshalPublicKey reads a NaccacheSternPublicKeyFile
+func (NaccacheSternScheme) UnmarshalPublicKey(b []byte) (PublicKey, error) {
+	if err := checkKeyFields(b, []string{"PubKey", "P"}); err != nil {
+		return nil, err
+	}
+	pkf := &NaccacheSternPublicKeyFile{}
+	if err := msgpack.Unmarshal(b, pkf); err != nil {
+		return nil, err
+	}
+	pk, modulus := UnpackNaccacheSternPublic(pkf)
+	if err := ValidatePublicKey(pk); err != nil {
+		return nil, err
+	}
+	return &NaccacheSternPublicKey{Key: pk, P: modulus}, nil
+}
+
+// UnmarshalPrivateKey reads a NaccacheSternPrivateKeyFile (see
+// UnpackNaccacheSternPrivate)
+func (NaccacheSternScheme) UnmarshalPrivateKey(b []byte) (PrivateKey, error) {
+	if err := checkKeyFields(b, []string{"Primes", "P", "S"}); err != nil {
+		return nil, err
+	}
+	skf := &NaccacheSternPrivateKeyFile{}
+	if err := msgpack.Unmarshal(b, skf); err != nil {
+		return nil, err
+	}
+	return UnpackNaccacheSternPrivate(skf)
+}
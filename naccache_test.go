@@ -0,0 +1,159 @@
+package knapsack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+func TestSmallPrimes(t *testing.T) {
+	got := smallPrimes(10)
+	want := intsToBigs([]int64{2, 3, 5, 7, 11, 13, 17, 19, 23, 29})
+	for i := range want {
+		if got[i].Cmp(want[i]) != 0 {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestNaccacheSternKeygen(t *testing.T) {
+	ns, err := NewNaccacheStern(40)
+	handleFatalError(err, t)
+	handleFatalError(ns.Validate(), t)
+
+	if product(ns.Primes).Cmp(ns.P) >= 0 {
+		t.Error("modulus is not larger than the product of the primes")
+	}
+	// v_i^S = p_i mod P
+	for idx, v := range ns.PublicKey {
+		if new(big.Int).Exp(v, ns.S, ns.P).Cmp(ns.Primes[idx]) != 0 {
+			t.Errorf("element %d is not a root of its prime", idx)
+		}
+	}
+}
+
+func TestNaccacheSternSeeded(t *testing.T) {
+	a, err := NewNaccacheSternWithReader(NewSeededReader([]byte("seed")), 16)
+	handleFatalError(err, t)
+	b, err := NewNaccacheSternWithReader(NewSeededReader([]byte("seed")), 16)
+	handleFatalError(err, t)
+	if a.P.Cmp(b.P) != 0 || a.S.Cmp(b.S) != 0 {
+		t.Error("the same seed generated different keys")
+	}
+}
+
+func TestDecryptNaccacheStern(t *testing.T) {
+	for _, length := range []int64{1, 8, 64} {
+		ns, err := NewNaccacheStern(length)
+		handleFatalError(err, t)
+
+		for _, size := range []int{0, 1, 8, 100} {
+			msg := make([]byte, size)
+			_, err := rand.Read(msg)
+			handleFatalError(err, t)
+
+			ct, err := EncryptBytesNaccacheStern(ns.PublicKey, ns.P, msg)
+			handleFatalError(err, t)
+			if ct[0] != formatNaccacheStern {
+				t.Fatalf("wanted Naccache–Stern format byte, got %d", ct[0])
+			}
+			d, err := ns.DecryptBytes(ct)
+			if err != nil {
+				t.Fatalf("length %d, size %d: %v", length, size, err)
+			}
+			if !bytes.Equal(d, msg) {
+				t.Errorf("length %d, size %d: decrypted message differs", length, size)
+			}
+		}
+	}
+}
+
+func TestDecryptNaccacheSternErrors(t *testing.T) {
+	ns, err := NewNaccacheStern(32)
+	handleFatalError(err, t)
+
+	ct, err := EncryptBytesNaccacheStern(ns.PublicKey, ns.P, []byte("hello"))
+	handleFatalError(err, t)
+	blocks, err := unpackCiphertext(formatNaccacheStern, ct)
+	handleFatalError(err, t)
+	blocks[0].Add(blocks[0], big.NewInt(1))
+	_, err = ns.DecryptBytes(packCiphertext(formatNaccacheStern, blocks))
+	var decErr *DecryptError
+	if !errors.As(err, &decErr) || !errors.Is(err, ErrNoSolution) {
+		t.Errorf("wanted DecryptError wrapping ErrNoSolution, got %v", err)
+	}
+
+	// the schemes' ciphertexts aren't interchangeable
+	k, err := NewKnapsack(32)
+	handleFatalError(err, t)
+	if _, err := k.DecryptBytes(ct); !errors.Is(err, ErrMalformedCiphertext) {
+		t.Errorf("wanted ErrMalformedCiphertext decrypting with a Knapsack, got %v", err)
+	}
+	knapsackCt, err := EncryptBytes(k.PublicKey, []byte("hello"))
+	handleFatalError(err, t)
+	if _, err := ns.DecryptBytes(knapsackCt); !errors.Is(err, ErrMalformedCiphertext) {
+		t.Errorf("wanted ErrMalformedCiphertext decrypting with NaccacheStern, got %v", err)
+	}
+}
+
+func TestValidateNaccacheStern(t *testing.T) {
+	ns, err := NewNaccacheStern(16)
+	handleFatalError(err, t)
+
+	bad := *ns
+	bad.P = new(big.Int).Add(ns.P, big.NewInt(1))
+	if err := bad.Validate(); !errors.Is(err, ErrNotPrime) {
+		t.Errorf("wanted ErrNotPrime, got %v", err)
+	}
+
+	bad = *ns
+	bad.PublicKey = nil
+	bad.Primes = intsToBigs([]int64{2, 3, 4})
+	if err := bad.Validate(); !errors.Is(err, ErrNotPrime) {
+		t.Errorf("wanted ErrNotPrime, got %v", err)
+	}
+	bad.Primes = smallPrimes(100)
+	if err := bad.Validate(); !errors.Is(err, ErrPrimeProductTooLarge) {
+		t.Errorf("wanted ErrPrimeProductTooLarge, got %v", err)
+	}
+
+	bad = *ns
+	bad.S = new(big.Int).Sub(ns.P, big.NewInt(1))
+	if err := bad.Validate(); !errors.Is(err, ErrExponentNotCoprime) {
+		t.Errorf("wanted ErrExponentNotCoprime, got %v", err)
+	}
+
+	bad = *ns
+	bad.PublicKey = append([]*big.Int{big.NewInt(2)}, ns.PublicKey[1:]...)
+	if err := bad.Validate(); !errors.Is(err, ErrPublicKeyMismatch) {
+		t.Errorf("wanted ErrPublicKeyMismatch, got %v", err)
+	}
+}
+
+func TestPackUnpackNaccacheStern(t *testing.T) {
+	ns, err := NewNaccacheStern(24)
+	handleFatalError(err, t)
+
+	pubKeyFile, privKeyFile, err := PackNaccacheStern(*ns)
+	handleFatalError(err, t)
+	a := NaccacheSternPublicKeyFile{}
+	b := NaccacheSternPrivateKeyFile{}
+	handleFatalError(msgpack.Unmarshal(pubKeyFile, &a), t)
+	handleFatalError(msgpack.Unmarshal(privKeyFile, &b), t)
+
+	pk, p := UnpackNaccacheSternPublic(&a)
+	unpacked, err := UnpackNaccacheSternPrivate(&b)
+	handleFatalError(err, t)
+	if p.Cmp(ns.P) != 0 || unpacked.S.Cmp(ns.S) != 0 {
+		t.Error("P or S unequal")
+	}
+	for idx, n := range ns.PublicKey {
+		if pk[idx].Cmp(n) != 0 || unpacked.PublicKey[idx].Cmp(n) != 0 {
+			t.Fatalf("public key element %d unequal", idx)
+		}
+	}
+}
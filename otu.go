@@ -0,0 +1,463 @@
+package knapsack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"sort"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+// Okamoto–Tanaka–Uchiyama ("Quantum Public-Key Cryptosystems", 2000) was
+// designed to resist the low-density attacks: its public key elements are
+// discrete logs, which can be much shorter than the message block is wide, so
+// the density is above 1. The paper computes the logs with Shor's algorithm in
+// the residue ring of a number field. This is the classical simulation over
+// the rationals, where the residue ring is Z_P for a prime P with P - 1 smooth
+// enough for Pohlig–Hellman. With g a generator mod P and p_i small primes,
+//
+//   a_i = log_g(p_i) + D mod (P - 1)
+//
+// for a random D. A message is a set of exactly K indexes and its ciphertext
+// is the sum of their a_i. Removing K * D and raising g to the result gives
+// the product of the selected p_i mod P, and since any K of them multiply to
+// less than P, that's the product itself and can be factored.
+
+// otuFactorBits bounds the prime factors of P - 1 for OTU keys, so each
+// discrete log takes a few thousand multiplications
+const otuFactorBits = 20
+
+// OTUOptions sizes an OTU key for NewOTUWithOptions
+type OTUOptions struct {
+	Length int64 // number of elements
+	Weight int64 // number of elements every block selects (K)
+}
+
+// DefaultOTUOptions returns the options NewOTU uses: blocks select
+// keyLength / 16 (at least 2) of the elements, which keeps the density above 1
+func DefaultOTUOptions(keyLength int64) OTUOptions {
+	weight := keyLength / 16
+	if weight < 2 {
+		weight = 2
+	}
+	return OTUOptions{Length: keyLength, Weight: weight}
+}
+
+// OTU contains the private data used to generate an Okamoto–Tanaka–Uchiyama
+// public key and decrypt messages
+type OTU struct {
+	PublicKey []*big.Int
+	K         int64      // number of elements every block selects
+	Primes    []*big.Int // PublicKey[i] is derived from the log of Primes[i]
+	P         *big.Int   // prime modulus; P - 1 has only small prime factors
+	G         *big.Int   // generator of the multiplicative group mod P
+	D         *big.Int   // random offset added to every log
+}
+
+// NewOTU auto generates OTU params with DefaultOTUOptions
+func NewOTU(keyLength int64) (*OTU, error) {
+	return NewOTUWithReader(rand.Reader, keyLength)
+}
+
+// NewOTUWithReader generates OTU params using randomness read from `random`.
+// Passing a deterministic reader (see NewSeededReader) regenerates the same
+// key every time.
+func NewOTUWithReader(random io.Reader, keyLength int64) (*OTU, error) {
+	return NewOTUWithOptions(random, DefaultOTUOptions(keyLength))
+}
+
+// NewOTUWithOptions generates OTU params sized according to `opts`, using
+// randomness read from `random`
+func NewOTUWithOptions(random io.Reader, opts OTUOptions) (*OTU, error) {
+	if opts.Length < 2 {
+		return nil, errors.New("key length must be > 1")
+	}
+	if opts.Weight < 1 || opts.Weight >= opts.Length {
+		return nil, errors.New("weight must be in [1, length)")
+	}
+
+	// the first n primes, shuffled so the public key doesn't give away which
+	// element belongs to which prime
+	primes := smallPrimes(opts.Length)
+	perm, err := randomPermutation(random, opts.Length)
+	if err != nil {
+		return nil, err
+	}
+	shuffled := make([]*big.Int, len(primes))
+	for idx, privIdx := range perm {
+		shuffled[idx] = primes[privIdx]
+	}
+
+	// any number one bit longer than the product of the K largest primes is
+	// larger than every product of K of them
+	bits := product(primes[opts.Length-opts.Weight:]).BitLen() + 1
+	p, err := randomSmoothPrime(random, bits, otuFactorBits)
+	if err != nil {
+		return nil, err
+	}
+	pm1 := new(big.Int).Sub(p, big.NewInt(1))
+	prime, err := factorSmooth(pm1)
+	if err != nil {
+		return nil, err
+	}
+	var g *big.Int
+	for g == nil || !isZpGenerator(g, p, prime) {
+		if g, err = randomUniform(random, big.NewInt(2), pm1); err != nil {
+			return nil, err
+		}
+	}
+	d, err := randomInt(random, pm1)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &OTU{
+		K:      opts.Weight,
+		Primes: shuffled,
+		P:      p,
+		G:      g,
+		D:      d,
+	}
+	if o.PublicKey, err = o.DerivePublicKey(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// returns a random prime of `bits` bits (at least 16) such that P - 1 is 2
+// times primes of at most factorBits bits
+func randomSmoothPrime(random io.Reader, bits, factorBits int) (*big.Int, error) {
+	if bits < 16 {
+		bits = 16
+	}
+	one := big.NewInt(1)
+	for {
+		m := big.NewInt(2)
+		for m.BitLen() < bits-1 {
+			qBits := bits - 1 - m.BitLen()
+			if qBits > factorBits {
+				qBits = factorBits
+			}
+			if qBits < 2 {
+				qBits = 2
+			}
+			q, err := randomPrime(random, qBits)
+			if err != nil {
+				return nil, err
+			}
+			m.Mul(m, q)
+		}
+		if p := m.Add(m, one); p.BitLen() == bits && p.ProbablyPrime(20) {
+			return p, nil
+		}
+	}
+}
+
+// returns a random prime of exactly `bits` bits
+func randomPrime(random io.Reader, bits int) (*big.Int, error) {
+	one := big.NewInt(1)
+	min := new(big.Int).Lsh(one, uint(bits-1))
+	max := new(big.Int).Lsh(one, uint(bits))
+	for {
+		n, err := randomUniform(random, min, max)
+		if err != nil {
+			return nil, err
+		}
+		if n.ProbablyPrime(20) {
+			return n, nil
+		}
+	}
+}
+
+// g generates Z_p^* iff g^((p - 1)/q) != 1 for every prime q | p - 1
+func isZpGenerator(g, p *big.Int, prime []primePower) bool {
+	pm1 := new(big.Int).Sub(p, big.NewInt(1))
+	if g.Sign() <= 0 || g.Cmp(p) >= 0 {
+		return false
+	}
+	for _, pp := range prime {
+		if new(big.Int).Exp(g, new(big.Int).Quo(pm1, pp.q), p).Cmp(big.NewInt(1)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// DerivePublicKey computes the public key from the private parameters:
+// PublicKey[i] = log_G(Primes[i]) + D mod (P - 1). This takes a discrete log
+// for every element, one per CPU at a time.
+func (o *OTU) DerivePublicKey() ([]*big.Int, error) {
+	pm1 := new(big.Int).Sub(o.P, big.NewInt(1))
+	prime, err := factorSmooth(pm1)
+	if err != nil {
+		return nil, err
+	}
+	group := zpGroup{p: o.P}
+	out := make([]*big.Int, len(o.Primes))
+	err = runParallel(workers(0), len(o.Primes), func(idx int) error {
+		a, err := dlog(group, pm1, prime, zpElem{o.G}, zpElem{o.Primes[idx]})
+		if err != nil {
+			return err
+		}
+		a.Add(a, o.D)
+		out[idx] = a.Mod(a, pm1)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Validate checks the structural invariants of the key and reports the first
+// one that fails. The public key is only checked if it's present.
+func (o *OTU) Validate() error {
+	if len(o.Primes) < 2 {
+		return fmt.Errorf("%w: primes", ErrMissingParameter)
+	}
+	if o.P == nil || o.G == nil || o.D == nil {
+		return fmt.Errorf("%w: P, G and D are required", ErrMissingParameter)
+	}
+	if o.K < 1 || o.K >= int64(len(o.Primes)) {
+		return fmt.Errorf("%w: K must be in [1, %d)", ErrMissingParameter, len(o.Primes))
+	}
+	if !o.P.ProbablyPrime(20) {
+		return fmt.Errorf("%w: modulus", ErrNotPrime)
+	}
+	seen := make(map[string]bool, len(o.Primes))
+	for idx, prime := range o.Primes {
+		if prime == nil || !prime.ProbablyPrime(20) || seen[prime.String()] {
+			return fmt.Errorf("%w: element %d is not a distinct prime", ErrNotPrime, idx)
+		}
+		seen[prime.String()] = true
+	}
+	// every product of K primes must be less than P
+	largest := append([]*big.Int(nil), o.Primes...)
+	sort.Slice(largest, func(i, j int) bool { return largest[i].Cmp(largest[j]) < 0 })
+	if product(largest[int64(len(largest))-o.K:]).Cmp(o.P) >= 0 {
+		return ErrPrimeProductTooLarge
+	}
+	pm1 := new(big.Int).Sub(o.P, big.NewInt(1))
+	prime, err := factorSmooth(pm1)
+	if err != nil {
+		return err
+	}
+	if !isZpGenerator(o.G, o.P, prime) {
+		return ErrNotGenerator
+	}
+	if o.D.Sign() < 0 || o.D.Cmp(pm1) >= 0 {
+		return fmt.Errorf("%w: D must be in [0, P - 1)", ErrMissingParameter)
+	}
+
+	if o.PublicKey == nil {
+		return nil
+	}
+	derived, err := o.DerivePublicKey()
+	if err != nil {
+		return err
+	}
+	if len(o.PublicKey) != len(derived) {
+		return fmt.Errorf("%w: has %d elements, private key has %d", ErrPublicKeyMismatch, len(o.PublicKey), len(derived))
+	}
+	for idx, n := range derived {
+		if o.PublicKey[idx] == nil || o.PublicKey[idx].Cmp(n) != 0 {
+			return fmt.Errorf("%w: element %d", ErrPublicKeyMismatch, idx)
+		}
+	}
+	return nil
+}
+
+// EncryptBytesOTU encrypts `messageBytes` using an OTU `publicKey` whose
+// blocks select k elements. The padded message bits are split into blocks of
+// subsetCapacity(len(publicKey), k) bits, and each block is mapped to a set of
+// k public key elements whose sum is the block's ciphertext.
+func EncryptBytesOTU(publicKey []*big.Int, k int64, messageBytes []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	e := NewOTUEncryptor(&buf, publicKey, k)
+	if _, err := e.Write(messageBytes); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// NewOTUEncryptor returns an Encryptor in ModeOTU writing ciphertext for an
+// OTU `publicKey` whose blocks select k elements to `w`
+func NewOTUEncryptor(w io.Writer, publicKey []*big.Int, k int64) *Encryptor {
+	n := int64(len(publicKey))
+	capacity := 0 // rejected when encryption starts
+	if k >= 1 && k < n {
+		capacity = subsetCapacity(n, k)
+	}
+	return newSchemeEncryptor(w, ModeOTU, capacity, func(bits []byte) (*big.Int, error) {
+		ct := new(big.Int)
+		for _, idx := range unrankSubset(bitsToInt(bits), int(n), int(k)) {
+			ct.Add(ct, publicKey[idx])
+		}
+		return ct, nil
+	})
+}
+
+// DecryptBytes decrypts the output of EncryptBytesOTU
+func (o *OTU) DecryptBytes(ct []byte) ([]byte, error) {
+	return ioutil.ReadAll(NewOTUDecryptor(bytes.NewReader(ct), o))
+}
+
+// NewOTUDecryptor returns a Decryptor reading OTU ciphertext from `r` and
+// decrypting it with `o`
+func NewOTUDecryptor(r io.Reader, o *OTU) *Decryptor {
+	return newSchemeDecryptor(r, formatOTU, o.decryptBits)
+}
+
+// returns the bits of a single block
+func (o *OTU) decryptBits(ct *big.Int) ([]byte, error) {
+	// g^(c - K * D) is the product of the selected primes
+	pm1 := new(big.Int).Sub(o.P, big.NewInt(1))
+	r := new(big.Int).Mul(big.NewInt(o.K), o.D)
+	r.Sub(ct, r).Mod(r, pm1)
+	u := new(big.Int).Exp(o.G, r, o.P)
+
+	var subset []int
+	quo, rem := new(big.Int), new(big.Int)
+	for idx, prime := range o.Primes {
+		if quo.QuoRem(u, prime, rem); rem.Sign() == 0 {
+			subset = append(subset, idx)
+			u.Set(quo)
+		}
+	}
+	if u.Cmp(big.NewInt(1)) != 0 || int64(len(subset)) != o.K {
+		return nil, ErrNoSolution
+	}
+	rank := rankSubset(subset)
+	capacity := subsetCapacity(int64(len(o.Primes)), o.K)
+	if rank.BitLen() > capacity {
+		return nil, ErrNoSolution
+	}
+	return intToBits(rank, capacity), nil
+}
+
+// OTUPublicKey is an OTU public key and its weight as a PublicKey
+type OTUPublicKey struct {
+	Key []*big.Int
+	K   int64 // number of elements every block selects
+}
+
+// Elements returns the public key
+func (pk *OTUPublicKey) Elements() []*big.Int {
+	return pk.Key
+}
+
+// Public returns the public key and weight
+func (o *OTU) Public() PublicKey {
+	return &OTUPublicKey{Key: o.PublicKey, K: o.K}
+}
+
+// OTUScheme is the Cryptosystem for OTU keys, registered as "otu". It only
+// encrypts for one recipient, deterministically.
+type OTUScheme struct {
+	// Options replaces DefaultOTUOptions in GenerateKey if it's set
+	Options *OTUOptions
+}
+
+// Name returns "otu"
+func (OTUScheme) Name() string {
+	return "otu"
+}
+
+// GenerateKey returns an *OTU
+func (s OTUScheme) GenerateKey(random io.Reader, length int64) (PrivateKey, error) {
+	opts := DefaultOTUOptions(length)
+	if s.Options != nil {
+		opts = *s.Options
+	}
+	return NewOTUWithOptions(random, opts)
+}
+
+// Encrypt is EncryptBytesOTU; `random` isn't used
+func (s OTUScheme) Encrypt(random io.Reader, publicKey PublicKey, message []byte) ([]byte, error) {
+	return encryptWith(s, random, publicKey, message, EncryptOptions{})
+}
+
+// Decrypt is OTU.DecryptBytes
+func (s OTUScheme) Decrypt(privateKey PrivateKey, ct []byte) ([]byte, error) {
+	return decryptWith(s, privateKey, ct)
+}
+
+// NewEncryptor returns NewOTUEncryptor. Only textbook encryption for one
+// recipient is supported, so it's also what the zero EncryptOptions mean.
+func (OTUScheme) NewEncryptor(w io.Writer, recipients []PublicKey, opts EncryptOptions) (*Encryptor, error) {
+	if len(recipients) != 1 || opts.Hybrid || opts.Randomized {
+		return nil, errors.New("OTU keys only support textbook encryption for a single recipient")
+	}
+	pk, ok := recipients[0].(*OTUPublicKey)
+	if !ok {
+		return nil, ErrWrongScheme
+	}
+	return NewOTUEncryptor(w, pk.Key, pk.K), nil
+}
+
+// NewDecryptor returns NewOTUDecryptor
+func (OTUScheme) NewDecryptor(r io.Reader, privateKey PrivateKey) (*Decryptor, error) {
+	o, ok := privateKey.(*OTU)
+	if !ok {
+		return nil, ErrWrongScheme
+	}
+	return NewOTUDecryptor(r, o), nil
+}
+
+// MarshalPublicKey writes an OTUPublicKeyFile
+func (OTUScheme) MarshalPublicKey(publicKey PublicKey) ([]byte, error) {
+	pk, ok := publicKey.(*OTUPublicKey)
+	if !ok {
+		return nil, ErrWrongScheme
+	}
+	return msgpack.Marshal(&OTUPublicKeyFile{
+		PubKey: prepareSliceOfBigs(pk.Key),
+		K:      pk.K,
+	})
+}
+
+// MarshalPrivateKey writes an OTUPrivateKeyFile
+func (OTUScheme) MarshalPrivateKey(privateKey PrivateKey) ([]byte, error) {
+	o, ok := privateKey.(*OTU)
+	if !ok {
+		return nil, ErrWrongScheme
+	}
+	_, priv, err := PackOTU(*o)
+	return priv, err
+}
+
+// UnmarshalPublicKey reads an OTUPublicKeyFile
+func (OTUScheme) UnmarshalPublicKey(b []byte) (PublicKey, error) {
+	if err := checkKeyFields(b, []string{"PubKey", "K"}); err != nil {
+		return nil, err
+	}
+	pkf := &OTUPublicKeyFile{}
+	if err := msgpack.Unmarshal(b, pkf); err != nil {
+		return nil, err
+	}
+	pk, k := UnpackOTUPublic(pkf)
+	if k < 1 || k >= int64(len(pk)) {
+		return nil, fmt.Errorf("%w: weight %d for %d elements", ErrInvalidPublicKey, k, len(pk))
+	}
+	return &OTUPublicKey{Key: pk, K: k}, nil
+}
+
+// UnmarshalPrivateKey reads an OTUPrivateKeyFile (see UnpackOTUPrivate)
+func (OTUScheme) UnmarshalPrivateKey(b []byte) (PrivateKey, error) {
+	if err := checkKeyFields(b, []string{"K", "Primes", "P", "G", "D"}); err != nil {
+		return nil, err
+	}
+	skf := &OTUPrivateKeyFile{}
+	if err := msgpack.Unmarshal(b, skf); err != nil {
+		return nil, err
+	}
+	return UnpackOTUPrivate(skf)
+}
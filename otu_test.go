@@ -0,0 +1,150 @@
+package knapsack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+func TestOTUKeygen(t *testing.T) {
+	o, err := NewOTU(100)
+	handleFatalError(err, t)
+	handleFatalError(o.Validate(), t)
+	if len(o.PublicKey) != 100 || o.K != 6 {
+		t.Errorf("wanted 100 elements and weight 6, got %d and %d", len(o.PublicKey), o.K)
+	}
+	// the point of OTU: the public key is too dense for lattice attacks
+	if d := Density(o.PublicKey); d <= 1 {
+		t.Errorf("wanted density > 1, got %.4f", d)
+	}
+	prime, err := factorSmooth(new(big.Int).Sub(o.P, big.NewInt(1)))
+	handleFatalError(err, t)
+	for _, pp := range prime {
+		if pp.q.BitLen() > otuFactorBits {
+			t.Errorf("P - 1 has a %d bit factor", pp.q.BitLen())
+		}
+	}
+
+	for _, opts := range []OTUOptions{{Length: 1, Weight: 1}, {Length: 10, Weight: 0}, {Length: 10, Weight: 10}} {
+		if _, err := NewOTUWithOptions(rand.Reader, opts); err == nil {
+			t.Errorf("%+v: expected an error", opts)
+		}
+	}
+}
+
+func TestOTUSeeded(t *testing.T) {
+	a, err := NewOTUWithReader(NewSeededReader([]byte("seed")), 40)
+	handleFatalError(err, t)
+	b, err := NewOTUWithReader(NewSeededReader([]byte("seed")), 40)
+	handleFatalError(err, t)
+	for idx := range a.PublicKey {
+		if a.PublicKey[idx].Cmp(b.PublicKey[idx]) != 0 {
+			t.Fatal("the same seed generated different keys")
+		}
+	}
+}
+
+func TestDecryptOTU(t *testing.T) {
+	for _, opts := range []OTUOptions{{Length: 16, Weight: 1}, DefaultOTUOptions(64), {Length: 64, Weight: 12}} {
+		o, err := NewOTUWithOptions(rand.Reader, opts)
+		handleFatalError(err, t)
+
+		for _, size := range []int{0, 1, 8, 100} {
+			msg := make([]byte, size)
+			_, err := rand.Read(msg)
+			handleFatalError(err, t)
+
+			ct, err := EncryptBytesOTU(o.PublicKey, o.K, msg)
+			handleFatalError(err, t)
+			if ct[0] != formatOTU {
+				t.Fatalf("wanted OTU format byte, got %d", ct[0])
+			}
+			d, err := o.DecryptBytes(ct)
+			if err != nil {
+				t.Fatalf("%+v, size %d: %v", opts, size, err)
+			}
+			if !bytes.Equal(d, msg) {
+				t.Errorf("%+v, size %d: decrypted message differs", opts, size)
+			}
+		}
+	}
+}
+
+func TestDecryptOTUErrors(t *testing.T) {
+	o, err := NewOTU(32)
+	handleFatalError(err, t)
+
+	ct, err := EncryptBytesOTU(o.PublicKey, o.K, []byte("hello"))
+	handleFatalError(err, t)
+	blocks, err := unpackCiphertext(formatOTU, ct)
+	handleFatalError(err, t)
+	blocks[0].Add(blocks[0], big.NewInt(1))
+	_, err = o.DecryptBytes(packCiphertext(formatOTU, blocks))
+	var decErr *DecryptError
+	if !errors.As(err, &decErr) || !errors.Is(err, ErrNoSolution) {
+		t.Errorf("wanted DecryptError wrapping ErrNoSolution, got %v", err)
+	}
+
+	if _, err := EncryptBytesOTU(o.PublicKey, int64(len(o.PublicKey)), []byte("hello")); err == nil {
+		t.Error("encrypted with a weight as big as the key")
+	}
+}
+
+func TestValidateOTU(t *testing.T) {
+	o, err := NewOTU(32)
+	handleFatalError(err, t)
+
+	bad := *o
+	bad.G = big.NewInt(1)
+	if err := bad.Validate(); !errors.Is(err, ErrNotGenerator) {
+		t.Errorf("wanted ErrNotGenerator, got %v", err)
+	}
+
+	bad = *o
+	bad.Primes = append([]*big.Int{o.Primes[1]}, o.Primes[1:]...)
+	if err := bad.Validate(); !errors.Is(err, ErrNotPrime) {
+		t.Errorf("wanted ErrNotPrime, got %v", err)
+	}
+
+	bad = *o
+	bad.K = int64(len(o.Primes)) - 1
+	if err := bad.Validate(); !errors.Is(err, ErrPrimeProductTooLarge) {
+		t.Errorf("wanted ErrPrimeProductTooLarge, got %v", err)
+	}
+
+	bad = *o
+	bad.PublicKey = append([]*big.Int{big.NewInt(2)}, o.PublicKey[1:]...)
+	if o.PublicKey[0].Cmp(big.NewInt(2)) != 0 {
+		if err := bad.Validate(); !errors.Is(err, ErrPublicKeyMismatch) {
+			t.Errorf("wanted ErrPublicKeyMismatch, got %v", err)
+		}
+	}
+}
+
+func TestPackUnpackOTU(t *testing.T) {
+	o, err := NewOTU(32)
+	handleFatalError(err, t)
+
+	pubKeyFile, privKeyFile, err := PackOTU(*o)
+	handleFatalError(err, t)
+	a := OTUPublicKeyFile{}
+	b := OTUPrivateKeyFile{}
+	handleFatalError(msgpack.Unmarshal(pubKeyFile, &a), t)
+	handleFatalError(msgpack.Unmarshal(privKeyFile, &b), t)
+
+	pk, k := UnpackOTUPublic(&a)
+	unpacked, err := UnpackOTUPrivate(&b)
+	handleFatalError(err, t)
+	if k != o.K || unpacked.K != o.K || unpacked.P.Cmp(o.P) != 0 || unpacked.D.Cmp(o.D) != 0 {
+		t.Error("K, P or D unequal")
+	}
+	for idx, n := range o.PublicKey {
+		if pk[idx].Cmp(n) != 0 || unpacked.PublicKey[idx].Cmp(n) != 0 {
+			t.Fatalf("public key element %d unequal", idx)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package knapsack
+
+import (
+	"runtime"
+	"sync"
+)
+
+// blocksPerJob is how many blocks each worker gets per batch, so workers
+// aren't waiting on each other after every block
+const blocksPerJob = 16
+
+// returns the number of workers to use for a Jobs setting; anything below 1
+// means one per CPU
+func workers(jobs int) int {
+	if jobs < 1 {
+		return runtime.NumCPU()
+	}
+	return jobs
+}
+
+// runParallel calls fn(i) for every i in [0, n) using at most `jobs` goroutines.
+// fn should write its result to index i of a slice so the order is kept. If
+// any calls fail, the error for the lowest i is returned, just as if they had
+// been run in order.
+func runParallel(jobs, n int, fn func(i int) error) error {
+	if jobs > n {
+		jobs = n
+	}
+	if jobs <= 1 {
+		for i := 0; i < n; i++ {
+			if err := fn(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	errs := make([]error, n)
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(jobs)
+	for w := 0; w < jobs; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package knapsack
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"runtime"
+	"testing"
+)
+
+func TestRunParallel(t *testing.T) {
+	for _, jobs := range []int{1, 3, 100} {
+		out := make([]int, 50)
+		err := runParallel(jobs, len(out), func(i int) error {
+			out[i] = i * i
+			return nil
+		})
+		handleFatalError(err, t)
+		for i, v := range out {
+			if v != i*i {
+				t.Fatalf("jobs %d: out[%d] = %d", jobs, i, v)
+			}
+		}
+
+		// the error of the first failing index wins
+		err = runParallel(jobs, len(out), func(i int) error {
+			if i%10 == 7 {
+				return fmt.Errorf("failed %d", i)
+			}
+			return nil
+		})
+		if err == nil || err.Error() != "failed 7" {
+			t.Errorf("jobs %d: wanted first error, got %v", jobs, err)
+		}
+	}
+}
+
+func TestParallelMatchesSerial(t *testing.T) {
+	k, err := NewKnapsackWithReader(NewSeededReader([]byte("seed")), 512)
+	handleFatalError(err, t)
+
+	msg := bytes.Repeat([]byte("parallel"), 1000)
+	for _, mode := range []Mode{ModeTextbook, ModeRandomized} {
+		var cts [][]byte
+		for _, jobs := range []int{1, 4} {
+			var buf bytes.Buffer
+			e := NewEncryptor(&buf, k.PublicKey)
+			e.Mode = mode
+			e.Rand = NewSeededReader([]byte("rand"))
+			e.Jobs = jobs
+			_, err := e.Write(msg)
+			handleFatalError(err, t)
+			handleFatalError(e.Close(), t)
+			cts = append(cts, buf.Bytes())
+
+			d := NewDecryptor(bytes.NewReader(buf.Bytes()), k)
+			d.Jobs = jobs
+			pt, err := ioutil.ReadAll(d)
+			handleFatalError(err, t)
+			if !bytes.Equal(pt, msg) {
+				t.Errorf("mode %d, jobs %d: decrypted message differs", mode, jobs)
+			}
+		}
+		if !bytes.Equal(cts[0], cts[1]) {
+			t.Errorf("mode %d: ciphertext depends on the number of jobs", mode)
+		}
+	}
+}
+
+func TestParallelDecryptErrorBlock(t *testing.T) {
+	k, err := NewKnapsackWithReader(NewSeededReader([]byte("seed")), 512)
+	handleFatalError(err, t)
+
+	msg := bytes.Repeat([]byte("parallel"), 200)
+	ct, err := EncryptBytes(k.PublicKey, msg)
+	handleFatalError(err, t)
+	blocks, err := unpackCiphertext(formatBlocks, ct)
+	handleFatalError(err, t)
+
+	// block 5 can't be decrypted
+	blocks[5].Add(blocks[5], big.NewInt(1))
+	d := NewDecryptor(bytes.NewReader(packCiphertext(formatBlocks, blocks)), k)
+	d.Jobs = 4
+	_, err = ioutil.ReadAll(d)
+	var decErr *DecryptError
+	if !errors.As(err, &decErr) || decErr.Block != 5 {
+		t.Errorf("wanted DecryptError for block 5, got %v", err)
+	}
+}
+
+func jobCounts() []int {
+	counts := []int{1}
+	for jobs := 2; jobs <= runtime.NumCPU(); jobs *= 2 {
+		counts = append(counts, jobs)
+	}
+	return counts
+}
+
+func BenchmarkEncryptParallel(b *testing.B) {
+	k, err := NewKnapsack(256)
+	if err != nil {
+		b.Fatal(err)
+	}
+	msg := bytes.Repeat([]byte("benchmark"), 1<<12)
+
+	for _, jobs := range jobCounts() {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			b.SetBytes(int64(len(msg)))
+			for i := 0; i < b.N; i++ {
+				e := NewEncryptor(ioutil.Discard, k.PublicKey)
+				e.Jobs = jobs
+				if _, err := e.Write(msg); err != nil {
+					b.Fatal(err)
+				}
+				if err := e.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecryptParallel(b *testing.B) {
+	k, err := NewKnapsack(256)
+	if err != nil {
+		b.Fatal(err)
+	}
+	msg := bytes.Repeat([]byte("benchmark"), 1<<12)
+	ct, err := EncryptBytes(k.PublicKey, msg)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, jobs := range jobCounts() {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			b.SetBytes(int64(len(msg)))
+			for i := 0; i < b.N; i++ {
+				d := NewDecryptor(bytes.NewReader(ct), k)
+				d.Jobs = jobs
+				if _, err := io.Copy(ioutil.Discard, d); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
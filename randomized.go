@@ -0,0 +1,109 @@
+package knapsack
+
+import (
+	"crypto/sha256"
+	"io"
+	"math/big"
+)
+
+// Randomized encryption mixes fresh random bits into every block, OAEP style,
+// so encrypting the same message twice gives unrelated ciphertexts. Each block
+// of n = len(publicKey) bits is laid out as
+//
+//   maskedData (n - seedBits bits) | maskedSeed (seedBits bits)
+//
+// where data is capacity message bits followed by checkBits zeros,
+// maskedData = data XOR G(seed) and maskedSeed = seed XOR H(maskedData).
+// Decryption reverses the masks and rejects blocks whose check bits aren't zero.
+//
+// A seed shorter than minSeedBits could be found by trying them all, which
+// confirms a guess at the message as well as textbook encryption would, so
+// randomized encryption and decryption need keys of at least
+// minRandomizedLength elements.
+
+const (
+	// minSeedBits is the fewest random bits a randomized block may carry
+	minSeedBits = 128
+	// minRandomizedLength is the shortest key whose blocks have room for a
+	// seed of minSeedBits
+	minRandomizedLength = 4 * minSeedBits
+)
+
+// returns how many random bits and zero check bits a block of keyLength bits
+// carries in randomized mode, and how many message bits are left over
+func randomizedLayout(keyLength int) (seedBits, checkBits, capacity int) {
+	seedBits = keyLength / 4
+	checkBits = keyLength / 8
+	return seedBits, checkBits, keyLength - seedBits - checkBits
+}
+
+// EncryptBytesRandomized encrypts `messageBytes` using `publicKey` like
+// EncryptBytes, but mixes random bits read from `random` into each block so the
+// ciphertext can't be used to confirm a guess at the message. A quarter of
+// each block is random and an eighth is used to detect corruption, so the
+// ciphertext is bigger than with EncryptBytes. The public key needs at least
+// 512 elements; use EncryptBytesHybrid for shorter ones.
+func EncryptBytesRandomized(random io.Reader, publicKey []*big.Int, messageBytes []byte) ([]byte, error) {
+	return encryptAll(publicKey, ModeRandomized, random, messageBytes)
+}
+
+// returns a function masking blocks of message bits with fresh random seeds
+func randomizedMask(random io.Reader, keyLength int) func([]byte) ([]byte, error) {
+	seedBits, _, _ := randomizedLayout(keyLength)
+	return func(dataBits []byte) ([]byte, error) {
+		seed := make([]byte, (seedBits+7)/8)
+		if _, err := io.ReadFull(random, seed); err != nil {
+			return nil, err
+		}
+		return maskBlock(dataBits, bytesToBits(seed)[:seedBits], keyLength), nil
+	}
+}
+
+// returns the n bit block for dataBits and seedBits (see above)
+func maskBlock(dataBits, seedBits []byte, n int) []byte {
+	block := make([]byte, n)
+	maskedData := block[:n-len(seedBits)]
+	maskedSeed := block[n-len(seedBits):]
+	copy(maskedData, dataBits) // the check bits stay zero
+	xorBits(maskedData, maskGen('G', seedBits, len(maskedData)))
+	copy(maskedSeed, seedBits)
+	xorBits(maskedSeed, maskGen('H', maskedData, len(maskedSeed)))
+	return block
+}
+
+// unmaskBlock is the inverse of maskBlock, returning just the message bits
+func unmaskBlock(block []byte) ([]byte, error) {
+	seedBits, checkBits, capacity := randomizedLayout(len(block))
+	n := len(block)
+	maskedData := append([]byte(nil), block[:n-seedBits]...)
+	seed := append([]byte(nil), block[n-seedBits:]...)
+	xorBits(seed, maskGen('H', maskedData, seedBits))
+	xorBits(maskedData, maskGen('G', seed, len(maskedData)))
+	for _, bit := range maskedData[capacity : capacity+checkBits] {
+		if bit != 0 {
+			return nil, ErrInvalidPadding
+		}
+	}
+	return maskedData[:capacity], nil
+}
+
+// maskGen stretches seed (a slice of bits) into n pseudorandom bits using
+// SHA-256 with a counter, like MGF1. label separates the G and H functions.
+func maskGen(label byte, seed []byte, n int) []byte {
+	out := make([]byte, 0, n+256)
+	for counter := uint64(0); len(out) < n; counter++ {
+		h := sha256.New()
+		h.Write([]byte{label})
+		h.Write(appendUvarint(nil, counter))
+		h.Write(seed)
+		out = append(out, bytesToBits(h.Sum(nil))...)
+	}
+	return out[:n]
+}
+
+// xors src into dst bit by bit
+func xorBits(dst, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
@@ -0,0 +1,89 @@
+package knapsack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestDecryptRandomized(t *testing.T) {
+	msgs := [][]byte{
+		{},
+		[]byte("yes"),
+		[]byte("a message long enough to need several randomized blocks"),
+		{0x00, 0x00},
+	}
+	for _, keyLength := range []int64{512, 517} {
+		k, err := NewKnapsack(keyLength)
+		handleFatalError(err, t)
+		for _, msg := range msgs {
+			ct, err := EncryptBytesRandomized(rand.Reader, k.PublicKey, msg)
+			handleFatalError(err, t)
+			d, err := k.DecryptBytes(ct)
+			if err != nil {
+				t.Fatalf("key length %d: %v", keyLength, err)
+			}
+			if !bytes.Equal(d, msg) {
+				t.Errorf("key length %d: wanted %v, got %v", keyLength, msg, d)
+			}
+		}
+	}
+}
+
+func TestEncryptRandomizedDiffers(t *testing.T) {
+	k, err := NewKnapsack(512)
+	handleFatalError(err, t)
+
+	a, err := EncryptBytesRandomized(rand.Reader, k.PublicKey, []byte("yes"))
+	handleFatalError(err, t)
+	b, err := EncryptBytesRandomized(rand.Reader, k.PublicKey, []byte("yes"))
+	handleFatalError(err, t)
+	if bytes.Equal(a, b) {
+		t.Error("wanted different ciphertexts for the same message")
+	}
+}
+
+func TestEncryptRandomizedShortKey(t *testing.T) {
+	if _, err := EncryptBytesRandomized(rand.Reader, intsToBigs([]int64{1, 2, 4}), []byte("h")); err == nil {
+		t.Error("wanted error for a key too short to randomize")
+	}
+
+	// a 100 element key only has room for a 25 bit seed
+	k, err := NewKnapsack(100)
+	handleFatalError(err, t)
+	if _, err := EncryptBytesRandomized(rand.Reader, k.PublicKey, []byte("h")); err == nil {
+		t.Error("wanted error for a key too short for a 128 bit seed")
+	}
+
+	// nor does it decrypt randomized blocks
+	ct, err := EncryptBytes(k.PublicKey, []byte("h"))
+	handleFatalError(err, t)
+	ct[0] = formatRandomized
+	if _, err := k.DecryptBytes(ct); !errors.Is(err, ErrMalformedCiphertext) {
+		t.Errorf("wanted ErrMalformedCiphertext, got %v", err)
+	}
+}
+
+func TestUnmaskBlock(t *testing.T) {
+	seedBits, checkBits, capacity := randomizedLayout(minRandomizedLength)
+	if seedBits+checkBits+capacity != minRandomizedLength {
+		t.Fatalf("layout doesn't add up: %d + %d + %d", seedBits, checkBits, capacity)
+	}
+
+	data := bytesToBits(bytes.Repeat([]byte("01234567"), 5))[:capacity]
+	seed := bytesToBits(bytes.Repeat([]byte("seed"), 4))[:seedBits]
+	block := maskBlock(data, seed, minRandomizedLength)
+
+	unmasked, err := unmaskBlock(block)
+	handleFatalError(err, t)
+	if !bytes.Equal(unmasked, data) {
+		t.Errorf("wanted %v, got %v", data, unmasked)
+	}
+
+	// flipping a data bit scrambles everything after unmasking, including the check bits
+	block[0] ^= 1
+	if _, err := unmaskBlock(block); !errors.Is(err, ErrInvalidPadding) {
+		t.Errorf("wanted ErrInvalidPadding, got %v", err)
+	}
+}
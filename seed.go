@@ -0,0 +1,53 @@
+package knapsack
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+)
+
+// seededReader is a deterministic stream of bytes: SHA-256 over the seed and
+// a block counter. Fine for reproducible toy keys, not a real CSPRNG.
+type seededReader struct {
+	seed    []byte
+	counter uint64
+	buf     []byte
+}
+
+// NewSeededReader returns a reader producing the same byte stream every time
+// for a given seed. Pass it to NewKnapsackWithReader to regenerate a Knapsack.
+func NewSeededReader(seed []byte) io.Reader {
+	return &seededReader{seed: append([]byte(nil), seed...)}
+}
+
+// SeedFromPassphrase derives a seed for NewSeededReader from a passphrase
+func SeedFromPassphrase(passphrase string) []byte {
+	h := sha256.New()
+	h.Write([]byte("knapsack passphrase seed\x00"))
+	h.Write([]byte(passphrase))
+	return h.Sum(nil)
+}
+
+func (r *seededReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.buf) == 0 {
+			r.refill()
+		}
+		copied := copy(p[n:], r.buf)
+		r.buf = r.buf[copied:]
+		n += copied
+	}
+	return n, nil
+}
+
+func (r *seededReader) refill() {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], r.counter)
+	r.counter++
+
+	h := sha256.New()
+	h.Write(r.seed)
+	h.Write(counter[:])
+	r.buf = h.Sum(nil)
+}
@@ -0,0 +1,66 @@
+package knapsack
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"testing"
+)
+
+func TestSeededReader(t *testing.T) {
+	// sha256("seed" || 0x0000000000000000) followed by the next counter block
+	expected, _ := hex.DecodeString("1a30d3c0635d49b5a0171067701f1cac41ceaa184e3d080e36335b3eb48db685")
+	a := make([]byte, 100)
+	b := make([]byte, 100)
+	_, err := io.ReadFull(NewSeededReader([]byte("seed")), a)
+	handleFatalError(err, t)
+
+	// reading in odd-sized chunks must produce the same stream
+	r := NewSeededReader([]byte("seed"))
+	for start := 0; start < len(b); start += 7 {
+		end := start + 7
+		if end > len(b) {
+			end = len(b)
+		}
+		_, err = io.ReadFull(r, b[start:end])
+		handleFatalError(err, t)
+	}
+	if !bytes.Equal(a, b) {
+		t.Errorf("streams differ:\n\t%x\n\t%x", a, b)
+	}
+	if !bytes.HasPrefix(a, expected) {
+		t.Errorf("wanted prefix %x, got %x", expected, a)
+	}
+}
+
+func TestNewKnapsackWithSeededReader(t *testing.T) {
+	seed := SeedFromPassphrase("correct horse battery staple")
+	ka, err := NewKnapsackWithReader(NewSeededReader(seed), 100)
+	handleFatalError(err, t)
+	kb, err := NewKnapsackWithReader(NewSeededReader(seed), 100)
+	handleFatalError(err, t)
+
+	if equal, msg := equalKnapsacks(ka, kb); !equal {
+		t.Errorf("same seed produced different knapsacks: %s", msg)
+	}
+
+	kc, err := NewKnapsackWithReader(NewSeededReader(SeedFromPassphrase("hunter2")), 100)
+	handleFatalError(err, t)
+	if equal, _ := equalKnapsacks(ka, kc); equal {
+		t.Error("different seeds produced the same knapsack")
+	}
+}
+
+func TestNewKnapsackWithSeededReaderIsStable(t *testing.T) {
+	// seeded keys are meant to be reproducible across releases, so any change
+	// to how keygen consumes randomness shows up here
+	k, err := NewKnapsackWithReader(NewSeededReader([]byte("seed")), 16)
+	handleFatalError(err, t)
+
+	if actual := hex.EncodeToString(GetKeyID(k.PrivateKey)); actual != "268eabfae1c9253ba6f2" {
+		t.Errorf("wanted private key ID 268eabfae1c9253ba6f2, got %s", actual)
+	}
+	if actual := hex.EncodeToString(GetKeyID(k.PublicKey)); actual != "c74f84c2b2aca426e268" {
+		t.Errorf("wanted public key ID c74f84c2b2aca426e268, got %s", actual)
+	}
+}
@@ -1,6 +1,12 @@
 package knapsack
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
 	"math/big"
 
 	"github.com/vmihailenco/msgpack"
@@ -9,14 +15,35 @@ import (
 // PublicKeyFile contains only the public key and is suitable for sharing
 type PublicKeyFile struct {
 	PubKey [][]byte
+	M      []byte `msgpack:",omitempty"` // modulus; only published for signature verification keys (see PackVerifier)
+	// DigitBits is the number of message bits per element of a compact key
+	// (see EncryptBytesCompact); absent for one bit per element
+	DigitBits int `msgpack:",omitempty"`
 }
 
 // PrivateKeyFile contains only the private constants used to decrypt messages
 type PrivateKeyFile struct {
 	PrivKey [][]byte
-	M       []byte // modulus
-	W       []byte // random mutating constant
-	WI      []byte // inverse of w
+	M       []byte      // modulus
+	W       []byte      // random mutating constant
+	WI      []byte      // inverse of w
+	Perm    []int       `msgpack:",omitempty"` // public key index permutation; absent in older key files
+	Rounds  []RoundFile `msgpack:",omitempty"` // further rounds of iterated Merkle-Hellman
+	// DigitBits is the number of message bits per element of a compact key;
+	// absent for one bit per element
+	DigitBits int `msgpack:",omitempty"`
+	// LowBits is the split between the superincreasing and random bits of a
+	// Graham–Shamir key; absent for other keys
+	LowBits int `msgpack:",omitempty"`
+	// Moduli are the CRT moduli of a Goodman–McAuley key; absent for other keys
+	Moduli [][]byte `msgpack:",omitempty"`
+}
+
+// RoundFile contains the constants of one extra round of iterated Merkle-Hellman
+type RoundFile struct {
+	M  []byte // modulus
+	W  []byte // random mutating constant
+	WI []byte // inverse of w
 }
 
 // KeyFile allows getting the key out of a public or private file
@@ -36,17 +63,20 @@ func (p PrivateKeyFile) GetKey() [][]byte {
 
 // Pack serializes a knapsack and returns the packed bytes (PubKeyFile, PrivKeyFile, error)
 func Pack(k Knapsack) ([]byte, []byte, error) {
-	pub, err := msgpack.Marshal(&PublicKeyFile{
-		PubKey: prepareSliceOfBigs(k.PublicKey),
-	})
+	pub, err := PackPublic(&KnapsackPublicKey{Key: k.PublicKey, DigitBits: k.DigitBits})
 	if err != nil {
 		return nil, nil, err
 	}
 	priv, err := msgpack.Marshal(&PrivateKeyFile{
-		PrivKey: prepareSliceOfBigs(k.PrivateKey),
-		M:       k.M.Bytes(),
-		W:       k.W.Bytes(),
-		WI:      k.WI.Bytes(),
+		PrivKey:   prepareSliceOfBigs(k.PrivateKey),
+		M:         k.M.Bytes(),
+		W:         k.W.Bytes(),
+		WI:        k.WI.Bytes(),
+		Perm:      k.Perm,
+		Rounds:    prepareRounds(k.Iterations),
+		DigitBits: k.DigitBits,
+		LowBits:   k.LowBits,
+		Moduli:    prepareSliceOfBigs(k.Moduli),
 	})
 	if err != nil {
 		return nil, nil, err
@@ -55,11 +85,100 @@ func Pack(k Knapsack) ([]byte, []byte, error) {
 	return pub, priv, nil
 }
 
+// PackPublic serializes just a public key, and the digit size of a compact
+// key, into a PublicKeyFile (see Knapsack.Public)
+func PackPublic(publicKey *KnapsackPublicKey) ([]byte, error) {
+	return msgpack.Marshal(&PublicKeyFile{
+		PubKey:    prepareSliceOfBigs(publicKey.Key),
+		DigitBits: publicKey.DigitBits,
+	})
+}
+
+// SigningKeyFile contains a Shamir fast signature key (see SigningKey)
+type SigningKeyFile struct {
+	PubKey [][]byte
+	N      []byte   // prime modulus
+	H      [][]byte // rows of the secret matrix
+}
+
+// GetKey returns the public key
+func (p SigningKeyFile) GetKey() [][]byte {
+	return p.PubKey
+}
+
+// PackSigningKey serializes a signing key and returns the packed bytes
+// (verifier PublicKeyFile, SigningKeyFile, error)
+func PackSigningKey(sk SigningKey) ([]byte, []byte, error) {
+	pub, err := PackVerifier(sk)
+	if err != nil {
+		return nil, nil, err
+	}
+	priv, err := msgpack.Marshal(&SigningKeyFile{
+		PubKey: prepareSliceOfBigs(sk.PublicKey),
+		N:      sk.N.Bytes(),
+		H:      prepareSliceOfBigs(sk.H),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return pub, priv, nil
+}
+
+// PackVerifier serializes the public key of a signing key along with its
+// modulus, which is all Verify needs. UnmarshalPublicKey recognizes the file
+// as a Merkle-Hellman public key but rejects it with ErrVerifierKey.
+func PackVerifier(sk SigningKey) ([]byte, error) {
+	return msgpack.Marshal(&PublicKeyFile{
+		PubKey: prepareSliceOfBigs(sk.PublicKey),
+		M:      sk.N.Bytes(),
+	})
+}
+
+// UnpackVerifier returns the public key and modulus from a public key file
+// written by PackVerifier
+func UnpackVerifier(pubKeyFile *PublicKeyFile) ([]*big.Int, *big.Int, error) {
+	if len(pubKeyFile.M) == 0 {
+		return nil, nil, errors.New("public key file has no modulus; it isn't a signature verification key")
+	}
+	return unpackKey(pubKeyFile), unpackBigInt(pubKeyFile.M), nil
+}
+
+// UnpackSigningKey returns a SigningKey from a signing key file. Keys that
+// fail SigningKey.Validate are rejected.
+func UnpackSigningKey(skf *SigningKeyFile) (*SigningKey, error) {
+	sk := &SigningKey{
+		PublicKey: unpackKey(skf),
+		N:         unpackBigInt(skf.N),
+		H:         unpackSliceOfBigs(skf.H),
+	}
+	if err := sk.Validate(); err != nil {
+		return nil, err
+	}
+	return sk, nil
+}
+
+// UnmarshalSigningKey reads a SigningKeyFile (see UnpackSigningKey). Other key
+// files are rejected with ErrWrongScheme.
+func UnmarshalSigningKey(b []byte) (*SigningKey, error) {
+	if err := checkKeyFields(b, []string{"PubKey", "N", "H"}); err != nil {
+		return nil, err
+	}
+	skf := &SigningKeyFile{}
+	if err := msgpack.Unmarshal(b, skf); err != nil {
+		return nil, err
+	}
+	return UnpackSigningKey(skf)
+}
+
 // Unpack deserializes a public and private key file into a Knapsack struct
-func Unpack(pubKeyFile *PublicKeyFile, privKeyFile *PrivateKeyFile) *Knapsack {
-	k := UnpackPrivate(privKeyFile)
+// and checks that the two files belong together (see Knapsack.Validate)
+func Unpack(pubKeyFile *PublicKeyFile, privKeyFile *PrivateKeyFile) (*Knapsack, error) {
+	k := unpackPrivate(privKeyFile)
 	k.PublicKey = unpackKey(pubKeyFile)
-	return k
+	if err := k.Validate(); err != nil {
+		return nil, err
+	}
+	return k, nil
 }
 
 // UnpackPublic returns the public key from the serialized public key file
@@ -67,8 +186,19 @@ func UnpackPublic(pubKeyFile *PublicKeyFile) []*big.Int {
 	return unpackKey(pubKeyFile)
 }
 
-// UnpackPrivate returns a Knapsack by deserializing the private key params
-func UnpackPrivate(privKeyFile *PrivateKeyFile) *Knapsack {
+// UnpackPrivate returns a Knapsack by deserializing the private key params.
+// Keys that fail Knapsack.Validate are rejected. The public key isn't stored in
+// the private key file, so it's recomputed (see Knapsack.DerivePublicKey).
+func UnpackPrivate(privKeyFile *PrivateKeyFile) (*Knapsack, error) {
+	k := unpackPrivate(privKeyFile)
+	if err := k.Validate(); err != nil {
+		return nil, err
+	}
+	k.PublicKey = k.DerivePublicKey()
+	return k, nil
+}
+
+func unpackPrivate(privKeyFile *PrivateKeyFile) *Knapsack {
 	privateKey := unpackKey(privKeyFile)
 	return &Knapsack{
 		PublicKey:  nil,
@@ -76,7 +206,42 @@ func UnpackPrivate(privKeyFile *PrivateKeyFile) *Knapsack {
 		M:          unpackBigInt(privKeyFile.M),
 		W:          unpackBigInt(privKeyFile.W),
 		WI:         unpackBigInt(privKeyFile.WI),
+		Perm:       privKeyFile.Perm,
+		Iterations: unpackRounds(privKeyFile.Rounds),
+		DigitBits:  privKeyFile.DigitBits,
+		LowBits:    privKeyFile.LowBits,
+		Moduli:     unpackSliceOfBigs(privKeyFile.Moduli),
+	}
+}
+
+func unpackRounds(rounds []RoundFile) []Round {
+	if len(rounds) == 0 {
+		return nil
+	}
+	out := make([]Round, len(rounds))
+	for i, r := range rounds {
+		out[i] = Round{
+			M:  unpackBigInt(r.M),
+			W:  unpackBigInt(r.W),
+			WI: unpackBigInt(r.WI),
+		}
 	}
+	return out
+}
+
+func prepareRounds(rounds []Round) []RoundFile {
+	if len(rounds) == 0 {
+		return nil
+	}
+	out := make([]RoundFile, len(rounds))
+	for i, r := range rounds {
+		out[i] = RoundFile{
+			M:  r.M.Bytes(),
+			W:  r.W.Bytes(),
+			WI: r.WI.Bytes(),
+		}
+	}
+	return out
 }
 
 func unpackKey(keyFile KeyFile) []*big.Int {
@@ -88,6 +253,19 @@ func unpackKey(keyFile KeyFile) []*big.Int {
 	return out
 }
 
+// unpackSliceOfBigs is the inverse of prepareSliceOfBigs; empty slices come
+// back as nil
+func unpackSliceOfBigs(arr [][]byte) []*big.Int {
+	if len(arr) == 0 {
+		return nil
+	}
+	out := make([]*big.Int, len(arr))
+	for i, bs := range arr {
+		out[i] = unpackBigInt(bs)
+	}
+	return out
+}
+
 func unpackBigInt(b []byte) *big.Int {
 	return new(big.Int).SetBytes(b)
 }
@@ -101,3 +279,383 @@ func prepareSliceOfBigs(arr []*big.Int) [][]byte {
 
 	return out
 }
+
+// NaccacheSternPublicKeyFile contains a Naccache–Stern public key and modulus
+// and is suitable for sharing
+type NaccacheSternPublicKeyFile struct {
+	PubKey [][]byte
+	P      []byte // prime modulus
+}
+
+// NaccacheSternPrivateKeyFile contains the private constants of a
+// Naccache–Stern key
+type NaccacheSternPrivateKeyFile struct {
+	Primes [][]byte // small primes
+	P      []byte   // prime modulus
+	S      []byte   // secret exponent
+}
+
+// GetKey returns the public key
+func (p NaccacheSternPublicKeyFile) GetKey() [][]byte {
+	return p.PubKey
+}
+
+// GetKey returns the small primes
+func (p NaccacheSternPrivateKeyFile) GetKey() [][]byte {
+	return p.Primes
+}
+
+// PackNaccacheStern serializes a Naccache–Stern key and returns the packed
+// bytes (NaccacheSternPublicKeyFile, NaccacheSternPrivateKeyFile, error)
+func PackNaccacheStern(ns NaccacheStern) ([]byte, []byte, error) {
+	pub, err := msgpack.Marshal(&NaccacheSternPublicKeyFile{
+		PubKey: prepareSliceOfBigs(ns.PublicKey),
+		P:      ns.P.Bytes(),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	priv, err := msgpack.Marshal(&NaccacheSternPrivateKeyFile{
+		Primes: prepareSliceOfBigs(ns.Primes),
+		P:      ns.P.Bytes(),
+		S:      ns.S.Bytes(),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return pub, priv, nil
+}
+
+// UnpackNaccacheSternPublic returns the public key and modulus from a
+// Naccache–Stern public key file
+func UnpackNaccacheSternPublic(pubKeyFile *NaccacheSternPublicKeyFile) ([]*big.Int, *big.Int) {
+	return unpackKey(pubKeyFile), unpackBigInt(pubKeyFile.P)
+}
+
+// UnpackNaccacheSternPrivate returns a NaccacheStern by deserializing the
+// private key params. Keys that fail NaccacheStern.Validate are rejected, and
+// the public key is recomputed.
+func UnpackNaccacheSternPrivate(privKeyFile *NaccacheSternPrivateKeyFile) (*NaccacheStern, error) {
+	ns := &NaccacheStern{
+		Primes: unpackKey(privKeyFile),
+		P:      unpackBigInt(privKeyFile.P),
+		S:      unpackBigInt(privKeyFile.S),
+	}
+	if err := ns.Validate(); err != nil {
+		return nil, err
+	}
+	ns.PublicKey = ns.DerivePublicKey()
+	return ns, nil
+}
+
+// ChorRivestPublicKeyFile contains a Chor–Rivest public key and the field it
+// works in, and is suitable for sharing
+type ChorRivestPublicKeyFile struct {
+	PubKey [][]byte
+	P      int64 // characteristic of the field
+	H      int64 // degree of the extension
+}
+
+// ChorRivestPrivateKeyFile contains the private constants of a Chor–Rivest
+// key. The public key takes a discrete log per element to recompute.
+type ChorRivestPrivateKeyFile struct {
+	P    int64   // characteristic of the field
+	H    int64   // degree of the extension
+	F    []int64 // irreducible polynomial, lowest coefficient first
+	G    []int64 // generator of the multiplicative group
+	Perm []int   // public key index permutation
+	D    []byte  // random offset added to every log
+}
+
+// GetKey returns the public key
+func (p ChorRivestPublicKeyFile) GetKey() [][]byte {
+	return p.PubKey
+}
+
+// PackChorRivest serializes a Chor–Rivest key and returns the packed bytes
+// (ChorRivestPublicKeyFile, ChorRivestPrivateKeyFile, error)
+func PackChorRivest(cr ChorRivest) ([]byte, []byte, error) {
+	pub, err := msgpack.Marshal(&ChorRivestPublicKeyFile{
+		PubKey: prepareSliceOfBigs(cr.PublicKey),
+		P:      cr.P,
+		H:      cr.H,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	priv, err := msgpack.Marshal(&ChorRivestPrivateKeyFile{
+		P:    cr.P,
+		H:    cr.H,
+		F:    cr.F,
+		G:    cr.G,
+		Perm: cr.Perm,
+		D:    cr.D.Bytes(),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return pub, priv, nil
+}
+
+// UnpackChorRivestPublic returns the public key and field parameters p and h
+// from a Chor–Rivest public key file
+func UnpackChorRivestPublic(pubKeyFile *ChorRivestPublicKeyFile) ([]*big.Int, int64, int64) {
+	return unpackKey(pubKeyFile), pubKeyFile.P, pubKeyFile.H
+}
+
+// UnpackChorRivestPrivate returns a ChorRivest by deserializing the private
+// key params. Keys that fail ChorRivest.Validate are rejected, and the public
+// key is recomputed.
+func UnpackChorRivestPrivate(privKeyFile *ChorRivestPrivateKeyFile) (*ChorRivest, error) {
+	cr := &ChorRivest{
+		P:    privKeyFile.P,
+		H:    privKeyFile.H,
+		F:    privKeyFile.F,
+		G:    privKeyFile.G,
+		Perm: privKeyFile.Perm,
+		D:    unpackBigInt(privKeyFile.D),
+	}
+	if err := cr.Validate(); err != nil {
+		return nil, err
+	}
+	var err error
+	if cr.PublicKey, err = cr.DerivePublicKey(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// LPSPublicKeyFile contains an LPS public key and is suitable for sharing
+type LPSPublicKeyFile struct {
+	PubKey [][]byte // weights
+	T      []byte   // target
+	Q      int64    // digit modulus
+	Digits int64    // base Q digits per weight
+}
+
+// LPSPrivateKeyFile contains an LPS secret along with the weights, which the
+// public key is recomputed from
+type LPSPrivateKeyFile struct {
+	PubKey [][]byte // weights
+	Q      int64    // digit modulus
+	Digits int64    // base Q digits per weight
+	S      []byte   // secret bits, packed 8 to a byte and filled out with zeros
+}
+
+// GetKey returns the weights
+func (p LPSPublicKeyFile) GetKey() [][]byte {
+	return p.PubKey
+}
+
+// GetKey returns the weights
+func (p LPSPrivateKeyFile) GetKey() [][]byte {
+	return p.PubKey
+}
+
+// PackLPS serializes an LPS key and returns the packed bytes
+// (LPSPublicKeyFile, LPSPrivateKeyFile, error)
+func PackLPS(l LPS) ([]byte, []byte, error) {
+	pub, err := msgpack.Marshal(&LPSPublicKeyFile{
+		PubKey: prepareSliceOfBigs(l.PublicKey),
+		T:      l.T.Bytes(),
+		Q:      l.Q,
+		Digits: l.Digits,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	priv, err := msgpack.Marshal(&LPSPrivateKeyFile{
+		PubKey: prepareSliceOfBigs(l.PublicKey),
+		Q:      l.Q,
+		Digits: l.Digits,
+		S:      bitsToBytes(append(append([]byte(nil), l.S...), make([]byte, 7)...)),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return pub, priv, nil
+}
+
+// UnpackLPSPublic returns the weights, target, digit modulus and number of
+// digits from an LPS public key file
+func UnpackLPSPublic(pubKeyFile *LPSPublicKeyFile) ([]*big.Int, *big.Int, int64, int64) {
+	return unpackKey(pubKeyFile), unpackBigInt(pubKeyFile.T), pubKeyFile.Q, pubKeyFile.Digits
+}
+
+// UnpackLPSPrivate returns an LPS by deserializing the private key params.
+// Keys that fail LPS.Validate are rejected, and the target is recomputed.
+func UnpackLPSPrivate(privKeyFile *LPSPrivateKeyFile) (*LPS, error) {
+	l := &LPS{
+		PublicKey: unpackKey(privKeyFile),
+		Q:         privKeyFile.Q,
+		Digits:    privKeyFile.Digits,
+	}
+	// the last byte is filled out with zero bits
+	s := bytesToBits(privKeyFile.S)
+	if len(s) != (len(l.PublicKey)+7)/8*8 || bytes.IndexByte(s[len(l.PublicKey):], 1) >= 0 {
+		return nil, fmt.Errorf("%w: secret doesn't have a bit per weight", ErrMissingParameter)
+	}
+	l.S = s[:len(l.PublicKey)]
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+	l.T = l.DeriveTarget()
+	return l, nil
+}
+
+// OTUPublicKeyFile contains an OTU public key and is suitable for sharing
+type OTUPublicKeyFile struct {
+	PubKey [][]byte
+	K      int64 // number of elements every block selects
+}
+
+// OTUPrivateKeyFile contains the private constants of an OTU key
+type OTUPrivateKeyFile struct {
+	K      int64    // number of elements every block selects
+	Primes [][]byte // small primes, in public key order
+	P      []byte   // prime modulus
+	G      []byte   // generator mod P
+	D      []byte   // random offset added to every log
+}
+
+// GetKey returns the public key
+func (p OTUPublicKeyFile) GetKey() [][]byte {
+	return p.PubKey
+}
+
+// GetKey returns the small primes
+func (p OTUPrivateKeyFile) GetKey() [][]byte {
+	return p.Primes
+}
+
+// PackOTU serializes an OTU key and returns the packed bytes
+// (OTUPublicKeyFile, OTUPrivateKeyFile, error)
+func PackOTU(o OTU) ([]byte, []byte, error) {
+	pub, err := msgpack.Marshal(&OTUPublicKeyFile{
+		PubKey: prepareSliceOfBigs(o.PublicKey),
+		K:      o.K,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	priv, err := msgpack.Marshal(&OTUPrivateKeyFile{
+		K:      o.K,
+		Primes: prepareSliceOfBigs(o.Primes),
+		P:      o.P.Bytes(),
+		G:      o.G.Bytes(),
+		D:      o.D.Bytes(),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return pub, priv, nil
+}
+
+// UnpackOTUPublic returns the public key and weight from an OTU public key file
+func UnpackOTUPublic(pubKeyFile *OTUPublicKeyFile) ([]*big.Int, int64) {
+	return unpackKey(pubKeyFile), pubKeyFile.K
+}
+
+// UnpackOTUPrivate returns an OTU by deserializing the private key params.
+// Keys that fail OTU.Validate are rejected, and the public key is recomputed.
+func UnpackOTUPrivate(privKeyFile *OTUPrivateKeyFile) (*OTU, error) {
+	o := &OTU{
+		K:      privKeyFile.K,
+		Primes: unpackKey(privKeyFile),
+		P:      unpackBigInt(privKeyFile.P),
+		G:      unpackBigInt(privKeyFile.G),
+		D:      unpackBigInt(privKeyFile.D),
+	}
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	var err error
+	if o.PublicKey, err = o.DerivePublicKey(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// the first byte of every serialized ciphertext says how the rest is laid out
+const (
+	formatBlocks = 1 // knapsack blocks, see packCiphertext
+	formatHybrid = 2 // knapsack-encrypted AES key and an AES-GCM payload, see EncryptBytesHybrid
+	// knapsack blocks with randomized padding, see EncryptBytesRandomized
+	formatRandomized = 3
+	// AES key encrypted for each of several public keys and an AES-GCM payload,
+	// see EncryptBytesMulti
+	formatMultiRecipient = 4
+	// digit bits byte and compact knapsack blocks, see EncryptBytesCompact
+	formatCompact = 5
+	// Naccache–Stern blocks, see EncryptBytesNaccacheStern
+	formatNaccacheStern = 6
+	// Chor–Rivest blocks, see EncryptBytesChorRivest
+	formatChorRivest = 7
+	// LPS subset sum blocks, see EncryptBytesLPS
+	formatLPS = 8
+	// Okamoto–Tanaka–Uchiyama blocks, see EncryptBytesOTU
+	formatOTU = 9
+)
+
+// maxBlockSize limits how big a single serialized block can claim to be, so a
+// corrupt length can't make us allocate unbounded memory
+const maxBlockSize = 1 << 20
+
+// packCiphertext serializes ciphertext blocks as a format byte followed by
+// each block (see appendBlock)
+func packCiphertext(format byte, blocks []*big.Int) []byte {
+	out := []byte{format}
+	for _, block := range blocks {
+		out = appendBlock(out, block)
+	}
+	return out
+}
+
+// unpackCiphertext is the inverse of packCiphertext
+func unpackCiphertext(format byte, ct []byte) ([]*big.Int, error) {
+	if len(ct) == 0 || ct[0] != format {
+		return nil, fmt.Errorf("%w: unsupported format", ErrMalformedCiphertext)
+	}
+	r := bufio.NewReader(bytes.NewReader(ct[1:]))
+	blocks := make([]*big.Int, 0)
+	for {
+		block, err := readBlock(r)
+		if err == io.EOF {
+			return blocks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+}
+
+// appendBlock serializes a ciphertext block as its length (uvarint) and
+// big-endian bytes
+func appendBlock(b []byte, block *big.Int) []byte {
+	blockBytes := block.Bytes()
+	b = appendUvarint(b, uint64(len(blockBytes)))
+	return append(b, blockBytes...)
+}
+
+// readBlock reads a block written by appendBlock. It returns io.EOF only if
+// there are no more blocks.
+func readBlock(r *bufio.Reader) (*big.Int, error) {
+	blockLen, err := binary.ReadUvarint(r)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil || blockLen > maxBlockSize {
+		return nil, ErrMalformedCiphertext
+	}
+	b := make([]byte, blockLen)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, ErrMalformedCiphertext
+	}
+	return unpackBigInt(b), nil
+}
+
+func appendUvarint(b []byte, n uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return append(b, buf[:binary.PutUvarint(buf, n)]...)
+}
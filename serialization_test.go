@@ -1,6 +1,9 @@
 package knapsack
 
 import (
+	"crypto/rand"
+	"errors"
+	"math/big"
 	"testing"
 
 	"github.com/vmihailenco/msgpack"
@@ -22,13 +25,140 @@ func TestPackUnpack(t *testing.T) {
 	err = msgpack.Unmarshal(privKeyFile, &b)
 	handleFatalError(err, t)
 
-	kUnpacked := Unpack(&a, &b)
+	kUnpacked, err := Unpack(&a, &b)
+	handleFatalError(err, t)
+
+	if equal, msg := equalKnapsacks(k, kUnpacked); !equal {
+		t.Error(msg)
+	}
+}
+
+func TestUnpackLegacyPrivateKeyFile(t *testing.T) {
+	// private key files written before index mangling have no Perm field
+	legacy := struct {
+		PrivKey [][]byte
+		M       []byte
+		W       []byte
+		WI      []byte
+	}{
+		PrivKey: [][]byte{{5}, {10}, {17}, {33}, {70}},
+		M:       []byte{149},
+		W:       []byte{31},
+		WI:      []byte{125},
+	}
+	raw, err := msgpack.Marshal(&legacy)
+	handleFatalError(err, t)
+
+	skf := PrivateKeyFile{}
+	err = msgpack.Unmarshal(raw, &skf)
+	handleFatalError(err, t)
+
+	k, err := UnpackPrivate(&skf)
+	handleFatalError(err, t)
+	if k.Perm != nil {
+		t.Errorf("wanted no permutation, got %v", k.Perm)
+	}
+}
+
+func TestPackUnpackIterated(t *testing.T) {
+	k, err := NewKnapsackWithOptions(rand.Reader, KeygenOptions{Length: 30, Growth: 30, ModulusBits: 62, Rounds: 3})
+	handleFatalError(err, t)
+
+	pubKeyFile, privKeyFile, err := Pack(*k)
+	handleFatalError(err, t)
 
+	a := PublicKeyFile{}
+	b := PrivateKeyFile{}
+	handleFatalError(msgpack.Unmarshal(pubKeyFile, &a), t)
+	handleFatalError(msgpack.Unmarshal(privKeyFile, &b), t)
+
+	kUnpacked, err := Unpack(&a, &b)
+	handleFatalError(err, t)
 	if equal, msg := equalKnapsacks(k, kUnpacked); !equal {
 		t.Error(msg)
 	}
 }
 
+func TestUnpackPrivateDerivesPublicKey(t *testing.T) {
+	k, err := NewKnapsack(50)
+	handleFatalError(err, t)
+
+	_, privKeyFile, err := Pack(*k)
+	handleFatalError(err, t)
+	b := PrivateKeyFile{}
+	handleFatalError(msgpack.Unmarshal(privKeyFile, &b), t)
+
+	kUnpacked, err := UnpackPrivate(&b)
+	handleFatalError(err, t)
+	if equal, msg := equalKnapsacks(k, kUnpacked); !equal {
+		t.Error(msg)
+	}
+
+	// the derived public key round trips through its own file
+	pubKeyFile, err := PackPublic(kUnpacked.Public().(*KnapsackPublicKey))
+	handleFatalError(err, t)
+	a := PublicKeyFile{}
+	handleFatalError(msgpack.Unmarshal(pubKeyFile, &a), t)
+	if _, err := Unpack(&a, &b); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUnpackRejectsMismatchedFiles(t *testing.T) {
+	ka, err := NewKnapsack(20)
+	handleFatalError(err, t)
+	kb, err := NewKnapsack(20)
+	handleFatalError(err, t)
+
+	pubA, _, err := Pack(*ka)
+	handleFatalError(err, t)
+	_, privB, err := Pack(*kb)
+	handleFatalError(err, t)
+
+	a := PublicKeyFile{}
+	b := PrivateKeyFile{}
+	handleFatalError(msgpack.Unmarshal(pubA, &a), t)
+	handleFatalError(msgpack.Unmarshal(privB, &b), t)
+
+	if _, err := Unpack(&a, &b); !errors.Is(err, ErrPublicKeyMismatch) {
+		t.Errorf("wanted ErrPublicKeyMismatch, got %v", err)
+	}
+
+	// hand-edited private key
+	b.W = []byte{0}
+	if _, err := UnpackPrivate(&b); err == nil {
+		t.Error("wanted error for corrupt private key file")
+	}
+}
+
+func TestPackUnpackCiphertext(t *testing.T) {
+	blocks := []*big.Int{big.NewInt(0), big.NewInt(300), new(big.Int).Lsh(big.NewInt(1), 200)}
+	unpacked, err := unpackCiphertext(formatBlocks, packCiphertext(formatBlocks, blocks))
+	handleFatalError(err, t)
+
+	if len(unpacked) != len(blocks) {
+		t.Fatalf("wanted %d blocks, got %d", len(blocks), len(unpacked))
+	}
+	for i, b := range blocks {
+		if unpacked[i].Cmp(b) != 0 {
+			t.Errorf("block %d: wanted %v, got %v", i, b, unpacked[i])
+		}
+	}
+}
+
+func TestUnpackMalformedCiphertext(t *testing.T) {
+	malformed := [][]byte{
+		{},
+		{0x02, 0x01, 0x0a},
+		{formatBlocks, 0x05, 0x0a},
+	}
+	for idx, ct := range malformed {
+		if _, err := unpackCiphertext(formatBlocks, ct); err == nil {
+			t.Errorf("for test case #%d: wanted error, got nil", idx)
+		}
+	}
+}
+
 func handleFatalError(err error, t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
@@ -55,5 +185,35 @@ func equalKnapsacks(ka, kb *Knapsack) (bool, string) {
 	if kb.WI.Cmp(ka.WI) != 0 {
 		return false, "WI unequal"
 	}
+	if len(kb.Iterations) != len(ka.Iterations) {
+		return false, "Iterations unequal"
+	}
+	for i, r := range ka.Iterations {
+		if kb.Iterations[i].M.Cmp(r.M) != 0 || kb.Iterations[i].W.Cmp(r.W) != 0 || kb.Iterations[i].WI.Cmp(r.WI) != 0 {
+			return false, "Iterations unequal"
+		}
+	}
+	if len(kb.Perm) != len(ka.Perm) {
+		return false, "Perm unequal"
+	}
+	for i, idx := range ka.Perm {
+		if kb.Perm[i] != idx {
+			return false, "Perm unequal"
+		}
+	}
+	if kb.DigitBits != ka.DigitBits {
+		return false, "DigitBits unequal"
+	}
+	if kb.LowBits != ka.LowBits {
+		return false, "LowBits unequal"
+	}
+	if len(kb.Moduli) != len(ka.Moduli) {
+		return false, "Moduli unequal"
+	}
+	for i, p := range ka.Moduli {
+		if kb.Moduli[i].Cmp(p) != 0 {
+			return false, "Moduli unequal"
+		}
+	}
 	return true, ""
 }
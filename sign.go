@@ -0,0 +1,286 @@
+package knapsack
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// Signatures use Shamir's fast signature scheme ("A Fast Signature Scheme",
+// Shamir, 1978), a knapsack whose trapdoor is kept apart from the encryption
+// keys. The key is a k-bit prime n, a secret random binary k x 2k matrix H
+// and a public vector a of 2k elements such that
+//
+//   H * a = (1, 2, 4, ..., 2^(k-1)) (mod n)
+//
+// A hash h of the message is signed by drawing a random binary vector r and
+// writing s = h - r * a mod n in binary, s_0 ... s_(k-1). Then
+//
+//   c = r + s * H
+//
+// has c * a = r * a + s = h (mod n), and every c_j is at most k + 1. The
+// verifier only needs a and n; finding small c for a hash without H is a
+// knapsack problem. r hides which rows of H were added, but not perfectly:
+// Odlyzko (1984) showed how to forge once enough signatures are known, so this
+// is a toy like the rest of the package.
+
+const (
+	signatureVersion = 1
+	// minSigningBits is the smallest modulus for a signing key
+	minSigningBits = 16
+)
+
+var (
+	// ErrInvalidSignature means the signature doesn't match the message and key
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrVerifierKey means a public key file is a signature verification key
+	// (see PackVerifier), which can't be encrypted to
+	ErrVerifierKey = errors.New("public key file is a signature verification key; it can't be encrypted to")
+	// ErrSigningKeyMismatch means H * a isn't the powers of two mod n
+	ErrSigningKeyMismatch = errors.New("signing key matrix does not match its public key")
+)
+
+// SigningKey contains the private data of a Shamir fast signature key
+type SigningKey struct {
+	PublicKey []*big.Int // a, 2k elements
+	N         *big.Int   // k-bit prime modulus, published with the public key
+	// H is the secret matrix, one row per bit of N: bit j of H[i] is H_ij
+	H []*big.Int
+}
+
+// NewSigningKey auto generates a signing key with a `keyBits` bit modulus
+func NewSigningKey(keyBits int64) (*SigningKey, error) {
+	return NewSigningKeyWithReader(rand.Reader, keyBits)
+}
+
+// NewSigningKeyWithReader generates a signing key using randomness read from
+// `random`. Passing a deterministic reader (see NewSeededReader) regenerates
+// the same key every time.
+func NewSigningKeyWithReader(random io.Reader, keyBits int64) (*SigningKey, error) {
+	if keyBits < minSigningBits {
+		return nil, fmt.Errorf("signing keys need at least %d bits", minSigningBits)
+	}
+	k := int(keyBits)
+	one := big.NewInt(1)
+	min := new(big.Int).Lsh(one, uint(k-1))
+	max := new(big.Int).Lsh(one, uint(k))
+	var n *big.Int
+	for {
+		p, err := randomUniform(random, min, max)
+		if err != nil {
+			return nil, err
+		}
+		if p.SetBit(p, 0, 1).ProbablyPrime(32) {
+			n = p
+			break
+		}
+	}
+
+	// the last k elements of a are random and the first k are solved for,
+	// which needs the first k columns of H to be invertible mod n
+	rowMax := new(big.Int).Lsh(one, uint(2*k))
+	for {
+		h := make([]*big.Int, k)
+		for i := range h {
+			row, err := randomInt(random, rowMax)
+			if err != nil {
+				return nil, err
+			}
+			h[i] = row
+		}
+		a := make([]*big.Int, 2*k)
+		for j := k; j < 2*k; j++ {
+			e, err := randomInt(random, n)
+			if err != nil {
+				return nil, err
+			}
+			a[j] = e
+		}
+
+		square := make([][]*big.Int, k)
+		rhs := make([]*big.Int, k)
+		for i, row := range h {
+			square[i] = make([]*big.Int, k)
+			for j := range square[i] {
+				square[i][j] = big.NewInt(int64(row.Bit(j)))
+			}
+			rhs[i] = new(big.Int).Lsh(one, uint(i))
+			for j := k; j < 2*k; j++ {
+				if row.Bit(j) == 1 {
+					rhs[i].Sub(rhs[i], a[j])
+				}
+			}
+			rhs[i].Mod(rhs[i], n)
+		}
+		x, ok := solveLinearMod(square, rhs, n)
+		if !ok {
+			continue
+		}
+		copy(a, x)
+		return &SigningKey{PublicKey: a, N: n, H: h}, nil
+	}
+}
+
+// Validate checks the structural invariants of the key and reports the first
+// one that fails
+func (sk *SigningKey) Validate() error {
+	if sk.N == nil || len(sk.H) == 0 || len(sk.PublicKey) == 0 {
+		return fmt.Errorf("%w: N, H and the public key are required", ErrMissingParameter)
+	}
+	if !sk.N.ProbablyPrime(20) {
+		return fmt.Errorf("%w: modulus", ErrNotPrime)
+	}
+	k := sk.N.BitLen()
+	if len(sk.H) != k || len(sk.PublicKey) != 2*k {
+		return fmt.Errorf("%w: a %d bit modulus needs %d rows and %d public key elements, got %d and %d",
+			ErrSigningKeyMismatch, k, k, 2*k, len(sk.H), len(sk.PublicKey))
+	}
+	for idx, n := range sk.PublicKey {
+		if n == nil || n.Sign() < 0 || n.Cmp(sk.N) >= 0 {
+			return fmt.Errorf("%w: public key element %d is not in [0, N)", ErrSigningKeyMismatch, idx)
+		}
+	}
+	sum := new(big.Int)
+	power := new(big.Int)
+	for i, row := range sk.H {
+		if row == nil || row.Sign() < 0 || row.BitLen() > 2*k {
+			return fmt.Errorf("%w: row %d", ErrSigningKeyMismatch, i)
+		}
+		sum.SetInt64(0)
+		for j, n := range sk.PublicKey {
+			if row.Bit(j) == 1 {
+				sum.Add(sum, n)
+			}
+		}
+		if sum.Mod(sum, sk.N).Cmp(power.Lsh(big.NewInt(1), uint(i))) != 0 {
+			return fmt.Errorf("%w: row %d", ErrSigningKeyMismatch, i)
+		}
+	}
+	return nil
+}
+
+// Sign signs `message` with randomness from crypto/rand. Verify the signature
+// with the public key and modulus (see PackVerifier).
+func (sk *SigningKey) Sign(message []byte) ([]byte, error) {
+	return sk.SignWithReader(rand.Reader, message)
+}
+
+// SignWithReader signs `message` using randomness read from `random`
+func (sk *SigningKey) SignWithReader(random io.Reader, message []byte) ([]byte, error) {
+	r, err := randomInt(random, new(big.Int).Lsh(big.NewInt(1), uint(len(sk.PublicKey))))
+	if err != nil {
+		return nil, err
+	}
+	s := hashToInt(message, sk.N)
+	for j, n := range sk.PublicKey {
+		if r.Bit(j) == 1 {
+			s.Sub(s, n)
+		}
+	}
+	s.Mod(s, sk.N)
+
+	sig := []byte{signatureVersion}
+	for j := range sk.PublicKey {
+		digit := uint64(r.Bit(j))
+		for i, row := range sk.H {
+			digit += uint64(s.Bit(i) & row.Bit(j))
+		}
+		sig = appendUvarint(sig, digit)
+	}
+	return sig, nil
+}
+
+// Verify checks that `signature` was made by the owner of `publicKey` (and
+// `modulus`) for `message`. It returns ErrInvalidSignature if not.
+func Verify(publicKey []*big.Int, modulus *big.Int, message, signature []byte) error {
+	if len(signature) == 0 || signature[0] != signatureVersion {
+		return fmt.Errorf("%w: unsupported version", ErrInvalidSignature)
+	}
+	// without a bound on the digits anyone who knows the modulus could solve
+	// for a single one
+	maxDigit := uint64(modulus.BitLen() + 1)
+	total := new(big.Int)
+	term := new(big.Int)
+	rest := signature[1:]
+	for idx, n := range publicKey {
+		digit, size := binary.Uvarint(rest)
+		if size <= 0 {
+			return fmt.Errorf("%w: malformed", ErrInvalidSignature)
+		}
+		if digit > maxDigit {
+			return fmt.Errorf("%w: digit %d out of range", ErrInvalidSignature, idx)
+		}
+		rest = rest[size:]
+		term.Mul(n, term.SetUint64(digit))
+		total.Add(total, term)
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("%w: wrong length", ErrInvalidSignature)
+	}
+	if total.Mod(total, modulus).Cmp(hashToInt(message, modulus)) != 0 {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// solves m * x = b (mod p) for a square matrix m by Gaussian elimination. m
+// and b are overwritten. It returns false if m isn't invertible mod p.
+func solveLinearMod(m [][]*big.Int, b []*big.Int, p *big.Int) ([]*big.Int, bool) {
+	size := len(m)
+	inv := new(big.Int)
+	t := new(big.Int)
+	for col := 0; col < size; col++ {
+		pivot := -1
+		for row := col; row < size; row++ {
+			if m[row][col].Sign() != 0 {
+				pivot = row
+				break
+			}
+		}
+		if pivot < 0 {
+			return nil, false
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		b[col], b[pivot] = b[pivot], b[col]
+
+		// scale the pivot row so the pivot is 1, then clear the column in
+		// every other row
+		inv.ModInverse(m[col][col], p)
+		for j := col; j < size; j++ {
+			m[col][j].Mul(m[col][j], inv).Mod(m[col][j], p)
+		}
+		b[col].Mul(b[col], inv).Mod(b[col], p)
+		for row := 0; row < size; row++ {
+			if row == col || m[row][col].Sign() == 0 {
+				continue
+			}
+			factor := new(big.Int).Set(m[row][col])
+			for j := col; j < size; j++ {
+				t.Mul(factor, m[col][j])
+				m[row][j].Sub(m[row][j], t).Mod(m[row][j], p)
+			}
+			t.Mul(factor, b[col])
+			b[row].Sub(b[row], t).Mod(b[row], p)
+		}
+	}
+	return b, true
+}
+
+// hashes the message to an integer in [0, m). the hash is stretched 64 bits
+// past the size of m so the reduction is close to uniform.
+func hashToInt(message []byte, m *big.Int) *big.Int {
+	msgHash := sha256.Sum256(message)
+	var out []byte
+	for block := uint64(0); len(out)*8 < m.BitLen()+64; block++ {
+		h := sha256.New()
+		h.Write([]byte("knapsack signature\x00"))
+		h.Write(appendUvarint(nil, block))
+		h.Write(msgHash[:])
+		out = h.Sum(out)
+	}
+	return new(big.Int).Mod(new(big.Int).SetBytes(out), m)
+}
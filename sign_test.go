@@ -0,0 +1,155 @@
+package knapsack
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+func TestSignVerify(t *testing.T) {
+	for _, bits := range []int64{16, 64, 100} {
+		sk, err := NewSigningKey(bits)
+		handleFatalError(err, t)
+		handleFatalError(sk.Validate(), t)
+
+		msg := []byte("hello world")
+		sig, err := sk.Sign(msg)
+		handleFatalError(err, t)
+		t.Logf("Signature: %x\n", sig)
+
+		if err := Verify(sk.PublicKey, sk.N, msg, sig); err != nil {
+			t.Errorf("for %d bits: wanted valid signature, got %v", bits, err)
+		}
+		if err := Verify(sk.PublicKey, sk.N, []byte("hello world!"), sig); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("for %d bits: wanted ErrInvalidSignature for different message, got %v", bits, err)
+		}
+
+		// every signature is different, and every one verifies
+		again, err := sk.Sign(msg)
+		handleFatalError(err, t)
+		if bytes.Equal(sig, again) {
+			t.Errorf("for %d bits: wanted signatures to be randomized", bits)
+		}
+		if err := Verify(sk.PublicKey, sk.N, msg, again); err != nil {
+			t.Errorf("for %d bits: wanted valid signature, got %v", bits, err)
+		}
+
+		other, err := NewSigningKey(bits)
+		handleFatalError(err, t)
+		if err := Verify(other.PublicKey, other.N, msg, sig); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("for %d bits: wanted ErrInvalidSignature for different key, got %v", bits, err)
+		}
+	}
+}
+
+func TestVerifyRejectsMalformedSignatures(t *testing.T) {
+	sk, err := NewSigningKey(32)
+	handleFatalError(err, t)
+	msg := []byte("hello world")
+	sig, err := sk.Sign(msg)
+	handleFatalError(err, t)
+
+	// a single digit big enough to hit the hash on its own
+	h := hashToInt(msg, sk.N)
+	h.Mul(h, new(big.Int).ModInverse(sk.PublicKey[0], sk.N)).Mod(h, sk.N)
+	forged := appendUvarint([]byte{signatureVersion}, h.Uint64())
+	for range sk.PublicKey[1:] {
+		forged = append(forged, 0)
+	}
+
+	testCases := [][]byte{
+		nil,
+		{signatureVersion + 1},
+		sig[:len(sig)-1],
+		append(append([]byte(nil), sig...), 0),
+		forged,
+	}
+	for idx, tc := range testCases {
+		if err := Verify(sk.PublicKey, sk.N, msg, tc); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("for test case #%d: wanted ErrInvalidSignature, got %v", idx, err)
+		}
+	}
+}
+
+func TestSigningKeyFromSeed(t *testing.T) {
+	a, err := NewSigningKeyWithReader(NewSeededReader([]byte("sign")), 32)
+	handleFatalError(err, t)
+	b, err := NewSigningKeyWithReader(NewSeededReader([]byte("sign")), 32)
+	handleFatalError(err, t)
+	if a.N.Cmp(b.N) != 0 || !bytes.Equal(PublicKeyFingerprint(a.PublicKey), PublicKeyFingerprint(b.PublicKey)) {
+		t.Error("wanted the same signing key from the same seed")
+	}
+	if _, err := NewSigningKey(minSigningBits - 1); err == nil {
+		t.Error("wanted error for a tiny modulus")
+	}
+}
+
+func TestValidateSigningKey(t *testing.T) {
+	sk, err := NewSigningKey(32)
+	handleFatalError(err, t)
+
+	broken := *sk
+	broken.H = append([]*big.Int(nil), sk.H...)
+	broken.H[3] = new(big.Int).SetBit(sk.H[3], 5, sk.H[3].Bit(5)^1)
+	if err := broken.Validate(); !errors.Is(err, ErrSigningKeyMismatch) {
+		t.Errorf("wanted ErrSigningKeyMismatch for a changed matrix, got %v", err)
+	}
+
+	broken = *sk
+	broken.PublicKey = sk.PublicKey[1:]
+	if err := broken.Validate(); !errors.Is(err, ErrSigningKeyMismatch) {
+		t.Errorf("wanted ErrSigningKeyMismatch for a short public key, got %v", err)
+	}
+
+	broken = *sk
+	broken.N = new(big.Int).Add(sk.N, big.NewInt(1))
+	if err := broken.Validate(); !errors.Is(err, ErrNotPrime) {
+		t.Errorf("wanted ErrNotPrime, got %v", err)
+	}
+}
+
+func TestPackUnpackSigningKey(t *testing.T) {
+	sk, err := NewSigningKey(50)
+	handleFatalError(err, t)
+
+	pub, priv, err := PackSigningKey(*sk)
+	handleFatalError(err, t)
+	pkf := PublicKeyFile{}
+	handleFatalError(msgpack.Unmarshal(pub, &pkf), t)
+
+	pk, m, err := UnpackVerifier(&pkf)
+	handleFatalError(err, t)
+	if m.Cmp(sk.N) != 0 || len(pk) != len(sk.PublicKey) {
+		t.Error("verifier didn't round trip")
+	}
+
+	unpacked, err := UnmarshalSigningKey(priv)
+	handleFatalError(err, t)
+	sig, err := unpacked.Sign([]byte("hello world"))
+	handleFatalError(err, t)
+	if err := Verify(pk, m, []byte("hello world"), sig); err != nil {
+		t.Errorf("wanted valid signature from the unpacked key, got %v", err)
+	}
+
+	// neither file is taken for the other kind of key
+	if _, err := UnmarshalSigningKey(pub); !errors.Is(err, ErrWrongScheme) {
+		t.Errorf("wanted ErrWrongScheme for a verifier file, got %v", err)
+	}
+	if _, _, err := UnmarshalPrivateKey(priv); !errors.Is(err, ErrUnknownScheme) {
+		t.Errorf("wanted ErrUnknownScheme for a signing key file, got %v", err)
+	}
+
+	// regular public key files don't carry the modulus
+	k, err := NewKnapsack(20)
+	handleFatalError(err, t)
+	raw, err := PackPublic(&KnapsackPublicKey{Key: k.PublicKey})
+	handleFatalError(err, t)
+	pkf = PublicKeyFile{}
+	handleFatalError(msgpack.Unmarshal(raw, &pkf), t)
+	if _, _, err := UnpackVerifier(&pkf); err == nil {
+		t.Error("wanted error for public key file without modulus")
+	}
+}
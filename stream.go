@@ -0,0 +1,520 @@
+package knapsack
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+)
+
+// Mode selects the ciphertext layout an Encryptor writes. A Decryptor detects
+// the mode from the first byte of the ciphertext.
+type Mode byte
+
+const (
+	// ModeTextbook is deterministic knapsack encryption, see EncryptBytes
+	ModeTextbook Mode = formatBlocks
+	// ModeHybrid encrypts with AES-GCM and only knapsack-encrypts the key, see EncryptBytesHybrid
+	ModeHybrid Mode = formatHybrid
+	// ModeRandomized is knapsack encryption with randomized padding, see EncryptBytesRandomized
+	ModeRandomized Mode = formatRandomized
+	// ModeMultiRecipient is hybrid encryption for several public keys, see EncryptBytesMulti
+	ModeMultiRecipient Mode = formatMultiRecipient
+	// ModeCompact is deterministic compact knapsack encryption, see EncryptBytesCompact
+	ModeCompact Mode = formatCompact
+	// ModeNaccacheStern is Naccache–Stern encryption, see NewNaccacheSternEncryptor
+	ModeNaccacheStern Mode = formatNaccacheStern
+	// ModeChorRivest is Chor–Rivest encryption, see NewChorRivestEncryptor
+	ModeChorRivest Mode = formatChorRivest
+	// ModeLPS is Lyubashevsky–Palacio–Segev subset sum encryption, see NewLPSEncryptor
+	ModeLPS Mode = formatLPS
+	// ModeOTU is Okamoto–Tanaka–Uchiyama encryption, see NewOTUEncryptor
+	ModeOTU Mode = formatOTU
+)
+
+// Encryptor is an io.WriteCloser that encrypts everything written to it and
+// writes the ciphertext to the underlying writer as it goes, a batch of
+// key-sized frames (or an AES-GCM chunk in ModeHybrid) at a time. Close must be
+// called to write the final frames; it doesn't close the underlying writer.
+type Encryptor struct {
+	// Mode can be changed before the first Write. It defaults to ModeTextbook.
+	Mode Mode
+	// Rand is the source of randomness for ModeRandomized and ModeHybrid.
+	// It defaults to crypto/rand.Reader.
+	Rand io.Reader
+	// Jobs is how many frames are encrypted at once. Zero (the default) means
+	// one per CPU. The ciphertext is the same whatever it's set to.
+	Jobs int
+	// DigitBits is the number of message bits per public key element in
+	// ModeCompact. It must match the key (see KeygenOptions.DigitBits).
+	DigitBits int
+
+	w            io.Writer
+	publicKey    []*big.Int
+	recipients   [][]*big.Int
+	encryptBlock func([]byte) (*big.Int, error) // replaces encrypt for other schemes
+	scheme       Mode                           // the only mode encryptBlock works in
+	started      bool
+	closed       bool
+	err          error
+
+	// knapsack modes: message bits waiting to fill a batch of frames
+	capacity int
+	batch    int
+	mask     func([]byte) ([]byte, error)
+	bits     []byte
+
+	// hybrid mode: plaintext waiting to fill a chunk
+	aead  cipher.AEAD
+	chunk uint64
+	plain []byte
+}
+
+// NewEncryptor returns an Encryptor writing ciphertext for `publicKey` to `w`
+func NewEncryptor(w io.Writer, publicKey []*big.Int) *Encryptor {
+	return &Encryptor{
+		Mode:      ModeTextbook,
+		Rand:      rand.Reader,
+		w:         w,
+		publicKey: publicKey,
+	}
+}
+
+// NewMultiEncryptor returns an Encryptor in ModeMultiRecipient writing
+// ciphertext that any of `publicKeys` can decrypt to `w`
+func NewMultiEncryptor(w io.Writer, publicKeys [][]*big.Int) *Encryptor {
+	e := NewEncryptor(w, nil)
+	e.Mode = ModeMultiRecipient
+	e.recipients = publicKeys
+	return e
+}
+
+// newSchemeEncryptor returns an Encryptor for another scheme, which only
+// works in `mode`: `encryptBlock` encrypts `capacity` bits at a time
+func newSchemeEncryptor(w io.Writer, mode Mode, capacity int, encryptBlock func([]byte) (*big.Int, error)) *Encryptor {
+	e := NewEncryptor(w, nil)
+	e.Mode = mode
+	e.scheme = mode
+	e.capacity = capacity
+	e.encryptBlock = encryptBlock
+	return e
+}
+
+// Write encrypts p, writing out every frame it completes
+func (e *Encryptor) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("write to closed Encryptor")
+	}
+	if err := e.start(); err != nil {
+		return 0, err
+	}
+
+	if e.aead != nil {
+		e.plain = append(e.plain, p...)
+		// the last chunk is sealed differently, so only seal a chunk once
+		// there's more data after it
+		for len(e.plain) > hybridChunkSize {
+			if err := e.seal(e.plain[:hybridChunkSize], false); err != nil {
+				return 0, err
+			}
+			e.plain = append(e.plain[:0], e.plain[hybridChunkSize:]...)
+		}
+		return len(p), nil
+	}
+
+	e.bits = append(e.bits, bytesToBits(p)...)
+	batchBits := e.batch * e.capacity
+	for len(e.bits) >= batchBits {
+		if err := e.writeBlocks(e.bits[:batchBits]); err != nil {
+			return 0, err
+		}
+		e.bits = append(e.bits[:0], e.bits[batchBits:]...)
+	}
+	return len(p), nil
+}
+
+// Close pads and writes the final frame
+func (e *Encryptor) Close() error {
+	if e.closed {
+		return e.err
+	}
+	if err := e.start(); err != nil {
+		return err
+	}
+	e.closed = true
+
+	if e.aead != nil {
+		return e.seal(e.plain, true)
+	}
+	return e.writeBlocks(padBits(e.bits, e.capacity))
+}
+
+// start checks the key against the mode and writes the ciphertext header
+func (e *Encryptor) start() error {
+	if e.started {
+		return e.err
+	}
+	e.started = true
+
+	e.batch = workers(e.Jobs) * blocksPerJob
+	if e.recipients != nil && e.Mode != ModeMultiRecipient {
+		e.err = errors.New("only multi-recipient encryption supports several public keys")
+		return e.err
+	}
+	if e.encryptBlock != nil && e.Mode != e.scheme {
+		e.err = fmt.Errorf("this public key only supports encryption mode %d", e.scheme)
+		return e.err
+	}
+	header := []byte{byte(e.Mode)}
+	switch e.Mode {
+	case ModeTextbook:
+		if len(e.publicKey) < 1 {
+			e.err = errors.New("public key must not be empty")
+			return e.err
+		}
+		e.capacity = len(e.publicKey)
+	case ModeRandomized:
+		if len(e.publicKey) < minRandomizedLength {
+			e.err = fmt.Errorf("randomized encryption needs a public key with at least %d elements for a %d bit seed; use hybrid encryption", minRandomizedLength, minSeedBits)
+			return e.err
+		}
+		_, _, e.capacity = randomizedLayout(len(e.publicKey))
+		e.mask = randomizedMask(e.Rand, len(e.publicKey))
+	case ModeCompact:
+		if len(e.publicKey) < 1 {
+			e.err = errors.New("public key must not be empty")
+			return e.err
+		}
+		if e.DigitBits < 1 || e.DigitBits > maxDigitBits {
+			e.err = fmt.Errorf("%w: %d", ErrInvalidDigitBits, e.DigitBits)
+			return e.err
+		}
+		header = append(header, byte(e.DigitBits))
+		e.capacity = len(e.publicKey) * e.DigitBits
+		e.mask = compactMask(e.DigitBits)
+	case ModeNaccacheStern, ModeChorRivest, ModeLPS, ModeOTU:
+		// other schemes' constructors set encryptBlock and capacity
+		if e.encryptBlock == nil {
+			e.err = fmt.Errorf("encryption mode %d needs its scheme's constructor, e.g. NewNaccacheSternEncryptor", e.Mode)
+			return e.err
+		}
+		if e.capacity < 1 {
+			e.err = ErrInvalidPublicKey
+			return e.err
+		}
+	case ModeHybrid, ModeMultiRecipient:
+		recipients := e.recipients
+		if recipients == nil {
+			recipients = [][]*big.Int{e.publicKey}
+		}
+		if e.Mode == ModeHybrid && len(recipients) != 1 {
+			e.err = errors.New("hybrid encryption needs exactly one public key")
+			return e.err
+		}
+		if len(recipients) == 0 {
+			e.err = errors.New("multi-recipient encryption needs at least one public key")
+			return e.err
+		}
+
+		key := make([]byte, hybridKeySize)
+		if _, e.err = io.ReadFull(e.Rand, key); e.err != nil {
+			return e.err
+		}
+		if e.aead, e.err = newHybridAEAD(key); e.err != nil {
+			return e.err
+		}
+		if e.Mode == ModeHybrid {
+			header, e.err = appendWrappedKey(header, recipients[0], key)
+		} else {
+			header, e.err = appendRecipients(header, recipients, key)
+		}
+		if e.err != nil {
+			return e.err
+		}
+	default:
+		e.err = fmt.Errorf("unknown encryption mode %d", e.Mode)
+		return e.err
+	}
+	_, e.err = e.w.Write(header)
+	return e.err
+}
+
+// encrypts whole frames of message bits, Jobs at a time, and writes them out
+// in order
+func (e *Encryptor) writeBlocks(bits []byte) error {
+	blocks := make([][]byte, len(bits)/e.capacity)
+	for i := range blocks {
+		blocks[i] = bits[i*e.capacity : (i+1)*e.capacity]
+		// masks are made in order so a seeded Rand gives the same ciphertext
+		if e.mask != nil {
+			if blocks[i], e.err = e.mask(blocks[i]); e.err != nil {
+				return e.err
+			}
+		}
+	}
+
+	encryptBlock := e.encryptBlock
+	if encryptBlock == nil {
+		encryptBlock = func(bits []byte) (*big.Int, error) {
+			return encrypt(e.publicKey, bits)
+		}
+	}
+	cts := make([]*big.Int, len(blocks))
+	e.err = runParallel(workers(e.Jobs), len(blocks), func(i int) error {
+		var err error
+		cts[i], err = encryptBlock(blocks[i])
+		return err
+	})
+	if e.err != nil {
+		return e.err
+	}
+
+	var out []byte
+	for _, ct := range cts {
+		out = appendBlock(out, ct)
+	}
+	_, e.err = e.w.Write(out)
+	return e.err
+}
+
+// seals a chunk of plaintext and writes it out
+func (e *Encryptor) seal(plain []byte, last bool) error {
+	_, e.err = e.w.Write(e.aead.Seal(nil, chunkNonce(e.chunk, last), plain, nil))
+	e.chunk++
+	return e.err
+}
+
+// Decryptor is an io.Reader that decrypts a ciphertext written by an Encryptor
+// (or any of the EncryptBytes functions) as it's read. Decryption errors are
+// the same as DecryptBytes returns, and name the block (see DecryptError) or
+// hybrid chunk that failed; everything before it has already been read.
+type Decryptor struct {
+	// Jobs is how many frames are decrypted at once. Zero (the default) means
+	// one per CPU.
+	Jobs int
+
+	r       *bufio.Reader
+	k       *Knapsack
+	scheme  byte // format of another scheme's ciphertext, decrypted by solve, instead of k
+	started bool
+	err     error  // sticky; io.EOF once everything is decrypted
+	out     []byte // decrypted bytes not yet read
+
+	// knapsack modes
+	solve   func(*big.Int) ([]byte, error)
+	unmask  func([]byte) ([]byte, error)
+	block   int    // index of the next block
+	pending []byte // bits of the latest block, which might be the last (padded) one
+	bits    []byte // bits of earlier blocks that didn't make up a whole byte
+
+	// hybrid mode
+	aead  cipher.AEAD
+	chunk uint64
+}
+
+// NewDecryptor returns a Decryptor reading ciphertext from `r` and decrypting
+// it with `k`
+func NewDecryptor(r io.Reader, k *Knapsack) *Decryptor {
+	return &Decryptor{
+		r: bufio.NewReader(r),
+		k: k,
+	}
+}
+
+// newSchemeDecryptor returns a Decryptor for the blocks of another scheme's
+// ciphertext, which must start with `format`; `solve` decrypts a block to bits
+func newSchemeDecryptor(r io.Reader, format byte, solve func(*big.Int) ([]byte, error)) *Decryptor {
+	return &Decryptor{
+		r:      bufio.NewReader(r),
+		scheme: format,
+		solve:  solve,
+	}
+}
+
+// Read decrypts into p. Frames are decrypted a batch at a time as they're
+// needed, so only the current batch is held in memory.
+func (d *Decryptor) Read(p []byte) (int, error) {
+	for len(d.out) == 0 && d.err == nil {
+		d.err = d.fill()
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	if len(d.out) == 0 {
+		return n, d.err
+	}
+	return n, nil
+}
+
+// fill decrypts the next frame into d.out
+func (d *Decryptor) fill() error {
+	if !d.started {
+		d.started = true
+		return d.start()
+	}
+	if d.aead != nil {
+		return d.open()
+	}
+
+	jobs := workers(d.Jobs)
+	var blocks []*big.Int
+	var end error
+	for len(blocks) < jobs*blocksPerJob {
+		block, err := readBlock(d.r)
+		if err != nil {
+			end = err
+			break
+		}
+		blocks = append(blocks, block)
+	}
+
+	blockBits := make([][]byte, len(blocks))
+	err := runParallel(jobs, len(blocks), func(i int) error {
+		bits, err := d.solve(blocks[i])
+		if err == nil && d.unmask != nil {
+			bits, err = d.unmask(bits)
+		}
+		if err != nil {
+			return &DecryptError{Block: d.block + i, Err: err}
+		}
+		blockBits[i] = bits
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	d.block += len(blocks)
+
+	// every block but the latest is known not to be the last (padded) one
+	for _, bits := range blockBits {
+		if d.pending != nil {
+			d.bits = append(d.bits, d.pending...)
+		}
+		d.pending = bits
+	}
+	whole := len(d.bits) / 8 * 8
+	d.out = bitsToBytes(d.bits[:whole])
+	d.bits = append(d.bits[:0], d.bits[whole:]...)
+
+	if end != io.EOF {
+		return end
+	}
+	// the last block holds the padding
+	if d.pending == nil {
+		return ErrMalformedCiphertext
+	}
+	msgBits, err := unpadBits(append(d.bits, d.pending...))
+	if err != nil {
+		return err
+	}
+	d.out = append(d.out, bitsToBytes(msgBits)...)
+	return io.EOF
+}
+
+// start reads the header and sets up for the mode it names
+func (d *Decryptor) start() error {
+	format, err := d.r.ReadByte()
+	if err != nil {
+		return ErrMalformedCiphertext
+	}
+	if d.scheme != 0 {
+		if format != d.scheme {
+			return fmt.Errorf("%w: unsupported format", ErrMalformedCiphertext)
+		}
+		return nil
+	}
+
+	d.solve = d.k.decryptBits
+	switch format {
+	case formatBlocks:
+	case formatRandomized:
+		if len(d.k.PrivateKey) < minRandomizedLength {
+			return fmt.Errorf("%w: randomized blocks need a key with at least %d elements", ErrMalformedCiphertext, minRandomizedLength)
+		}
+		d.unmask = unmaskBlock
+	case formatCompact:
+		digitBits, err := d.r.ReadByte()
+		if err != nil {
+			return ErrMalformedCiphertext
+		}
+		if int(digitBits) != d.k.digitBits() {
+			return fmt.Errorf("%w: ciphertext has %d bit digits, key has %d", ErrMalformedCiphertext, digitBits, d.k.digitBits())
+		}
+		d.solve = d.k.decryptDigits
+		d.unmask = compactUnmask(int(digitBits))
+	case formatHybrid:
+		wrapped, err := readWrappedKey(d.r)
+		if err != nil {
+			return err
+		}
+		d.aead, err = d.k.unwrapKey(wrapped)
+		return err
+	case formatMultiRecipient:
+		slots, err := readRecipients(d.r, PublicKeyFingerprint(d.k.PublicKey))
+		if err != nil {
+			return err
+		}
+		for _, wrapped := range slots {
+			if d.aead, err = d.k.unwrapKey(wrapped); err == nil {
+				return nil
+			}
+		}
+		return err
+	default:
+		return fmt.Errorf("%w: unsupported format", ErrMalformedCiphertext)
+	}
+	return nil
+}
+
+// opens the next hybrid chunk. a chunk is the last one if nothing follows it.
+func (d *Decryptor) open() error {
+	sealed := make([]byte, hybridChunkSize+d.aead.Overhead())
+	n, err := io.ReadFull(d.r, sealed)
+	last := err == io.EOF || err == io.ErrUnexpectedEOF
+	if err != nil && !last {
+		return err
+	}
+	if !last {
+		if _, err := d.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	d.out, err = d.aead.Open(nil, chunkNonce(d.chunk, last), sealed[:n], nil)
+	if err != nil {
+		return fmt.Errorf("%w: chunk %d", ErrAuthenticationFailed, d.chunk)
+	}
+	d.chunk++
+	if last {
+		return io.EOF
+	}
+	return nil
+}
+
+// runs messageBytes through an Encryptor in the given mode
+func encryptAll(publicKey []*big.Int, mode Mode, random io.Reader, messageBytes []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	e := NewEncryptor(&buf, publicKey)
+	e.Mode = mode
+	if random != nil {
+		e.Rand = random
+	}
+	if _, err := e.Write(messageBytes); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// runs ct through a Decryptor
+func decryptAll(k *Knapsack, ct []byte) ([]byte, error) {
+	return ioutil.ReadAll(NewDecryptor(bytes.NewReader(ct), k))
+}
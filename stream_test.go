@@ -0,0 +1,102 @@
+package knapsack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+)
+
+// writes msg to an Encryptor in pieces of varying size
+func encryptInPieces(t *testing.T, k *Knapsack, mode Mode, msg []byte) []byte {
+	var buf bytes.Buffer
+	e := NewEncryptor(&buf, k.PublicKey)
+	e.Mode = mode
+	for i, size := 0, 1; i < len(msg); i, size = i+size, size*3+1 {
+		end := i + size
+		if end > len(msg) {
+			end = len(msg)
+		}
+		n, err := e.Write(msg[i:end])
+		handleFatalError(err, t)
+		if n != end-i {
+			t.Fatalf("wrote %d bytes, wanted %d", n, end-i)
+		}
+	}
+	handleFatalError(e.Close(), t)
+	return buf.Bytes()
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	k, err := NewKnapsack(512)
+	handleFatalError(err, t)
+
+	for _, mode := range []Mode{ModeTextbook, ModeRandomized, ModeHybrid} {
+		for _, size := range []int{0, 1, 12, 13, 1000, hybridChunkSize + 1} {
+			msg := make([]byte, size)
+			_, err := rand.Read(msg)
+			handleFatalError(err, t)
+
+			ct := encryptInPieces(t, k, mode, msg)
+			if Mode(ct[0]) != mode {
+				t.Fatalf("mode %d: wrong format byte %d", mode, ct[0])
+			}
+
+			d, err := ioutil.ReadAll(iotest.OneByteReader(NewDecryptor(bytes.NewReader(ct), k)))
+			if err != nil {
+				t.Fatalf("mode %d, size %d: %v", mode, size, err)
+			}
+			if !bytes.Equal(d, msg) {
+				t.Errorf("mode %d, size %d: decrypted message differs", mode, size)
+			}
+		}
+	}
+}
+
+func TestStreamMatchesEncryptBytes(t *testing.T) {
+	k, err := NewKnapsack(100)
+	handleFatalError(err, t)
+
+	msg := bytes.Repeat([]byte("0123456789ab"), 40)
+	want, err := EncryptBytes(k.PublicKey, msg)
+	handleFatalError(err, t)
+	if got := encryptInPieces(t, k, ModeTextbook, msg); !bytes.Equal(got, want) {
+		t.Error("streamed ciphertext differs from EncryptBytes")
+	}
+}
+
+func TestStreamTruncated(t *testing.T) {
+	k, err := NewKnapsack(100)
+	handleFatalError(err, t)
+
+	ct, err := EncryptBytes(k.PublicKey, bytes.Repeat([]byte("0123456789ab"), 4))
+	handleFatalError(err, t)
+
+	// cutting a block in half is malformed
+	_, err = ioutil.ReadAll(NewDecryptor(bytes.NewReader(ct[:len(ct)-3]), k))
+	if !errors.Is(err, ErrMalformedCiphertext) {
+		t.Errorf("wanted ErrMalformedCiphertext, got %v", err)
+	}
+
+	// a header with no blocks is malformed
+	_, err = ioutil.ReadAll(NewDecryptor(bytes.NewReader(ct[:1]), k))
+	if !errors.Is(err, ErrMalformedCiphertext) {
+		t.Errorf("wanted ErrMalformedCiphertext, got %v", err)
+	}
+}
+
+func TestEncryptorRejectsShortKey(t *testing.T) {
+	k, err := NewKnapsack(4)
+	handleFatalError(err, t)
+
+	e := NewEncryptor(ioutil.Discard, k.PublicKey)
+	e.Mode = ModeRandomized
+	if _, err := e.Write([]byte("hi")); err == nil {
+		t.Error("wanted error for randomized encryption with a 4 element key")
+	}
+	if err := e.Close(); err == nil {
+		t.Error("wanted Close to report the same error")
+	}
+}
@@ -0,0 +1,122 @@
+package knapsack
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var (
+	// ErrMissingParameter means a required Knapsack field is empty
+	ErrMissingParameter = errors.New("missing key parameter")
+	// ErrNotSuperincreasing means the private key isn't a superincreasing sequence
+	ErrNotSuperincreasing = errors.New("private key is not superincreasing")
+	// ErrModulusTooSmall means M isn't larger than the sum of the private key
+	ErrModulusTooSmall = errors.New("modulus is not larger than the private key sum")
+	// ErrWNotCoprime means gcd(W, M) != 1
+	ErrWNotCoprime = errors.New("W is not coprime to the modulus")
+	// ErrBadInverse means W * WI is not 1 mod M
+	ErrBadInverse = errors.New("WI is not the inverse of W mod M")
+	// ErrInvalidPermutation means Perm isn't a permutation of the key indexes
+	ErrInvalidPermutation = errors.New("invalid public key permutation")
+	// ErrInvalidPublicKey means a public key has no elements or non-positive elements
+	ErrInvalidPublicKey = errors.New("invalid public key")
+	// ErrInvalidDigitBits means a compact knapsack's DigitBits is out of range
+	ErrInvalidDigitBits = errors.New("invalid digit bits")
+	// ErrInvalidVariant means the LowBits or Moduli of a Graham–Shamir or
+	// Goodman–McAuley key don't fit its private key
+	ErrInvalidVariant = errors.New("invalid knapsack variant parameters")
+	// ErrPublicKeyMismatch means the public key wasn't derived from the private key
+	ErrPublicKeyMismatch = errors.New("public key does not match private key")
+)
+
+// Validate checks the structural invariants of the Knapsack and reports the
+// first one that fails. The public key is only checked if it's present.
+func (k *Knapsack) Validate() error {
+	if len(k.PrivateKey) == 0 {
+		return fmt.Errorf("%w: private key", ErrMissingParameter)
+	}
+	if k.M == nil || k.W == nil || k.WI == nil {
+		return fmt.Errorf("%w: M, W and WI are required", ErrMissingParameter)
+	}
+
+	if k.DigitBits < 0 || k.DigitBits > maxDigitBits {
+		return fmt.Errorf("%w: %d", ErrInvalidDigitBits, k.DigitBits)
+	}
+
+	if k.Variant() != VariantMerkleHellman {
+		if err := k.validateVariant(); err != nil {
+			return err
+		}
+	} else {
+		// compact knapsacks need each element larger than the largest knapsack of
+		// the ones before it, i.e. (2^DigitBits - 1) times their sum
+		maxDigit := big.NewInt(int64(1)<<uint(k.digitBits()) - 1)
+		total := new(big.Int)
+		for idx, n := range k.PrivateKey {
+			if n == nil || n.Cmp(new(big.Int).Mul(total, maxDigit)) <= 0 {
+				return fmt.Errorf("%w: element %d is not larger than the sum of the elements before it", ErrNotSuperincreasing, idx)
+			}
+			total.Add(total, n)
+		}
+	}
+
+	// each round's modulus must exceed the largest knapsack of the sequence it disguises
+	seq := k.PrivateKey
+	for idx, r := range k.rounds() {
+		if r.M == nil || r.W == nil || r.WI == nil {
+			return fmt.Errorf("%w: round %d needs M, W and WI", ErrMissingParameter, idx)
+		}
+		if r.M.Cmp(maxKnapsack(seq, k.digitBits())) <= 0 {
+			return fmt.Errorf("%w: round %d", ErrModulusTooSmall, idx)
+		}
+		if new(big.Int).GCD(nil, nil, r.W, r.M).Cmp(big.NewInt(1)) != 0 {
+			return fmt.Errorf("%w: round %d", ErrWNotCoprime, idx)
+		}
+		wwi := new(big.Int).Mul(r.W, r.WI)
+		if wwi.Mod(wwi, r.M).Cmp(big.NewInt(1)) != 0 {
+			return fmt.Errorf("%w: round %d", ErrBadInverse, idx)
+		}
+		seq = r.apply(seq)
+	}
+
+	if len(k.Perm) > 0 {
+		if len(k.Perm) != len(k.PrivateKey) {
+			return fmt.Errorf("%w: has %d indexes for %d elements", ErrInvalidPermutation, len(k.Perm), len(k.PrivateKey))
+		}
+		seen := make([]bool, len(k.Perm))
+		for idx, privIdx := range k.Perm {
+			if privIdx < 0 || privIdx >= len(seen) || seen[privIdx] {
+				return fmt.Errorf("%w: bad index at position %d", ErrInvalidPermutation, idx)
+			}
+			seen[privIdx] = true
+		}
+	}
+
+	if k.PublicKey == nil {
+		return nil
+	}
+	if len(k.PublicKey) != len(k.PrivateKey) {
+		return fmt.Errorf("%w: has %d elements, private key has %d", ErrPublicKeyMismatch, len(k.PublicKey), len(k.PrivateKey))
+	}
+	for idx, n := range k.DerivePublicKey() {
+		if k.PublicKey[idx] == nil || k.PublicKey[idx].Cmp(n) != 0 {
+			return fmt.Errorf("%w: element %d", ErrPublicKeyMismatch, idx)
+		}
+	}
+	return nil
+}
+
+// ValidatePublicKey checks what can be checked without the private key:
+// the public key has elements and they're all positive
+func ValidatePublicKey(publicKey []*big.Int) error {
+	if len(publicKey) == 0 {
+		return fmt.Errorf("%w: no elements", ErrInvalidPublicKey)
+	}
+	for idx, n := range publicKey {
+		if n == nil || n.Sign() <= 0 {
+			return fmt.Errorf("%w: element %d is not positive", ErrInvalidPublicKey, idx)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package knapsack
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	k, err := NewKnapsack(20)
+	handleFatalError(err, t)
+	if err := k.Validate(); err != nil {
+		t.Fatalf("wanted valid knapsack, got %v", err)
+	}
+
+	type testCase struct {
+		corrupt  func(k *Knapsack)
+		expected error
+	}
+	testCases := []testCase{
+		{
+			corrupt:  func(k *Knapsack) { k.WI = nil },
+			expected: ErrMissingParameter,
+		},
+		{
+			corrupt:  func(k *Knapsack) { k.PrivateKey[3] = new(big.Int).Set(k.PrivateKey[2]) },
+			expected: ErrNotSuperincreasing,
+		},
+		{
+			corrupt:  func(k *Knapsack) { k.M = sum(k.PrivateKey) },
+			expected: ErrModulusTooSmall,
+		},
+		{
+			corrupt: func(k *Knapsack) {
+				// an even modulus and an even W share a factor of 2
+				k.M = new(big.Int).Lsh(sum(k.PrivateKey), 1)
+				k.W = big.NewInt(4)
+			},
+			expected: ErrWNotCoprime,
+		},
+		{
+			corrupt:  func(k *Knapsack) { k.WI = new(big.Int).Add(k.WI, big.NewInt(1)) },
+			expected: ErrBadInverse,
+		},
+		{
+			corrupt: func(k *Knapsack) {
+				// a second round whose modulus is smaller than the first round's output
+				k.Iterations = []Round{{M: big.NewInt(7), W: big.NewInt(3), WI: big.NewInt(5)}}
+			},
+			expected: ErrModulusTooSmall,
+		},
+		{
+			corrupt:  func(k *Knapsack) { k.Perm[0] = k.Perm[1] },
+			expected: ErrInvalidPermutation,
+		},
+		{
+			corrupt:  func(k *Knapsack) { k.PublicKey[5] = new(big.Int).Add(k.PublicKey[5], big.NewInt(1)) },
+			expected: ErrPublicKeyMismatch,
+		},
+		{
+			corrupt:  func(k *Knapsack) { k.PublicKey = k.PublicKey[1:] },
+			expected: ErrPublicKeyMismatch,
+		},
+	}
+
+	for idx, tc := range testCases {
+		k, err := NewKnapsack(20)
+		handleFatalError(err, t)
+		tc.corrupt(k)
+		if err := k.Validate(); !errors.Is(err, tc.expected) {
+			t.Errorf("for test case #%d: wanted %v, got %v", idx, tc.expected, err)
+		}
+	}
+}
+
+func TestValidatePublicKey(t *testing.T) {
+	if err := ValidatePublicKey(intsToBigs([]int64{3, 1, 2})); err != nil {
+		t.Errorf("wanted valid public key, got %v", err)
+	}
+	for idx, pk := range [][]*big.Int{nil, intsToBigs([]int64{3, 0, 2})} {
+		if err := ValidatePublicKey(pk); !errors.Is(err, ErrInvalidPublicKey) {
+			t.Errorf("for test case #%d: wanted ErrInvalidPublicKey, got %v", idx, err)
+		}
+	}
+}
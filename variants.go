@@ -0,0 +1,257 @@
+package knapsack
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"math/bits"
+)
+
+// Variant is the kind of easy knapsack hidden behind the modular multiplications.
+// Every variant uses the same public key, encryption and key files; only key
+// generation and the solve step of decryption differ.
+type Variant int
+
+const (
+	// VariantMerkleHellman hides a superincreasing sequence
+	VariantMerkleHellman Variant = iota
+	// VariantGrahamShamir hides elements whose low bits are superincreasing
+	// and whose high bits are random, so the private sequence isn't
+	// superincreasing itself (Knapsack.LowBits says where the split is)
+	VariantGrahamShamir
+	// VariantGoodmanMcAuley hides elements that are 0 modulo every CRT
+	// modulus but their own (see Knapsack.Moduli); the bits are read off one
+	// residue at a time
+	VariantGoodmanMcAuley
+)
+
+var variantNames = []string{"merkle-hellman", "graham-shamir", "goodman-mcauley"}
+
+// ErrUnknownVariant means a variant name or number isn't one of the Variant constants
+var ErrUnknownVariant = errors.New("unknown knapsack variant")
+
+// String returns the variant's name, e.g. "graham-shamir"
+func (v Variant) String() string {
+	if v < 0 || int(v) >= len(variantNames) {
+		return fmt.Sprintf("Variant(%d)", int(v))
+	}
+	return variantNames[v]
+}
+
+// ParseVariant returns the Variant named `name` (see Variant.String)
+func ParseVariant(name string) (Variant, error) {
+	for v, n := range variantNames {
+		if n == name {
+			return Variant(v), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownVariant, name)
+}
+
+// GrahamShamirKeygenOptions returns options for a Graham–Shamir key: the low
+// bits of each private element are a superincreasing sequence with
+// Growth = keyLength, and keyLength random bits are put above them
+func GrahamShamirKeygenOptions(keyLength int64) KeygenOptions {
+	opts := KeygenOptions{
+		Length:  keyLength,
+		Growth:  keyLength,
+		Variant: VariantGrahamShamir,
+	}
+	opts.ModulusBits = opts.MinModulusBits()
+	return opts
+}
+
+// GoodmanMcAuleyKeygenOptions returns options for a Goodman–McAuley key with
+// one CRT modulus per element, each a prime of bitLen(keyLength) + 8 bits
+func GoodmanMcAuleyKeygenOptions(keyLength int64) KeygenOptions {
+	opts := KeygenOptions{
+		Length:  keyLength,
+		Growth:  int64(bits.Len64(uint64(keyLength))) + 8,
+		Variant: VariantGoodmanMcAuley,
+	}
+	opts.ModulusBits = opts.MinModulusBits()
+	return opts
+}
+
+// Variant reports which easy knapsack the private key is
+func (k *Knapsack) Variant() Variant {
+	switch {
+	case len(k.Moduli) > 0:
+		return VariantGoodmanMcAuley
+	case k.LowBits > 0:
+		return VariantGrahamShamir
+	}
+	return VariantMerkleHellman
+}
+
+// grahamShamirLowBits is the number of low bits that hold the superincreasing
+// part of a Graham–Shamir key: the sum of randomSuperincreasingSequence(length, growth)
+// is below 2^(length + growth + 1)
+func grahamShamirLowBits(length, growth int64) int64 {
+	return length + growth + 1
+}
+
+// returns Graham–Shamir private key elements r_i * 2^lowBits + s_i, where the
+// s_i are superincreasing and the r_i are `length` random bits, and lowBits
+func randomGrahamShamirSequence(random io.Reader, length, growth int64) ([]*big.Int, int, error) {
+	low, err := randomSuperincreasingSequence(random, length, growth, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	lowBits := grahamShamirLowBits(length, growth)
+	high := new(big.Int).Lsh(big.NewInt(1), uint(length))
+	for idx, s := range low {
+		r, err := randomInt(random, high)
+		if err != nil {
+			return nil, 0, err
+		}
+		low[idx] = r.Lsh(r, uint(lowBits)).Add(r, s)
+	}
+	return low, int(lowBits), nil
+}
+
+// goodmanMcAuleyMinBits returns the smallest prime size with at least twice
+// `length` primes of that many bits, going by Rosser and Schoenfeld's bounds
+// x / ln x < pi(x) < 1.25506 x / ln x (for x >= 17), so that
+// randomGoodmanMcAuleySequence quickly finds `length` distinct ones
+func goodmanMcAuleyMinBits(length int64) int64 {
+	for b := int64(5); ; b++ {
+		hi, lo := math.Ldexp(1, int(b)), math.Ldexp(1, int(b-1))
+		if hi/math.Log(hi)-1.25506*lo/math.Log(lo) >= 2*float64(length) {
+			return b
+		}
+	}
+}
+
+// returns Goodman–McAuley private key elements and their moduli: `length`
+// distinct primes p_i of `primeBits` bits, and a'_i = v_i * P / p_i for
+// P = prod(p_i) and a random v_i in [1, p_i). a'_i is 0 mod every p_j but p_i,
+// and a unit mod p_i.
+func randomGoodmanMcAuleySequence(random io.Reader, length, primeBits int64) ([]*big.Int, []*big.Int, error) {
+	one := big.NewInt(1)
+	min := new(big.Int).Lsh(one, uint(primeBits-1))
+	max := new(big.Int).Lsh(one, uint(primeBits))
+	moduli := make([]*big.Int, 0, length)
+	seen := make(map[string]bool)
+	for attempts := int64(0); int64(len(moduli)) < length; attempts++ {
+		if attempts > 100*length*primeBits {
+			return nil, nil, fmt.Errorf("couldn't find %d distinct %d-bit primes", length, primeBits)
+		}
+		p, err := randomUniform(random, min, max)
+		if err != nil {
+			return nil, nil, err
+		}
+		if seen[p.String()] || !p.ProbablyPrime(20) {
+			continue
+		}
+		seen[p.String()] = true
+		moduli = append(moduli, p)
+	}
+
+	product := big.NewInt(1)
+	for _, p := range moduli {
+		product.Mul(product, p)
+	}
+	out := make([]*big.Int, length)
+	for idx, p := range moduli {
+		v, err := randomUniform(random, one, p)
+		if err != nil {
+			return nil, nil, err
+		}
+		out[idx] = v.Mul(v, new(big.Int).Div(product, p))
+	}
+	return out, moduli, nil
+}
+
+// solveVariant solves the unmasked block `c` (the exact sum of the selected
+// private key elements) for a Graham–Shamir or Goodman–McAuley key
+func (k *Knapsack) solveVariant(c *big.Int) ([]byte, error) {
+	if k.Variant() == VariantGrahamShamir {
+		// the random high bits drop out mod 2^LowBits, and the superincreasing
+		// low bits can't carry into them
+		mask := new(big.Int).Lsh(big.NewInt(1), uint(k.LowBits))
+		mask.Sub(mask, big.NewInt(1))
+		low := make([]*big.Int, len(k.PrivateKey))
+		for idx, n := range k.PrivateKey {
+			low[idx] = new(big.Int).And(n, mask)
+		}
+		return solveKnapsack(low, new(big.Int).And(c, mask))
+	}
+
+	// c = x_i * a'_i (mod p_i), so x_i = c / a'_i (mod p_i)
+	solution := make([]byte, len(k.PrivateKey))
+	x := new(big.Int)
+	for idx, n := range k.PrivateKey {
+		p := k.Moduli[idx]
+		inv := new(big.Int).ModInverse(new(big.Int).Mod(n, p), p)
+		if inv == nil {
+			return nil, ErrNoSolution
+		}
+		x.Mul(c, inv)
+		x.Mod(x, p)
+		if !x.IsInt64() || x.Int64() > 1 {
+			return nil, ErrNoSolution
+		}
+		solution[idx] = byte(x.Int64())
+	}
+	return solution, nil
+}
+
+// validateVariant checks the private key of a Graham–Shamir or Goodman–McAuley key
+func (k *Knapsack) validateVariant() error {
+	if k.LowBits > 0 && len(k.Moduli) > 0 {
+		return fmt.Errorf("%w: both LowBits and Moduli are set", ErrInvalidVariant)
+	}
+	if k.digitBits() > 1 {
+		return fmt.Errorf("%w: %s keys carry one bit per element", ErrInvalidDigitBits, k.Variant())
+	}
+	for idx, n := range k.PrivateKey {
+		if n == nil || n.Sign() <= 0 {
+			return fmt.Errorf("%w: element %d is not positive", ErrInvalidVariant, idx)
+		}
+	}
+
+	if k.Variant() == VariantGrahamShamir {
+		// the low bits must be superincreasing and their sum must fit in LowBits
+		mask := new(big.Int).Lsh(big.NewInt(1), uint(k.LowBits))
+		mask.Sub(mask, big.NewInt(1))
+		total := new(big.Int)
+		for idx, n := range k.PrivateKey {
+			low := new(big.Int).And(n, mask)
+			if low.Cmp(total) <= 0 {
+				return fmt.Errorf("%w: the low bits of element %d are not larger than the sum of the ones before it", ErrNotSuperincreasing, idx)
+			}
+			total.Add(total, low)
+		}
+		if total.Cmp(mask) > 0 {
+			return fmt.Errorf("%w: the low bits of the private key sum to more than %d bits", ErrNotSuperincreasing, k.LowBits)
+		}
+		return nil
+	}
+
+	if len(k.Moduli) != len(k.PrivateKey) {
+		return fmt.Errorf("%w: has %d moduli for %d elements", ErrInvalidVariant, len(k.Moduli), len(k.PrivateKey))
+	}
+	one := big.NewInt(1)
+	gcd := new(big.Int)
+	r := new(big.Int)
+	for i, p := range k.Moduli {
+		if p == nil || p.Cmp(one) <= 0 {
+			return fmt.Errorf("%w: modulus %d is not > 1", ErrInvalidVariant, i)
+		}
+		for j, n := range k.PrivateKey {
+			if i == j {
+				if gcd.GCD(nil, nil, n, p).Cmp(one) != 0 {
+					return fmt.Errorf("%w: element %d is not a unit mod its modulus", ErrInvalidVariant, i)
+				}
+			} else if r.Mod(n, p).Sign() != 0 {
+				return fmt.Errorf("%w: element %d is not 0 mod modulus %d", ErrInvalidVariant, j, i)
+			}
+		}
+	}
+	// element i is 0 mod every other modulus and a unit mod p_i, so p_i can't
+	// share a factor with any other modulus: the moduli are pairwise coprime
+	return nil
+}
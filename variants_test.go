@@ -0,0 +1,181 @@
+package knapsack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+func TestVariants(t *testing.T) {
+	iterated := GoodmanMcAuleyKeygenOptions(24)
+	iterated.Rounds = 3
+	testCases := []KeygenOptions{
+		GrahamShamirKeygenOptions(32),
+		GoodmanMcAuleyKeygenOptions(32),
+		iterated,
+	}
+
+	for idx, opts := range testCases {
+		k, err := NewKnapsackWithOptions(rand.Reader, opts)
+		if err != nil {
+			t.Fatalf("for test case #%d: %v", idx, err)
+		}
+		if k.Variant() != opts.Variant {
+			t.Errorf("for test case #%d: wanted a %s key, got %s", idx, opts.Variant, k.Variant())
+		}
+		if isSuperincreasing(k.PrivateKey) {
+			t.Errorf("for test case #%d: %s private key is superincreasing", idx, opts.Variant)
+		}
+		handleFatalError(k.Validate(), t)
+
+		msg := []byte("hello world")
+		ct, err := EncryptBytesHybrid(rand.Reader, k.PublicKey, msg)
+		handleFatalError(err, t)
+		d, err := k.DecryptBytes(ct)
+		if err != nil {
+			t.Fatalf("for test case #%d: %v", idx, err)
+		}
+		if !bytes.Equal(d, msg) {
+			t.Errorf("for test case #%d: wanted %v, got %v", idx, msg, d)
+		}
+
+		// the variant survives a trip through the key files
+		_, priv, err := Pack(*k)
+		handleFatalError(err, t)
+		cs, sk, err := UnmarshalPrivateKey(priv)
+		handleFatalError(err, t)
+		if cs.Name() != "merkle-hellman" {
+			t.Errorf("for test case #%d: key file detected as %s", idx, cs.Name())
+		}
+		if equal, msg := equalKnapsacks(k, sk.(*Knapsack)); !equal {
+			t.Errorf("for test case #%d: %s", idx, msg)
+		}
+		if sk.(*Knapsack).Variant() != opts.Variant {
+			t.Errorf("for test case #%d: unpacked a %s key", idx, sk.(*Knapsack).Variant())
+		}
+	}
+}
+
+func TestVariantFieldsInKeyFile(t *testing.T) {
+	k, err := NewKnapsackWithOptions(rand.Reader, GoodmanMcAuleyKeygenOptions(16))
+	handleFatalError(err, t)
+	_, priv, err := Pack(*k)
+	handleFatalError(err, t)
+	var skf PrivateKeyFile
+	handleFatalError(msgpack.Unmarshal(priv, &skf), t)
+	if len(skf.Moduli) != 16 || skf.LowBits != 0 {
+		t.Errorf("wanted 16 moduli and no low bits, got %d and %d", len(skf.Moduli), skf.LowBits)
+	}
+
+	// Merkle-Hellman key files don't grow new fields
+	mh, err := NewKnapsack(16)
+	handleFatalError(err, t)
+	_, priv, err = Pack(*mh)
+	handleFatalError(err, t)
+	var fields map[string]interface{}
+	handleFatalError(msgpack.Unmarshal(priv, &fields), t)
+	for _, name := range []string{"LowBits", "Moduli"} {
+		if _, ok := fields[name]; ok {
+			t.Errorf("merkle-hellman key file has %s", name)
+		}
+	}
+}
+
+func TestValidateVariants(t *testing.T) {
+	gs, err := NewKnapsackWithOptions(rand.Reader, GrahamShamirKeygenOptions(16))
+	handleFatalError(err, t)
+	gm, err := NewKnapsackWithOptions(rand.Reader, GoodmanMcAuleyKeygenOptions(16))
+	handleFatalError(err, t)
+
+	testCases := []struct {
+		name   string
+		base   *Knapsack
+		mutate func(k *Knapsack)
+		want   error
+	}{
+		{"not superincreasing without LowBits", gs, func(k *Knapsack) { k.LowBits = 0 }, ErrNotSuperincreasing},
+		{"low bits overflow", gs, func(k *Knapsack) { k.LowBits = 10 }, ErrNotSuperincreasing},
+		{"compact", gs, func(k *Knapsack) { k.DigitBits = 2 }, ErrInvalidDigitBits},
+		{"both variants", gs, func(k *Knapsack) { k.Moduli = gm.Moduli }, ErrInvalidVariant},
+		{"missing modulus", gm, func(k *Knapsack) { k.Moduli = k.Moduli[1:] }, ErrInvalidVariant},
+		{"swapped moduli", gm, func(k *Knapsack) {
+			k.Moduli = append([]*big.Int{k.Moduli[1], k.Moduli[0]}, k.Moduli[2:]...)
+		}, ErrInvalidVariant},
+		{"modulus of 1", gm, func(k *Knapsack) {
+			k.Moduli = append([]*big.Int{big.NewInt(1)}, k.Moduli[1:]...)
+		}, ErrInvalidVariant},
+	}
+	for _, tc := range testCases {
+		k := *tc.base
+		k.PublicKey = nil
+		tc.mutate(&k)
+		if err := k.Validate(); !errors.Is(err, tc.want) {
+			t.Errorf("%s: wanted %v, got %v", tc.name, tc.want, err)
+		}
+	}
+}
+
+func TestGoodmanMcAuleyMinBits(t *testing.T) {
+	counts := make(map[int64]int64)
+	for length := int64(1); length <= 1000; length = length*3/2 + 1 {
+		b := goodmanMcAuleyMinBits(length)
+		if def := GoodmanMcAuleyKeygenOptions(length).Growth; b > def {
+			t.Errorf("length %d: minimum %d bits is more than the default %d", length, b, def)
+		}
+		if _, ok := counts[b]; !ok {
+			for n := int64(1) << uint(b-1); n < 1<<uint(b); n++ {
+				if big.NewInt(n).ProbablyPrime(0) {
+					counts[b]++
+				}
+			}
+		}
+		if counts[b] < 2*length {
+			t.Errorf("length %d: only %d primes of %d bits", length, counts[b], b)
+		}
+	}
+}
+
+func TestVariantKeygenOptionsErrors(t *testing.T) {
+	compact := GrahamShamirKeygenOptions(10)
+	compact.DigitBits = 2
+	dense := GoodmanMcAuleyKeygenOptions(10)
+	dense.Density = 0.5
+	smallPrimes := GoodmanMcAuleyKeygenOptions(10)
+	smallPrimes.Growth = 6
+	// there are only 464 13 bit primes
+	fewPrimes := GoodmanMcAuleyKeygenOptions(500)
+	fewPrimes.Growth = 13
+	smallModulus := GrahamShamirKeygenOptions(10)
+	smallModulus.ModulusBits--
+
+	testCases := []KeygenOptions{
+		compact,
+		dense,
+		smallPrimes,
+		fewPrimes,
+		smallModulus,
+		{Length: 10, Growth: 10, ModulusBits: 22, Variant: Variant(7)},
+	}
+	for idx, opts := range testCases {
+		if _, err := NewKnapsackWithOptions(rand.Reader, opts); err == nil {
+			t.Errorf("test case #%d: expected an error", idx)
+		}
+	}
+}
+
+func TestParseVariant(t *testing.T) {
+	for _, v := range []Variant{VariantMerkleHellman, VariantGrahamShamir, VariantGoodmanMcAuley} {
+		parsed, err := ParseVariant(v.String())
+		handleFatalError(err, t)
+		if parsed != v {
+			t.Errorf("parsed %s as %s", v, parsed)
+		}
+	}
+	if _, err := ParseVariant("merkle"); !errors.Is(err, ErrUnknownVariant) {
+		t.Errorf("wanted ErrUnknownVariant, got %v", err)
+	}
+}